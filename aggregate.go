@@ -0,0 +1,279 @@
+package gonx
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Aggregator is an optional interface of the reducers that aggregate the
+// entries in place, one by one. GroupBy keeps an Aggregate for each group
+// instead of the goroutine and the channels per group, when all its
+// reducers are Aggregators.
+type Aggregator interface {
+	Reducer
+	// Returns a new empty aggregation state.
+	NewAggregate() Aggregate
+}
+
+// Aggregate is the aggregation state of the Aggregator. The state of the
+// package aggregates is JSON encodable, see Stateful.
+type Aggregate interface {
+	// Add the entry to the aggregation, the entry should not be changed.
+	Add(entry *Entry)
+	// Returns the aggregation result, the same as the Reduce output.
+	Result() *Entry
+}
+
+// Mergeable is an optional interface of the Aggregate to combine the states
+// of the parallel or sharded runs (e.g. per file or per chunk of the file)
+// into the final one, see Stateful.Merge and StatefulGroupBy.Merge. The
+// Count, Sum, IntSum and Avg aggregates are Mergeable, unlike their
+// results: e.g. the averages of the shards are weighted by the shards
+// entries count. The Fold aggregate is not Mergeable.
+type Mergeable interface {
+	Aggregate
+	// Merge the other state of the same Aggregator into this one, it
+	// returns an error if the other state is of another type.
+	Merge(other Aggregate) error
+}
+
+func mergeTypeError(a, other Aggregate) error {
+	return fmt.Errorf("gonx: cannot merge %T into %T", other, a)
+}
+
+// Aggregate the input entries and write the result to the output, it is
+// the Reduce of the Aggregator.
+func reduceAggregate(aggregate Aggregate, input chan *Entry, output chan *Entry) {
+	for entry := range input {
+		aggregate.Add(entry)
+	}
+	output <- aggregate.Result()
+	close(output)
+}
+
+// Returns the aggregators of the reducers, ok is false if any of them is
+// not an Aggregator.
+func aggregators(reducers []Reducer) (result []Aggregator, ok bool) {
+	for _, reducer := range reducers {
+		aggregator, ok := reducer.(Aggregator)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, aggregator)
+	}
+	return result, true
+}
+
+type countAggregate struct {
+	Count uint64 `json:"count"`
+}
+
+func (r *Count) NewAggregate() Aggregate {
+	return new(countAggregate)
+}
+
+func (a *countAggregate) Add(entry *Entry) {
+	a.Count++
+}
+
+func (a *countAggregate) Merge(other Aggregate) error {
+	o, ok := other.(*countAggregate)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	a.Count += o.Count
+	return nil
+}
+
+func (a *countAggregate) Result() *Entry {
+	entry := NewEmptyEntry()
+	entry.SetUintField("count", a.Count)
+	return entry
+}
+
+type sumAggregate struct {
+	fields []string
+	Sum    map[string]float64 `json:"sum"`
+}
+
+func (r *Sum) NewAggregate() Aggregate {
+	return &sumAggregate{r.Fields, make(map[string]float64)}
+}
+
+func (a *sumAggregate) Add(entry *Entry) {
+	for _, name := range a.fields {
+		val, err := entry.FloatField(name)
+		if err == nil {
+			a.Sum[name] += val
+		}
+	}
+}
+
+func (a *sumAggregate) Merge(other Aggregate) error {
+	o, ok := other.(*sumAggregate)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	for name, val := range o.Sum {
+		a.Sum[name] += val
+	}
+	return nil
+}
+
+func (a *sumAggregate) Result() *Entry {
+	entry := NewEmptyEntry()
+	for name, val := range a.Sum {
+		entry.SetFloatField(name, val)
+	}
+	return entry
+}
+
+type intSumAggregate struct {
+	fields []string
+	Sum    map[string]int64    `json:"sum"`
+	Large  map[string]*big.Int `json:"large"`
+}
+
+func (r *IntSum) NewAggregate() Aggregate {
+	return &intSumAggregate{r.Fields, make(map[string]int64), make(map[string]*big.Int)}
+}
+
+func (a *intSumAggregate) Add(entry *Entry) {
+	for _, name := range a.fields {
+		val, err := entry.IntField(name)
+		if err != nil {
+			continue
+		}
+		if total, ok := a.Large[name]; ok {
+			total.Add(total, big.NewInt(val))
+			continue
+		}
+		current := a.Sum[name]
+		if (val > 0 && current > math.MaxInt64-val) || (val < 0 && current < math.MinInt64-val) {
+			a.Large[name] = new(big.Int).Add(big.NewInt(current), big.NewInt(val))
+			continue
+		}
+		a.Sum[name] = current + val
+	}
+}
+
+func (a *intSumAggregate) Merge(other Aggregate) error {
+	o, ok := other.(*intSumAggregate)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	for name, val := range o.Sum {
+		if _, ok := o.Large[name]; !ok {
+			a.add(name, big.NewInt(val))
+		}
+	}
+	for name, val := range o.Large {
+		a.add(name, val)
+	}
+	return nil
+}
+
+// Add the arbitrary precision value to the field sum, the Sum value of the
+// field is stale once it is Large.
+func (a *intSumAggregate) add(name string, val *big.Int) {
+	total := new(big.Int)
+	if large, ok := a.Large[name]; ok {
+		total.Add(large, val)
+	} else {
+		total.Add(big.NewInt(a.Sum[name]), val)
+	}
+	delete(a.Large, name)
+	delete(a.Sum, name)
+	if total.IsInt64() {
+		a.Sum[name] = total.Int64()
+	} else {
+		a.Large[name] = total
+	}
+}
+
+func (a *intSumAggregate) Result() *Entry {
+	entry := NewEmptyEntry()
+	for name, val := range a.Sum {
+		entry.SetIntField(name, val)
+	}
+	for name, val := range a.Large {
+		entry.SetField(name, val.String())
+	}
+	return entry
+}
+
+type avgAggregate struct {
+	fields []string
+	Avg    map[string]float64 `json:"avg"`
+	// Entries count and the samples count of each field.
+	Count  float64            `json:"count"`
+	Counts map[string]float64 `json:"counts"`
+}
+
+func (r *Avg) NewAggregate() Aggregate {
+	return &avgAggregate{
+		fields: r.Fields,
+		Avg:    make(map[string]float64),
+		Counts: make(map[string]float64),
+	}
+}
+
+func (a *avgAggregate) Add(entry *Entry) {
+	for _, name := range a.fields {
+		val, err := entry.FloatField(name)
+		if err == nil {
+			count := a.Counts[name]
+			a.Avg[name] = (a.Avg[name]*count + val) / (count + 1)
+			a.Counts[name] = count + 1
+		}
+	}
+	a.Count++
+}
+
+func (a *avgAggregate) Merge(other Aggregate) error {
+	o, ok := other.(*avgAggregate)
+	if !ok {
+		return mergeTypeError(a, other)
+	}
+	for name, val := range o.Avg {
+		count := a.Counts[name] + o.Counts[name]
+		if count > 0 {
+			a.Avg[name] = (a.Avg[name]*a.Counts[name] + val*o.Counts[name]) / count
+		}
+		a.Counts[name] = count
+	}
+	a.Count += o.Count
+	return nil
+}
+
+func (a *avgAggregate) Result() *Entry {
+	entry := NewEmptyEntry()
+	entry.SetUintField("count", uint64(a.Count))
+	for name, val := range a.Avg {
+		entry.SetFloatField(name, val)
+		entry.SetUintField(name+"_count", uint64(a.Counts[name]))
+	}
+	return entry
+}
+
+type foldAggregate struct {
+	step func(acc, entry *Entry) *Entry
+	Acc  *Entry `json:"acc"`
+}
+
+func (r *Fold) NewAggregate() Aggregate {
+	acc := NewEmptyEntry()
+	if r.Init != nil {
+		acc = r.Init()
+	}
+	return &foldAggregate{r.Step, acc}
+}
+
+func (a *foldAggregate) Add(entry *Entry) {
+	a.Acc = a.step(a.Acc, entry)
+}
+
+func (a *foldAggregate) Result() *Entry {
+	return a.Acc
+}
@@ -0,0 +1,80 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAggregate(t *testing.T) {
+	Convey("Test in place aggregation", t, func() {
+		entries := []*Entry{
+			NewEntry(Fields{"bytes": "10", "time": "0.5"}),
+			NewEntry(Fields{"bytes": "20"}),
+			NewEntry(Fields{"bytes": "-", "time": "1.5"}),
+		}
+
+		Convey("Aggregate entries", func() {
+			for _, aggregator := range []Aggregator{
+				new(Count), &Sum{[]string{"bytes"}}, &IntSum{[]string{"bytes"}}, &Avg{[]string{"time"}},
+			} {
+				aggregate := aggregator.NewAggregate()
+				input := make(chan *Entry, len(entries))
+				for _, entry := range entries {
+					aggregate.Add(entry)
+					input <- entry
+				}
+				close(input)
+				output := make(chan *Entry, 1)
+				aggregator.Reduce(input, output)
+				So(aggregate.Result(), ShouldResemble, <-output)
+			}
+		})
+
+		Convey("Merge aggregates", func() {
+			for _, aggregator := range []Aggregator{
+				new(Count), &Sum{[]string{"bytes"}}, &IntSum{[]string{"bytes"}}, &Avg{[]string{"bytes"}},
+			} {
+				whole := aggregator.NewAggregate()
+				first := aggregator.NewAggregate()
+				second := aggregator.NewAggregate()
+				for i, value := range []string{"10", "9223372036854775800", "30", "40"} {
+					entry := NewEntry(Fields{"bytes": value})
+					whole.Add(entry)
+					if i < 1 {
+						first.Add(entry)
+					} else {
+						second.Add(entry)
+					}
+				}
+				So(first.(Mergeable).Merge(second), ShouldBeNil)
+				So(first.Result(), ShouldResemble, whole.Result())
+			}
+		})
+
+		Convey("Merge weighted averages", func() {
+			avg := &Avg{[]string{"time"}}
+			first := avg.NewAggregate()
+			first.Add(NewEntry(Fields{"time": "1"}))
+			second := avg.NewAggregate()
+			for _, value := range []string{"2", "3", "4"} {
+				second.Add(NewEntry(Fields{"time": value}))
+			}
+			So(first.(Mergeable).Merge(second), ShouldBeNil)
+			So(first.Result().Fields(), ShouldResemble, Fields{"time": "2.50", "time_count": "4", "count": "4"})
+		})
+
+		Convey("Merge another aggregate", func() {
+			count := new(Count).NewAggregate().(Mergeable)
+			So(count.Merge(new(Sum).NewAggregate()), ShouldNotBeNil)
+		})
+
+		Convey("Check reducers are aggregators", func() {
+			result, ok := aggregators([]Reducer{new(Count), &Sum{}})
+			So(ok, ShouldBeTrue)
+			So(result, ShouldHaveLength, 2)
+			_, ok = aggregators([]Reducer{new(Count), new(ReadAll)})
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
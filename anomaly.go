@@ -0,0 +1,119 @@
+package gonx
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// How Anomaly reducer calculates the baseline.
+type AnomalyMethod int
+
+const (
+	// Mean and standard deviation of the window values.
+	AnomalyStddev AnomalyMethod = iota
+	// Median and median absolute deviation, it is robust to the outliers
+	// in the window, e.g. to the previous spikes.
+	AnomalyMAD
+)
+
+// Implements Reducer interface to detect the sudden spikes and drops of the
+// metric per time bucket, e.g. of the 5xx count per minute of GroupByTime:
+//
+//	NewPipeline(
+//		NewGroupByTime("time_local", time.Minute, new(Count)),
+//		&Anomaly{Field: "count", Window: 30, Threshold: 3},
+//	)
+//
+// The input entries are the buckets in the time order. Each bucket Field
+// value is compared with the baseline of the previous Window buckets, the
+// bucket is anomalous if the value deviates from it by more than Threshold
+// deviations. The anomalous buckets are written with the baseline
+// (<field>_baseline) and the deviations number (<field>_score) fields set,
+// all the buckets are written with the "anomaly" flag field if All is set.
+// Any change of the constant baseline is anomalous, its score is infinite.
+// Buckets before the Window is full and without a valid value are not
+// anomalous.
+type Anomaly struct {
+	Field string
+	// Number of the previous buckets of the baseline, 10 by default.
+	Window int
+	// Deviations number to flag the bucket, 3 by default.
+	Threshold float64
+	Method    AnomalyMethod
+	All       bool
+}
+
+// Compare the buckets with the rolling baseline and write the anomalous
+// ones. It sets the fields on the input entries.
+func (r *Anomaly) Reduce(input chan *Entry, output chan *Entry) {
+	window := r.Window
+	if window <= 0 {
+		window = 10
+	}
+	threshold := r.Threshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+	history := make([]float64, 0, window)
+	for entry := range input {
+		value, err := entry.FloatField(r.Field)
+		anomaly := false
+		if err == nil && len(history) == window {
+			baseline, deviation := r.baseline(history)
+			score := 0.0
+			if value != baseline {
+				score = (value - baseline) / deviation
+			}
+			if math.Abs(score) > threshold {
+				anomaly = true
+				entry.SetField(r.Field+"_baseline", formatValue(baseline))
+				entry.SetField(r.Field+"_score", strconv.FormatFloat(score, 'f', 2, 64))
+			}
+		}
+		if err == nil {
+			if len(history) == window {
+				history = append(history[:0], history[1:]...)
+			}
+			history = append(history, value)
+		}
+		if r.All {
+			entry.SetField("anomaly", strconv.FormatBool(anomaly))
+		}
+		if anomaly || r.All {
+			output <- entry
+		}
+	}
+	close(output)
+}
+
+// Returns the baseline and the deviation of the values.
+func (r *Anomaly) baseline(values []float64) (baseline, deviation float64) {
+	if r.Method == AnomalyMAD {
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		baseline = median(sorted)
+		for i, value := range values {
+			sorted[i] = math.Abs(value - baseline)
+		}
+		sort.Float64s(sorted)
+		// Scaled to be the standard deviation of the normal distribution
+		return baseline, 1.4826 * median(sorted)
+	}
+	for _, value := range values {
+		baseline += value
+	}
+	baseline /= float64(len(values))
+	for _, value := range values {
+		deviation += (value - baseline) * (value - baseline)
+	}
+	return baseline, math.Sqrt(deviation / float64(len(values)))
+}
+
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
@@ -0,0 +1,50 @@
+package gonx
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAnomaly(t *testing.T) {
+	Convey("Test anomaly detection", t, func() {
+		counts := []int{10, 12, 11, 9, 10, 50, 11, 10, 2, 10}
+		input := make(chan *Entry, len(counts)+1)
+		for i, count := range counts {
+			input <- NewEntry(Fields{"minute": strconv.Itoa(i), "count": strconv.Itoa(count)})
+		}
+		input <- NewEntry(Fields{"minute": "10", "count": "invalid"})
+		close(input)
+		output := make(chan *Entry, len(counts)+1)
+
+		Convey("Mean and standard deviation", func() {
+			(&Anomaly{Field: "count", Window: 4}).Reduce(input, output)
+			result := <-output
+			So(result.Fields(), ShouldResemble, Fields{
+				"minute":         "5",
+				"count":          "50",
+				"count_baseline": "10.5",
+				"count_score":    "35.33",
+			})
+			// The spike in the window hides the drop
+			_, ok := <-output
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Median absolute deviation", func() {
+			(&Anomaly{Field: "count", Window: 4, Method: AnomalyMAD}).Reduce(input, output)
+			var minutes []string
+			for result := range output {
+				minutes = append(minutes, result.Fields()["minute"])
+			}
+			So(minutes, ShouldResemble, []string{"5", "8"})
+		})
+
+		Convey("Write all buckets", func() {
+			(&Anomaly{Field: "count", Window: 4, All: true}).Reduce(input, output)
+			So(output, ShouldHaveLength, len(counts)+1)
+			So((<-output).Fields()["anomaly"], ShouldEqual, "false")
+		})
+	})
+}
@@ -0,0 +1,252 @@
+package gonx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Apache log format directives and the gonx field names they are stored
+// as. The names follow nginx variables where possible.
+var apacheFields = map[byte]string{
+	'a': "client_addr",
+	'A': "server_addr",
+	'B': "body_bytes_sent",
+	'b': "body_bytes_sent",
+	'D': "request_time_us",
+	'f': "request_filename",
+	'h': "remote_addr",
+	'H': "server_protocol",
+	'I': "request_length",
+	'k': "connection_requests",
+	'l': "remote_logname",
+	'L': "request_log_id",
+	'm': "request_method",
+	'O': "bytes_sent",
+	'p': "server_port",
+	'P': "pid",
+	'q': "query_string",
+	'r': "request",
+	'R': "handler",
+	's': "status",
+	'S': "bytes_transferred",
+	'T': "request_time",
+	'u': "remote_user",
+	'U': "uri",
+	'v': "server_name",
+	'V': "host",
+	'X': "connection_status",
+}
+
+// Prefixes of the field names for the directives with the {name} argument,
+// e.g. %{User-Agent}i is http_user_agent.
+var apacheNamedFields = map[byte]string{
+	'i': "http_",
+	'o': "sent_http_",
+	'C': "cookie_",
+	'e': "env_",
+	'n': "note_",
+	// Extension variables, e.g. %{SSL_PROTOCOL}x of mod_ssl is ssl_protocol
+	// and %{Varnish:hitmiss}x of varnishncsa is varnish_hitmiss
+	'x': "",
+}
+
+// Apache format directive: modifiers, optional {argument} and the letter.
+var apacheDirective = regexp.MustCompile(`^%!?[0-9,]*[<>]?(?:\{([^}]*)\})?(.)`)
+
+// ApacheFormat translates the Apache LogFormat string to the gonx format,
+// e.g. "%h %l %u %t \"%r\" %>s %b" becomes `$remote_addr $remote_logname
+// $remote_user [$time_local] "$request" $status $body_bytes_sent`. Note that
+// %t is logged in brackets, and %{format}t with the custom format is stored
+// as the time field.
+func ApacheFormat(logFormat string) (string, error) {
+	var format strings.Builder
+	for i := 0; i < len(logFormat); i++ {
+		if logFormat[i] != '%' {
+			format.WriteByte(logFormat[i])
+			continue
+		}
+		m := apacheDirective.FindStringSubmatch(logFormat[i:])
+		if m == nil {
+			return "", fmt.Errorf("invalid LogFormat directive at '%v'", logFormat[i:])
+		}
+		i += len(m[0]) - 1
+		arg, letter := m[1], m[2][0]
+		prefix, named := apacheNamedFields[letter]
+		switch {
+		case letter == '%':
+			format.WriteByte('%')
+		case letter == 't' && arg == "":
+			format.WriteString("[$time_local]")
+		case letter == 't':
+			format.WriteString("$time")
+		case named && arg != "":
+			format.WriteString("$" + prefix + apacheName(arg))
+		case apacheFields[letter] != "":
+			format.WriteString("$" + apacheFields[letter])
+		default:
+			return "", fmt.Errorf("unknown LogFormat directive '%v'", m[0])
+		}
+	}
+	return format.String(), nil
+}
+
+// Format variable names could contain only lowercase letters and "_",
+// other characters are replaced with "_".
+func apacheName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r < 'a' || r > 'z') && r != '_' {
+			return '_'
+		}
+		return r
+	}, nginxName(name))
+}
+
+// ApacheParsersFromConfig reads Apache httpd config file and returns parsers
+// for all the LogFormat directives with the nickname, by the nickname. The
+// Include and IncludeOptional directives are followed, relative paths are
+// resolved against the ServerRoot, or the config file directory if it is
+// not set.
+func ApacheParsersFromConfig(path string) (map[string]*Parser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	config := newApacheConfig(filepath.Dir(path))
+	config.visited[absPath(path)] = true
+	if err := config.read(file); err != nil {
+		return nil, err
+	}
+	return config.parsers, nil
+}
+
+// NewApacheParser reads Apache httpd config to find LogFormat with given
+// nickname and returns parser for this format. It returns an error if
+// cannot find the needle. Includes are resolved the same way NewNginxParser
+// does.
+func NewApacheParser(conf io.Reader, nickname string) (parser *Parser, err error) {
+	config := newApacheConfig(".")
+	if file, ok := conf.(*os.File); ok {
+		config.dir = filepath.Dir(file.Name())
+		config.visited[absPath(file.Name())] = true
+	}
+	if err = config.read(conf); err != nil {
+		return
+	}
+	parser, ok := config.parsers[nickname]
+	if !ok {
+		err = fmt.Errorf("`LogFormat %v` not found in given config", nickname)
+	}
+	return
+}
+
+// Apache config reader collects log formats from the config files.
+type apacheConfig struct {
+	// Directory to resolve relative include paths
+	dir     string
+	visited map[string]bool
+	parsers map[string]*Parser
+}
+
+func newApacheConfig(dir string) *apacheConfig {
+	return &apacheConfig{
+		dir:     dir,
+		visited: make(map[string]bool),
+		parsers: make(map[string]*Parser),
+	}
+}
+
+// Read config directives line by line and handle LogFormat, Include and
+// ServerRoot ones, all the others are skipped.
+func (c *apacheConfig) read(conf io.Reader) error {
+	scanner := bufio.NewScanner(conf)
+	var line string
+	for scanner.Scan() {
+		line += strings.TrimSpace(scanner.Text())
+		// Backslash at the end of line continues the directive
+		if strings.HasSuffix(line, "\\") {
+			line = line[:len(line)-1]
+			continue
+		}
+		args, err := apacheArgs(line)
+		line = ""
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") || strings.HasPrefix(args[0], "<") {
+			continue
+		}
+		if err := c.handle(args); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (c *apacheConfig) handle(args []string) error {
+	switch strings.ToLower(args[0]) {
+	case "logformat":
+		// LogFormat without the nickname sets the default format
+		if len(args) != 3 {
+			return nil
+		}
+		format, err := ApacheFormat(args[1])
+		if err != nil {
+			return err
+		}
+		c.parsers[args[2]] = NewParser(format)
+	case "serverroot":
+		if len(args) == 2 {
+			c.dir = args[1]
+		}
+	case "include", "includeoptional":
+		if len(args) != 2 {
+			return fmt.Errorf("invalid number of arguments in \"%v\" directive", args[0])
+		}
+		return c.include(args[1])
+	}
+	return nil
+}
+
+func (c *apacheConfig) include(pattern string) error {
+	return includeFiles(c.dir, pattern, c.visited, c.read)
+}
+
+// Split directive line into arguments, double quoted arguments could
+// contain spaces and backslash escaped quotes.
+func apacheArgs(line string) (args []string, err error) {
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t':
+			continue
+		case c == '"':
+			var arg strings.Builder
+			closed := false
+			for i++; i < len(line); i++ {
+				if line[i] == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\') {
+					i++
+				} else if line[i] == '"' {
+					closed = true
+					break
+				}
+				arg.WriteByte(line[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quoted argument in '%v'", line)
+			}
+			args = append(args, arg.String())
+		default:
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			args = append(args, line[start:i])
+		}
+	}
+	return
+}
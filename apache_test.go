@@ -0,0 +1,78 @@
+package gonx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApacheConfig(t *testing.T) {
+	Convey("Test Apache config parsing", t, func() {
+		Convey("Translate LogFormat", func() {
+			format, err := ApacheFormat(`%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`)
+			So(err, ShouldBeNil)
+			So(format, ShouldEqual, `$remote_addr $remote_logname $remote_user [$time_local] "$request" `+
+				`$status $body_bytes_sent "$http_referer" "$http_user_agent"`)
+
+			format, err = ApacheFormat(`%{%Y-%m-%d}t %400,501{X-B3-TraceId}i %D 100%%`)
+			So(err, ShouldBeNil)
+			So(format, ShouldEqual, `$time $http_x_b__traceid $request_time_us 100%`)
+
+			_, err = ApacheFormat(`%h %J`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Parse log line", func() {
+			parser, err := NewApacheParser(strings.NewReader(
+				`LogFormat "%h %l %u %t \"%r\" %>s %b" common`), "common")
+			So(err, ShouldBeNil)
+			entry, err := parser.ParseString(`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"remote_addr":     "127.0.0.1",
+				"remote_logname":  "-",
+				"remote_user":     "frank",
+				"time_local":      "10/Oct/2000:13:55:36 -0700",
+				"request":         "GET /apache_pb.gif HTTP/1.0",
+				"status":          "200",
+				"body_bytes_sent": "2326",
+			}))
+		})
+
+		Convey("Find all log formats", func() {
+			dir := t.TempDir()
+			write := func(name, content string) string {
+				path := filepath.Join(dir, name)
+				So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+				So(os.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+				return path
+			}
+			conf := write("httpd.conf", strings.Join([]string{
+				`# LogFormat "%h" commented`,
+				`<IfModule log_config_module>`,
+				`    LogFormat "%h %l %u %t \"%r\" %>s %b \"%{Referer}i\" \`,
+				`              \"%{User-Agent}i\"" combined`,
+				`    LogFormat "%h %b"`,
+				`    CustomLog "logs/access_log" combined`,
+				`</IfModule>`,
+				`IncludeOptional conf.d/*.conf`,
+			}, "\n"))
+			write("conf.d/vhost.conf", "LogFormat \"%v %h\" vhost\nInclude httpd.conf\n")
+
+			parsers, err := ApacheParsersFromConfig(conf)
+			So(err, ShouldBeNil)
+			So(len(parsers), ShouldEqual, 2)
+			So(parsers["combined"].format, ShouldEqual, `$remote_addr $remote_logname $remote_user [$time_local] `+
+				`"$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`)
+			So(parsers["vhost"].format, ShouldEqual, "$server_name $remote_addr")
+
+			_, err = NewApacheParser(strings.NewReader(`LogFormat "%h" a`), "b")
+			So(err, ShouldNotBeNil)
+			_, err = NewApacheParser(strings.NewReader(`LogFormat "%h a`), "a")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,155 @@
+package gonx
+
+import (
+	"encoding"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	durationType    = reflect.TypeOf(time.Duration(0))
+	ipType          = reflect.TypeOf(net.IP{})
+	textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Decode populates the struct pointed to by v with the Entry fields. The
+// field name is taken from the `gonx` struct tag, or the struct field name
+// converted to snake case (RemoteAddr is remote_addr), "-" skips the field.
+// Time fields are parsed with the layout from the `layout` tag, or as
+// DefaultTimeField does if it is not set, e.g.
+//
+//	type Request struct {
+//		RemoteAddr net.IP
+//		Time       time.Time     `gonx:"time_local"`
+//		Duration   time.Duration `gonx:"request_time"`
+//		Bytes      uint64        `gonx:"body_bytes_sent"`
+//		Date       time.Time     `gonx:"date" layout:"2006-01-02"`
+//	}
+//
+// Supported field types are strings, bools, numbers, time.Time,
+// time.Duration, net.IP and encoding.TextUnmarshaler implementations.
+// Missing fields are left untouched, conversion errors are returned.
+func (entry *Entry) Decode(v interface{}) error {
+	value := reflect.ValueOf(v)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode entry into %T, struct pointer expected", v)
+	}
+	return entry.decodeStruct(value.Elem())
+}
+
+func (entry *Entry) decodeStruct(value reflect.Value) error {
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, tagged := field.Tag.Lookup("gonx")
+		if field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct {
+			if err := entry.decodeStruct(value.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.PkgPath != "" || tag == "-" {
+			continue
+		}
+		name := tag
+		if name == "" {
+			name = snakeCase(field.Name)
+		}
+		if _, ok := entry.fields[name]; !ok {
+			continue
+		}
+		if err := entry.decodeField(name, field.Tag.Get("layout"), value.Field(i)); err != nil {
+			return fmt.Errorf("cannot decode field '%v' into %v: %v", name, field.Name, err)
+		}
+	}
+	return nil
+}
+
+func (entry *Entry) decodeField(name string, layout string, value reflect.Value) error {
+	switch value.Type() {
+	case timeType:
+		var t time.Time
+		var err error
+		if layout != "" {
+			t, err = entry.TimeField(name, layout)
+		} else {
+			t, err = entry.DefaultTimeField(name)
+		}
+		if err == nil {
+			value.Set(reflect.ValueOf(t))
+		}
+		return err
+	case durationType:
+		d, err := entry.DurationField(name)
+		if err == nil {
+			value.SetInt(int64(d))
+		}
+		return err
+	case ipType:
+		ip, err := entry.IPField(name)
+		if err == nil {
+			value.Set(reflect.ValueOf(ip))
+		}
+		return err
+	}
+	if value.Addr().Type().Implements(textUnmarshaler) {
+		return value.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(entry.fields[name]))
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(entry.fields[name])
+	case reflect.Bool:
+		b, err := entry.BoolField(name)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := entry.IntField(name)
+		if err != nil {
+			return err
+		}
+		if value.OverflowInt(n) {
+			return fmt.Errorf("value %v overflows %v", n, value.Type())
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := entry.UintField(name)
+		if err != nil {
+			return err
+		}
+		if value.OverflowUint(n) {
+			return fmt.Errorf("value %v overflows %v", n, value.Type())
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := entry.FloatField(name)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v", value.Type())
+	}
+	return nil
+}
+
+// Convert Go name to the snake case field name, e.g. RemoteAddr is
+// remote_addr and HTTPReferer is http_referer.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var result strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			result.WriteByte('_')
+		}
+		result.WriteRune(unicode.ToLower(r))
+	}
+	return result.String()
+}
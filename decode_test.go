@@ -0,0 +1,89 @@
+package gonx
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type decodedUser struct {
+	RemoteUser string
+}
+
+type decodedRequest struct {
+	decodedUser
+	RemoteAddr  net.IP
+	HTTPReferer string
+	Time        time.Time     `gonx:"time_local"`
+	Date        time.Time     `gonx:"date" layout:"2006-01-02"`
+	Duration    time.Duration `gonx:"request_time"`
+	Status      int16
+	Bytes       uint64  `gonx:"body_bytes_sent"`
+	Ratio       float64 `gonx:"gzip_ratio"`
+	HTTPS       bool    `gonx:"https"`
+	Skipped     string  `gonx:"-"`
+	Missing     string
+	private     string
+}
+
+func TestDecode(t *testing.T) {
+	Convey("Test Entry decoding", t, func() {
+		entry := NewEntry(Fields{
+			"remote_user":     "john",
+			"remote_addr":     "89.234.89.123",
+			"http_referer":    "http://example.com/",
+			"time_local":      "08/Nov/2013:13:39:18 +0300",
+			"date":            "2013-11-08",
+			"request_time":    "0.050",
+			"status":          "200",
+			"body_bytes_sent": "1024",
+			"gzip_ratio":      "2.50",
+			"https":           "on",
+			"skipped":         "value",
+			"private":         "value",
+		})
+
+		Convey("Decode into struct", func() {
+			request := decodedRequest{Missing: "default"}
+			So(entry.Decode(&request), ShouldBeNil)
+			So(request.Time.Unix(), ShouldEqual, 1383907158)
+			request.Time = time.Time{}
+			So(request, ShouldResemble, decodedRequest{
+				decodedUser: decodedUser{RemoteUser: "john"},
+				RemoteAddr:  net.IPv4(89, 234, 89, 123).To4(),
+				HTTPReferer: "http://example.com/",
+				Date:        time.Date(2013, time.November, 8, 0, 0, 0, 0, time.UTC),
+				Duration:    50 * time.Millisecond,
+				Status:      200,
+				Bytes:       1024,
+				Ratio:       2.5,
+				HTTPS:       true,
+				Missing:     "default",
+			})
+		})
+
+		Convey("Return conversion errors", func() {
+			var request decodedRequest
+			entry.SetField("status", "OK")
+			So(entry.Decode(&request), ShouldNotBeNil)
+
+			entry.SetField("status", "100000")
+			So(entry.Decode(&request), ShouldNotBeNil)
+		})
+
+		Convey("Decode into non-struct", func() {
+			var request decodedRequest
+			So(entry.Decode(request), ShouldNotBeNil)
+			var s string
+			So(entry.Decode(&s), ShouldNotBeNil)
+		})
+
+		Convey("Convert names to snake case", func() {
+			So(snakeCase("RemoteAddr"), ShouldEqual, "remote_addr")
+			So(snakeCase("HTTPReferer"), ShouldEqual, "http_referer")
+			So(snakeCase("Status"), ShouldEqual, "status")
+		})
+	})
+}
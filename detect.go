@@ -0,0 +1,68 @@
+package gonx
+
+import (
+	"fmt"
+)
+
+// DetectFormats is the list of registered parser names DetectFormat tries,
+// in the order of preference. Add site-specific formats here after they are
+// registered.
+var DetectFormats = []string{
+	"combined", "common", "traefik", "alb", "squid", "ltsv", "json", "caddy", "traefik_json",
+}
+
+// Well-known field names, JSON parsers are ranked by the number of them
+// found in the parsed entries.
+var detectFields = []string{
+	"remote_addr", "remote_user", "time_local", "time_iso8601", "msec", "request",
+	"request_method", "request_uri", "server_protocol", "host", "status",
+	"body_bytes_sent", "bytes_sent", "request_time", "http_referer", "http_user_agent",
+}
+
+// DetectFormat tries the DetectFormats parsers against the sample lines and
+// returns the name and a new instance of the best matching one. The parser
+// that parses most of the lines wins, ties (e.g. JSON presets) are broken
+// by the number of well-known nginx field names in the entries and then by
+// the DetectFormats order. Empty lines are ignored. An error is returned if
+// none of the parsers matched any line.
+func DetectFormat(sample []string) (name string, parser StringParser, err error) {
+	var bestLines, bestFields int
+	for _, candidate := range DetectFormats {
+		p, err := ParserByName(candidate)
+		if err != nil {
+			return "", nil, err
+		}
+		lines, fields := detectScore(p, sample)
+		if lines == 0 {
+			continue
+		}
+		if lines > bestLines || (lines == bestLines && fields > bestFields) {
+			name, parser = candidate, p
+			bestLines, bestFields = lines, fields
+		}
+	}
+	if parser == nil {
+		err = fmt.Errorf("unable to detect log format")
+	}
+	return
+}
+
+// Count parsed lines and well-known fields found
+func detectScore(parser StringParser, sample []string) (lines int, fields int) {
+	for _, line := range sample {
+		if line == "" {
+			continue
+		}
+		entry, err := parser.ParseString(line)
+		if err != nil {
+			continue
+		}
+		lines++
+		for _, name := range detectFields {
+			if _, err := entry.Field(name); err == nil {
+				fields++
+			}
+		}
+	}
+	return
+}
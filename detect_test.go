@@ -0,0 +1,72 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDetectFormat(t *testing.T) {
+	Convey("Test log format detection", t, func() {
+		Convey("Detect nginx combined", func() {
+			sample := []string{
+				`89.234.89.123 - - [08/Nov/2013:13:39:18 +0000] "GET /api/foo/bar HTTP/1.1" 200 612 "-" "curl/7.68.0"`,
+				"",
+				`89.234.89.124 - - [08/Nov/2013:13:39:19 +0000] "GET / HTTP/1.1" 404 0 "-" "curl/7.68.0"`,
+			}
+			name, parser, err := DetectFormat(sample)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "combined")
+			entry, err := parser.ParseString(sample[0])
+			So(err, ShouldBeNil)
+			status, _ := entry.Field("status")
+			So(status, ShouldEqual, "200")
+		})
+
+		Convey("Detect the format most of the lines match", func() {
+			sample := []string{
+				`89.234.89.123 - - [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 612`,
+				`89.234.89.123 - - [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 612`,
+				`89.234.89.123 - - [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/7.68.0"`,
+			}
+			name, _, err := DetectFormat(sample)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "common")
+		})
+
+		Convey("Detect JSON presets", func() {
+			name, _, err := DetectFormat([]string{
+				`{"ts":1646861401.5241024,"request":{"remote_ip":"127.0.0.1","method":"GET","uri":"/"},"status":200}`,
+			})
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "caddy")
+
+			name, _, err = DetectFormat([]string{`{"remote_addr":"127.0.0.1","status":200}`})
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "json")
+		})
+
+		Convey("Detect LTSV", func() {
+			name, _, err := DetectFormat([]string{"host:127.0.0.1\treq:GET / HTTP/1.1\tstatus:200"})
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "ltsv")
+		})
+
+		Convey("Detect AWS ALB", func() {
+			name, _, err := DetectFormat([]string{
+				`http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 ` +
+					`10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" ` +
+					`"curl/7.46.0" - - arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 ` +
+					`"Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" ` +
+					`"10.0.0.1:80" "200" "-" "-"`,
+			})
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "alb")
+		})
+
+		Convey("Unknown format", func() {
+			_, _, err := DetectFormat([]string{"foo bar", ""})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
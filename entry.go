@@ -2,34 +2,125 @@ package gonx
 
 import (
 	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// Layouts of the nginx $time_local and $time_iso8601 variables.
+const (
+	TimeLocalLayout   = "02/Jan/2006:15:04:05 -0700"
+	TimeISO8601Layout = "2006-01-02T15:04:05-07:00"
+)
+
+// Time fields layouts by the nginx variable name. Use it as the
+// Parser.TimeLayouts to get typed times for nginx formats.
+var NginxTimeLayouts = map[string]string{
+	"time_local":   TimeLocalLayout,
+	"time_iso8601": TimeISO8601Layout,
+}
+
 // Shortcut for the map of strings
 type Fields map[string]string
 
 // Parsed log record. Use Get method to retrieve a value by name instead of
 // threating this as a map, because inner representation is in design.
+//
+// Values are stored as strings, the numeric values are converted lazily by
+// the typed getters and cached, so the reducers reading the same field
+// (e.g. Sum and Avg in the Chain) parse it once. Use the setters to change
+// the values, they reset the cached ones.
 type Entry struct {
 	fields Fields
+	// Typed time fields, nil until SetTimeField is called
+	times map[string]time.Time
+	// Default time layout, see SetTimeLayout
+	layout string
+	// Converted numeric values by the field name
+	cache *valueCache
+	// Original log line, see RawParser
+	raw string
+}
+
+// Cache of the converted values. Entries are shared by the Chain reducers,
+// which read them concurrently, so the access is synchronized.
+type valueCache struct {
+	sync.Mutex
+	values map[string]interface{}
+}
+
+// Return the cached value or nil, the cache could be nil for the Entry
+// literals.
+func (c *valueCache) get(name string) (value interface{}) {
+	if c != nil {
+		c.Lock()
+		value = c.values[name]
+		c.Unlock()
+	}
+	return
+}
+
+func (c *valueCache) set(name string, value interface{}) {
+	if c != nil {
+		c.Lock()
+		if c.values == nil {
+			c.values = make(map[string]interface{})
+		}
+		c.values[name] = value
+		c.Unlock()
+	}
+}
+
+func (c *valueCache) reset(name string) {
+	if c != nil {
+		c.Lock()
+		delete(c.values, name)
+		c.Unlock()
+	}
+}
+
+// Reset the cached values of the fields, or all of them if fields is nil.
+func (c *valueCache) resetFields(fields Fields) {
+	if c != nil {
+		c.Lock()
+		if fields == nil {
+			c.values = nil
+		}
+		for name := range fields {
+			delete(c.values, name)
+		}
+		c.Unlock()
+	}
 }
 
 // Creates an empty Entry to be filled later
 func NewEmptyEntry() *Entry {
-	return &Entry{make(Fields)}
+	return &Entry{fields: make(Fields), cache: new(valueCache)}
 }
 
 // Creates an Entry with fiven fields
 func NewEntry(fields Fields) *Entry {
-	return &Entry{fields}
+	return &Entry{fields: fields, cache: new(valueCache)}
 }
 
-// Return all entry fields.
+// Return all entry fields. Use SetField to change them, the map changes
+// are not seen by the typed getters which already converted the value.
 func (entry *Entry) Fields() Fields {
 	return entry.fields
 }
 
+// Return the original log line the entry was parsed from. It is empty
+// unless the entry was parsed with RawParser, e.g. by the Reader with
+// KeepRaw option. Field changes do not affect it.
+func (entry *Entry) Raw() string {
+	return entry.raw
+}
+
 // Return entry field value by name or empty string and error if it
 // does not exist.
 func (entry *Entry) Field(name string) (value string, err error) {
@@ -40,19 +131,327 @@ func (entry *Entry) Field(name string) (value string, err error) {
 	return
 }
 
-// Return entry field value as float64. Return nil if field does not exist
-// and conversion error if cannot cast a type.
+// Return entry field value as float64. Return an error if field does not
+// exist and conversion error if cannot cast a type. Empty values and "-"
+// placeholders are missing values, an error is returned too, so the
+// reducers (e.g. Avg or Percentile) skip them instead of counting 0. The
+// other numeric getters treat them the same way.
 func (entry *Entry) FloatField(name string) (value float64, err error) {
-	tmp, err := entry.Field(name)
+	if cached, ok := entry.cache.get(name).(float64); ok {
+		return cached, nil
+	}
+	tmp, err := entry.numericField(name)
 	if err == nil {
 		value, err = strconv.ParseFloat(tmp, 64)
 	}
+	if err == nil {
+		entry.cache.set(name, value)
+	}
+	return
+}
+
+// Return entry field value for the numeric getters, it returns an error for
+// the empty values and "-" placeholders as for the missing fields.
+func (entry *Entry) numericField(name string) (value string, err error) {
+	value, err = entry.Field(name)
+	if err == nil && isEmptyValue(value) {
+		err = fmt.Errorf("field '%v' value is empty in record %+v", name, *entry)
+	}
+	return
+}
+
+// Return entry field value or def if the field does not exist.
+func (entry *Entry) FieldOrDefault(name string, def string) string {
+	if value, ok := entry.fields[name]; ok {
+		return value
+	}
+	return def
+}
+
+// Return entry field value as float64 or def if the field does not exist or
+// cannot be converted.
+func (entry *Entry) FloatFieldOrDefault(name string, def float64) float64 {
+	value, err := entry.FloatField(name)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// Return entry field value, it panics if the field does not exist. Use it
+// for the fields known to exist in the format.
+func (entry *Entry) MustField(name string) string {
+	value, err := entry.Field(name)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// Return entry field value as float64, it panics if the field does not
+// exist or cannot be converted.
+func (entry *Entry) MustFloatField(name string) float64 {
+	value, err := entry.FloatField(name)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// Return entry field value as int64. Return an error if field does not
+// exist or cannot be converted. Empty values and "-" placeholders are
+// missing, see FloatField.
+func (entry *Entry) IntField(name string) (value int64, err error) {
+	if cached, ok := entry.cache.get(name).(int64); ok {
+		return cached, nil
+	}
+	tmp, err := entry.numericField(name)
+	if err == nil {
+		value, err = strconv.ParseInt(tmp, 10, 64)
+	}
+	if err == nil {
+		entry.cache.set(name, value)
+	}
+	return
+}
+
+// Return entry field value as uint64, e.g. for the bytes counters. Empty
+// values and "-" placeholders are missing, see FloatField.
+func (entry *Entry) UintField(name string) (value uint64, err error) {
+	if cached, ok := entry.cache.get(name).(uint64); ok {
+		return cached, nil
+	}
+	tmp, err := entry.numericField(name)
+	if err == nil {
+		value, err = strconv.ParseUint(tmp, 10, 64)
+	}
+	if err == nil {
+		entry.cache.set(name, value)
+	}
+	return
+}
+
+// Return entry field value as time.Duration. Values are in seconds with
+// the milliseconds resolution as nginx $request_time ("0.005"), the values
+// with units ("5ms") are accepted too. Empty values and "-" placeholders are
+// missing, see FloatField.
+func (entry *Entry) DurationField(name string) (value time.Duration, err error) {
+	tmp, err := entry.numericField(name)
+	if err != nil {
+		return
+	}
+	if last := tmp[len(tmp)-1]; last >= '0' && last <= '9' || last == '.' {
+		tmp += "s"
+	}
+	return time.ParseDuration(tmp)
+}
+
+// Return entry field value as bool. It understands nginx flags, e.g. $https
+// is "on" or empty and $pipe is "p" or ".", and the usual true/false, 1/0,
+// yes/no and on/off values in any case. Empty values and "-" placeholders
+// are false, other values are the conversion error.
+func (entry *Entry) BoolField(name string) (value bool, err error) {
+	tmp, err := entry.Field(name)
+	if err != nil {
+		return
+	}
+	switch strings.ToLower(tmp) {
+	case "1", "t", "true", "y", "yes", "on", "p":
+		value = true
+	case "", "-", "0", "f", "false", "n", "no", "off", ".":
+		value = false
+	default:
+		err = fmt.Errorf("field '%v' value '%v' is not a bool", name, tmp)
+	}
+	return
+}
+
+// Return entry field value as net.IP, IPv4 addresses are 4 bytes long. The
+// X-Forwarded-For list ("client, proxy1, proxy2") gives the first hop, the
+// client address, and the port is stripped ("192.0.2.1:8080" or
+// "[2001:db8::1]:443"). It returns an error if the value is not an address.
+func (entry *Entry) IPField(name string) (value net.IP, err error) {
+	tmp, err := entry.Field(name)
+	if err != nil {
+		return
+	}
+	if i := strings.IndexByte(tmp, ','); i >= 0 {
+		tmp = tmp[:i]
+	}
+	tmp = strings.TrimSpace(tmp)
+	value = net.ParseIP(tmp)
+	if value == nil {
+		if host, _, splitErr := net.SplitHostPort(tmp); splitErr == nil {
+			value = net.ParseIP(host)
+		}
+	}
+	if value == nil {
+		err = fmt.Errorf("field '%v' value '%v' is not an IP address", name, tmp)
+		return
+	}
+	if ip4 := value.To4(); ip4 != nil {
+		value = ip4
+	}
+	return
+}
+
+// Return the multi-value field values, e.g. $upstream_addr or
+// $upstream_response_time when the request hit several upstream servers.
+// Nginx separates the servers with ", " and the internal redirects to other
+// upstream groups with " : ", the values are returned in order.
+func (entry *Entry) Values(name string) (values []string, err error) {
+	value, err := entry.Field(name)
+	if err != nil {
+		return
+	}
+	for _, group := range strings.Split(value, " : ") {
+		values = append(values, strings.Split(group, ", ")...)
+	}
 	return
 }
 
+// Return the multi-value field values as float64, see Values. Empty values
+// and "-" placeholders are missing, an error is returned if any value is.
+func (entry *Entry) FloatValues(name string) (values []float64, err error) {
+	strs, err := entry.Values(name)
+	if err != nil {
+		return
+	}
+	values = make([]float64, len(strs))
+	for i, str := range strs {
+		if isEmptyValue(str) {
+			return nil, fmt.Errorf("field '%v' value %d is empty in record %+v", name, i, *entry)
+		}
+		if values[i], err = strconv.ParseFloat(str, 64); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Check the value is empty or the "-" placeholder nginx writes for the
+// empty values.
+func isEmptyValue(value string) bool {
+	return value == "" || value == "-"
+}
+
+// Return entry field value as time.Time parsed with the layout. The typed
+// value set by SetTimeField (e.g. by the Parser with TimeLayouts) is
+// returned as it is.
+func (entry *Entry) TimeField(name string, layout string) (value time.Time, err error) {
+	if t, ok := entry.times[name]; ok {
+		return t, nil
+	}
+	raw, err := entry.Field(name)
+	if err != nil {
+		return
+	}
+	return time.Parse(layout, raw)
+}
+
+// Return entry field value as time.Time parsed with the Entry default
+// layout (see SetTimeLayout), or the NginxTimeLayouts layout for the field
+// name if the default is not set.
+func (entry *Entry) DefaultTimeField(name string) (value time.Time, err error) {
+	if t, ok := entry.times[name]; ok {
+		return t, nil
+	}
+	layout := entry.layout
+	if layout == "" {
+		layout = NginxTimeLayouts[name]
+	}
+	if layout == "" {
+		err = fmt.Errorf("field '%v' time layout is unknown", name)
+		return
+	}
+	return entry.TimeField(name, layout)
+}
+
+// Return entry field value as time.Time parsed with the layout, or with the
+// default one (see DefaultTimeField) if the layout is empty.
+func (entry *Entry) timeField(name string, layout string) (time.Time, error) {
+	if layout == "" {
+		return entry.DefaultTimeField(name)
+	}
+	return entry.TimeField(name, layout)
+}
+
+// Set the default layout of the time fields for DefaultTimeField.
+func (entry *Entry) SetTimeLayout(layout string) {
+	entry.layout = layout
+}
+
 // Field value setter
 func (entry *Entry) SetField(name string, value string) {
 	entry.fields[name] = value
+	delete(entry.times, name)
+	entry.cache.reset(name)
+}
+
+// Replace all the entry fields with the given ones. The map is copied, so
+// it could be reused by the caller.
+func (entry *Entry) SetFields(fields Fields) {
+	entry.fields = make(Fields, len(fields))
+	for name, value := range fields {
+		entry.fields[name] = value
+	}
+	entry.times = nil
+	entry.cache.resetFields(nil)
+}
+
+// Set several fields at once, e.g. the fields derived by a mapper. Other
+// entry fields are kept.
+func (entry *Entry) MergeFields(fields Fields) {
+	for name, value := range fields {
+		entry.fields[name] = value
+		delete(entry.times, name)
+	}
+	entry.cache.resetFields(fields)
+}
+
+// Delete the field, e.g. to drop sensitive values before the entry is
+// written. Missing fields are ignored.
+func (entry *Entry) Delete(name string) {
+	delete(entry.fields, name)
+	delete(entry.times, name)
+	entry.cache.reset(name)
+}
+
+// Rename the field, the value of the field with the new name is replaced.
+// Missing fields are ignored.
+func (entry *Entry) Rename(old string, name string) {
+	value, ok := entry.fields[old]
+	if !ok || old == name {
+		return
+	}
+	t, typed := entry.times[old]
+	entry.Delete(old)
+	entry.SetField(name, value)
+	if typed {
+		entry.setTime(name, t)
+	}
+}
+
+// Time field value setter. The value is stored as typed time for
+// TimeField, and as the string formatted with the layout.
+func (entry *Entry) SetTimeField(name string, value time.Time, layout string) {
+	entry.SetField(name, value.Format(layout))
+	entry.setTime(name, value)
+}
+
+// Duration field value setter. The value is stored in seconds with the
+// milliseconds resolution as nginx $request_time, e.g. "0.005", so it could
+// be read back with DurationField or FloatField.
+func (entry *Entry) SetDurationField(name string, value time.Duration) {
+	entry.SetField(name, strconv.FormatFloat(value.Seconds(), 'f', 3, 64))
+}
+
+// Store the typed time for the field, its string value is kept as it is.
+func (entry *Entry) setTime(name string, value time.Time) {
+	if entry.times == nil {
+		entry.times = make(map[string]time.Time)
+	}
+	entry.times[name] = value
 }
 
 // Float field value setter. It accepts float64, but still store it as a
@@ -68,23 +467,142 @@ func (entry *Entry) SetUintField(name string, value uint64) {
 	entry.SetField(name, strconv.FormatUint(uint64(value), 10))
 }
 
+// Signed integer field value setter, it stores the value as a string too.
+func (entry *Entry) SetIntField(name string, value int64) {
+	entry.SetField(name, strconv.FormatInt(value, 10))
+}
+
+// Equal reports whether the entries have the same fields and values.
+func (entry *Entry) Equal(other *Entry) bool {
+	if len(entry.fields) != len(other.fields) {
+		return false
+	}
+	for name, value := range entry.fields {
+		if otherValue, ok := other.fields[name]; !ok || otherValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff returns the sorted names of the fields which values differ between
+// the entries, including the fields missing in one of them.
+func (entry *Entry) Diff(other *Entry) []string {
+	var names []string
+	for name, value := range entry.fields {
+		if otherValue, ok := other.fields[name]; !ok || otherValue != value {
+			names = append(names, name)
+		}
+	}
+	for name := range other.fields {
+		if _, ok := entry.fields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Copy returns an independent copy of the entry, e.g. to change the entry
+// in a filter without affecting the other reducers that got it.
+func (entry *Entry) Copy() *Entry {
+	copied := NewEmptyEntry()
+	copied.Merge(entry)
+	copied.layout = entry.layout
+	copied.raw = entry.raw
+	return copied
+}
+
 // Merge two entries by updating values for master entry with given.
 func (master *Entry) Merge(entry *Entry) {
 	for name, value := range entry.fields {
 		master.SetField(name, value)
 	}
+	for name, value := range entry.times {
+		master.setTime(name, value)
+	}
 }
 
+// Return the entry field names in the sorted order, so the fields could be
+// iterated deterministically. The insertion order is not kept, the fields
+// are stored in a map; use Parser.Fields with ToSlice to get the values in
+// the format order.
+func (entry *Entry) Names() []string {
+	names := make([]string, 0, len(entry.fields))
+	for name := range entry.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Return the given fields values in the fields order, e.g. for columnar
+// writers. Missing fields are empty strings. Use Parser.Fields to get the
+// values in the format order.
+func (entry *Entry) ToSlice(fields []string) []string {
+	values := make([]string, len(fields))
+	for i, name := range fields {
+		values[i] = entry.fields[name]
+	}
+	return values
+}
+
+// Call fn for each entry field in the sorted names order (see Names), e.g.
+// to write the entries without knowing the fields ahead of time.
+func (entry *Entry) Each(fn func(name string, value string)) {
+	for _, name := range entry.Names() {
+		fn(name, entry.fields[name])
+	}
+}
+
+// Return the key of all the entry fields, it is the FieldsHash of the sorted
+// field names. Entries with the same fields and values have the same key.
+func (entry *Entry) Hash() string {
+	return entry.FieldsHash(entry.Names())
+}
+
+// Escaping of the FieldsHash names and values, so the separators could not
+// be a part of them.
+var (
+	hashNameEscaper  = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+	hashValueEscaper = strings.NewReplacer(`\`, `\\`, `;`, `\;`)
+)
+
+// Return the key of the given fields values in the fields order, e.g.
+// 'host'=example.com;'status'=200. Names and values are escaped, so the
+// different values always have the different keys, and missing fields have
+// no value ('host' is not the same as 'host'=).
 func (entry *Entry) FieldsHash(fields []string) string {
-	var key []string
+	var key strings.Builder
+	for i, name := range fields {
+		if i > 0 {
+			key.WriteByte(';')
+		}
+		key.WriteString("'" + hashNameEscaper.Replace(name) + "'")
+		if value, ok := entry.fields[name]; ok {
+			key.WriteString("=" + hashValueEscaper.Replace(value))
+		}
+	}
+	return key.String()
+}
+
+// Check the entry has all the given fields.
+func (entry *Entry) hasFields(fields []string) bool {
 	for _, name := range fields {
-		value, err := entry.Field(name)
-		if err != nil {
-			value = "NULL"
+		if _, ok := entry.fields[name]; !ok {
+			return false
 		}
-		key = append(key, fmt.Sprintf("'%v'=%v", name, value))
 	}
-	return strings.Join(key, ";")
+	return true
+}
+
+// Return the opaque fixed size key of the given fields values, it is the
+// FieldsHash digest. It takes less memory than FieldsHash for the long
+// values, e.g. to group by the user agent or the request URI.
+func (entry *Entry) FieldsDigest(fields []string) string {
+	digest := fnv.New128a()
+	io.WriteString(digest, entry.FieldsHash(fields))
+	return string(digest.Sum(nil))
 }
 
 func (entry *Entry) Partial(fields []string) *Entry {
@@ -2,13 +2,15 @@ package gonx
 
 import (
 	. "github.com/smartystreets/goconvey/convey"
+	"net"
 	"testing"
+	"time"
 )
 
 func TestEntry(t *testing.T) {
 	Convey("Test Entry", t, func() {
 		Convey("Test get Entry fields", func() {
-			entry := NewEntry(Fields{"foo": "1", "bar": "not a number"})
+			entry := NewEntry(Fields{"foo": "1", "bar": "not a number", "dash": "-", "empty": ""})
 
 			Convey("Get raw string value", func() {
 				// Get existings field
@@ -37,6 +39,43 @@ func TestEntry(t *testing.T) {
 				val, err = entry.FloatField("baz")
 				So(err, ShouldNotBeNil)
 				So(val, ShouldEqual, 0.0)
+
+				// Empty values are missing
+				val, err = entry.FloatField("dash")
+				So(err, ShouldNotBeNil)
+				So(val, ShouldEqual, 0.0)
+				val, err = entry.FloatField("empty")
+				So(err, ShouldNotBeNil)
+				So(val, ShouldEqual, 0.0)
+			})
+
+			Convey("Get integer values", func() {
+				entry := NewEntry(Fields{"bytes": "18446744073709551615", "offset": "-42", "dash": "-", "ratio": "0.5"})
+
+				val, err := entry.UintField("bytes")
+				So(err, ShouldBeNil)
+				So(val, ShouldEqual, uint64(18446744073709551615))
+
+				_, err = entry.IntField("bytes")
+				So(err, ShouldNotBeNil)
+
+				ival, err := entry.IntField("offset")
+				So(err, ShouldBeNil)
+				So(ival, ShouldEqual, -42)
+
+				_, err = entry.UintField("offset")
+				So(err, ShouldNotBeNil)
+
+				// Empty values are missing
+				_, err = entry.UintField("dash")
+				So(err, ShouldNotBeNil)
+				_, err = entry.IntField("dash")
+				So(err, ShouldNotBeNil)
+
+				_, err = entry.IntField("ratio")
+				So(err, ShouldNotBeNil)
+				_, err = entry.IntField("missing")
+				So(err, ShouldNotBeNil)
 			})
 		})
 
@@ -70,6 +109,13 @@ func TestEntry(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(val, ShouldEqual, "123")
 			})
+
+			Convey("Test set int Entry fields", func() {
+				entry.SetIntField("foo", -123)
+				val, err := entry.Field("foo")
+				So(err, ShouldBeNil)
+				So(val, ShouldEqual, "-123")
+			})
 		})
 
 		Convey("Test Entries merge", func() {
@@ -106,6 +152,20 @@ func TestEntry(t *testing.T) {
 			So(entry2.FieldsHash(fields), ShouldEqual, entry3.FieldsHash(fields))
 			So(entry1.FieldsHash(fields), ShouldNotEqual, entry4.FieldsHash(fields))
 			So(entry2.FieldsHash(fields), ShouldNotEqual, entry4.FieldsHash(fields))
+
+			// Separators in values and missing fields
+			entry1 = NewEntry(Fields{"a": "1;'b'=2"})
+			entry2 = NewEntry(Fields{"a": "1", "b": "2"})
+			fields = []string{"a", "b"}
+			So(entry1.FieldsHash(fields), ShouldEqual, `'a'=1\;'b'=2;'b'`)
+			So(entry1.FieldsHash(fields), ShouldNotEqual, entry2.FieldsHash(fields))
+			So(NewEntry(Fields{"a": ""}).FieldsHash(fields), ShouldNotEqual, NewEntry(Fields{}).FieldsHash(fields))
+			So(NewEntry(Fields{"a": "NULL"}).FieldsHash(fields), ShouldNotEqual, NewEntry(Fields{}).FieldsHash(fields))
+			So(NewEntry(Fields{"a'": "1"}).FieldsHash([]string{"a'"}), ShouldEqual, `'a\''=1`)
+
+			So(entry1.FieldsDigest(fields), ShouldHaveLength, 16)
+			So(entry1.FieldsDigest(fields), ShouldNotEqual, entry2.FieldsDigest(fields))
+			So(entry2.FieldsDigest(fields), ShouldEqual, NewEntry(Fields{"b": "2", "a": "1"}).FieldsDigest(fields))
 		})
 
 		Convey("Test partial Entry", func() {
@@ -118,5 +178,311 @@ func TestEntry(t *testing.T) {
 			val, _ = partial.Field("foo")
 			So(val, ShouldEqual, "1")
 		})
+
+		Convey("Test multi-value fields", func() {
+			entry := NewEntry(Fields{
+				"upstream_addr":          "192.168.1.1:80, 192.168.1.2:80 : 192.168.10.1:80",
+				"upstream_response_time": "0.005, - : 0.010",
+				"upstream_status":        "502",
+			})
+
+			values, err := entry.Values("upstream_addr")
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, []string{"192.168.1.1:80", "192.168.1.2:80", "192.168.10.1:80"})
+
+			values, err = entry.Values("upstream_status")
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, []string{"502"})
+
+			// Empty values are missing
+			_, err = entry.FloatValues("upstream_response_time")
+			So(err, ShouldNotBeNil)
+			entry.SetField("upstream_response_time", "0.005, 0.020 : 0.010")
+			times, err := entry.FloatValues("upstream_response_time")
+			So(err, ShouldBeNil)
+			So(times, ShouldResemble, []float64{0.005, 0.020, 0.010})
+
+			_, err = entry.FloatValues("upstream_addr")
+			So(err, ShouldNotBeNil)
+			_, err = entry.Values("missing")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Test time fields", func() {
+			entry := NewEntry(Fields{
+				"time_local":   "08/Nov/2013:13:39:18 +0300",
+				"time_iso8601": "2013-11-08T13:39:18+03:00",
+				"timestamp":    "2013-11-08",
+			})
+
+			local, err := entry.DefaultTimeField("time_local")
+			So(err, ShouldBeNil)
+			iso, err := entry.DefaultTimeField("time_iso8601")
+			So(err, ShouldBeNil)
+			So(local.Equal(iso), ShouldBeTrue)
+			_, offset := local.Zone()
+			So(offset, ShouldEqual, 3*60*60)
+
+			_, err = entry.DefaultTimeField("timestamp")
+			So(err, ShouldNotBeNil)
+			value, err := entry.TimeField("timestamp", "2006-01-02")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, time.Date(2013, time.November, 8, 0, 0, 0, 0, time.UTC))
+			_, err = entry.TimeField("missing", "2006-01-02")
+			So(err, ShouldNotBeNil)
+
+			// Entry default layout is used instead of the nginx ones
+			entry.SetTimeLayout("2006-01-02")
+			value, err = entry.DefaultTimeField("timestamp")
+			So(err, ShouldBeNil)
+			So(value.Day(), ShouldEqual, 8)
+			_, err = entry.DefaultTimeField("time_local")
+			So(err, ShouldNotBeNil)
+
+			date := time.Date(2013, time.November, 9, 0, 0, 0, 0, time.UTC)
+			entry.SetTimeField("timestamp", date, "2006-01-02")
+			value, err = entry.TimeField("timestamp", time.RFC3339)
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, date)
+			So(entry.Fields()["timestamp"], ShouldEqual, "2013-11-09")
+
+			// String value setter resets the typed one
+			entry.SetField("timestamp", "2013-11-10")
+			_, err = entry.TimeField("timestamp", time.RFC3339)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Get duration values", func() {
+			entry := NewEntry(Fields{
+				"request_time":           "0.005",
+				"upstream_connect_time":  "1.",
+				"upstream_response_time": "150ms",
+				"upstream_header_time":   "-",
+				"status":                 "OK",
+			})
+
+			value, err := entry.DurationField("request_time")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 5*time.Millisecond)
+			value, err = entry.DurationField("upstream_connect_time")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, time.Second)
+			value, err = entry.DurationField("upstream_response_time")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 150*time.Millisecond)
+			// Empty values are missing
+			_, err = entry.DurationField("upstream_header_time")
+			So(err, ShouldNotBeNil)
+
+			entry.SetDurationField("request_time", 1500*time.Millisecond+400*time.Microsecond)
+			So(entry.Fields()["request_time"], ShouldEqual, "1.500")
+			value, err = entry.DurationField("request_time")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 1500*time.Millisecond)
+
+			_, err = entry.DurationField("status")
+			So(err, ShouldNotBeNil)
+			_, err = entry.DurationField("missing")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Get bool values", func() {
+			entry := NewEntry(Fields{
+				"https":     "on",
+				"pipe":      "p",
+				"keepalive": "TRUE",
+				"gzip":      "0",
+				"cached":    ".",
+				"ssl":       "",
+				"status":    "200",
+			})
+
+			for _, name := range []string{"https", "pipe", "keepalive"} {
+				value, err := entry.BoolField(name)
+				So(err, ShouldBeNil)
+				So(value, ShouldBeTrue)
+			}
+			for _, name := range []string{"gzip", "cached", "ssl"} {
+				value, err := entry.BoolField(name)
+				So(err, ShouldBeNil)
+				So(value, ShouldBeFalse)
+			}
+
+			_, err := entry.BoolField("status")
+			So(err, ShouldNotBeNil)
+			_, err = entry.BoolField("missing")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Get IP address values", func() {
+			entry := NewEntry(Fields{
+				"remote_addr":          "89.234.89.123",
+				"realip_remote_addr":   "2001:db8::1",
+				"http_x_forwarded_for": "203.0.113.7, 10.0.0.1, 10.0.0.2",
+				"upstream_addr":        "[2001:db8::2]:443",
+				"proxy_addr":           "10.0.0.1:8080",
+				"remote_user":          "-",
+			})
+
+			ip, err := entry.IPField("remote_addr")
+			So(err, ShouldBeNil)
+			So(ip, ShouldResemble, net.IPv4(89, 234, 89, 123).To4())
+			ip, err = entry.IPField("realip_remote_addr")
+			So(err, ShouldBeNil)
+			So(ip.String(), ShouldEqual, "2001:db8::1")
+			ip, err = entry.IPField("http_x_forwarded_for")
+			So(err, ShouldBeNil)
+			So(ip.String(), ShouldEqual, "203.0.113.7")
+			ip, err = entry.IPField("upstream_addr")
+			So(err, ShouldBeNil)
+			So(ip.String(), ShouldEqual, "2001:db8::2")
+			ip, err = entry.IPField("proxy_addr")
+			So(err, ShouldBeNil)
+			So(ip.String(), ShouldEqual, "10.0.0.1")
+
+			_, network, _ := net.ParseCIDR("203.0.113.0/24")
+			ip, _ = entry.IPField("http_x_forwarded_for")
+			So(network.Contains(ip), ShouldBeTrue)
+
+			_, err = entry.IPField("remote_user")
+			So(err, ShouldNotBeNil)
+			_, err = entry.IPField("missing")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Cache converted values", func() {
+			entry := NewEntry(Fields{"bytes": "1024"})
+			value, err := entry.FloatField("bytes")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 1024)
+			So(entry.cache.get("bytes"), ShouldEqual, float64(1024))
+
+			// Other types are converted from the string value
+			number, err := entry.UintField("bytes")
+			So(err, ShouldBeNil)
+			So(number, ShouldEqual, 1024)
+
+			// Setter resets the cached value
+			entry.SetUintField("bytes", 2048)
+			value, err = entry.FloatField("bytes")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 2048)
+
+			// Concurrent readers, e.g. Chain reducers
+			done := make(chan float64)
+			for i := 0; i < 4; i++ {
+				go func() {
+					value, _ := entry.FloatField("bytes")
+					done <- value
+				}()
+			}
+			for i := 0; i < 4; i++ {
+				So(<-done, ShouldEqual, 2048)
+			}
+
+			// Entry literals are not cached
+			value, err = (&Entry{fields: Fields{"bytes": "1"}}).FloatField("bytes")
+			So(err, ShouldBeNil)
+			So(value, ShouldEqual, 1)
+		})
+
+		Convey("Iterate fields in order", func() {
+			entry := NewEntry(Fields{"status": "200", "bytes": "10", "remote_addr": "89.234.89.123"})
+			So(entry.Names(), ShouldResemble, []string{"bytes", "remote_addr", "status"})
+			So(NewEmptyEntry().Names(), ShouldBeEmpty)
+
+			var pairs []string
+			entry.Each(func(name, value string) {
+				pairs = append(pairs, name+"="+value)
+			})
+			So(pairs, ShouldResemble, []string{"bytes=10", "remote_addr=89.234.89.123", "status=200"})
+
+			So(entry.Hash(), ShouldEqual, "'bytes'=10;'remote_addr'=89.234.89.123;'status'=200")
+			same := NewEntry(Fields{"remote_addr": "89.234.89.123", "status": "200", "bytes": "10"})
+			So(same.Hash(), ShouldEqual, entry.Hash())
+		})
+
+		Convey("Delete and rename fields", func() {
+			entry := NewEntry(Fields{"remote_addr": "89.234.89.123", "remote_user": "john", "time": "2013-11-08"})
+			entry.Delete("remote_user")
+			entry.Delete("missing")
+			So(entry.Fields(), ShouldResemble, Fields{"remote_addr": "89.234.89.123", "time": "2013-11-08"})
+
+			entry.SetTimeField("time", time.Date(2013, time.November, 8, 0, 0, 0, 0, time.UTC), "2006-01-02")
+			entry.Rename("remote_addr", "client")
+			entry.Rename("time", "date")
+			entry.Rename("missing", "date")
+			So(entry.Fields(), ShouldResemble, Fields{"client": "89.234.89.123", "date": "2013-11-08"})
+			So(entry.times, ShouldContainKey, "date")
+			So(entry.times, ShouldNotContainKey, "time")
+
+			entry.Rename("client", "client")
+			So(entry.Fields()["client"], ShouldEqual, "89.234.89.123")
+		})
+
+		Convey("Copy entry", func() {
+			entry := NewEntry(Fields{"remote_addr": "89.234.89.123", "date": "2013-11-08"})
+			entry.SetTimeField("date", time.Date(2013, time.November, 8, 0, 0, 0, 0, time.UTC), "2006-01-02")
+			entry.SetTimeLayout("2006-01-02")
+			copied := entry.Copy()
+			So(copied, ShouldResemble, entry)
+
+			copied.SetField("remote_addr", "127.0.0.1")
+			copied.Delete("date")
+			So(entry.Fields(), ShouldResemble, Fields{"remote_addr": "89.234.89.123", "date": "2013-11-08"})
+			So(entry.times, ShouldContainKey, "date")
+		})
+
+		Convey("Compare entries", func() {
+			entry := NewEntry(Fields{"remote_addr": "89.234.89.123", "status": "200", "bytes": "10"})
+			So(entry.Equal(NewEntry(Fields{"bytes": "10", "status": "200", "remote_addr": "89.234.89.123"})), ShouldBeTrue)
+			So(entry.Diff(entry.Copy()), ShouldBeEmpty)
+
+			other := NewEntry(Fields{"remote_addr": "89.234.89.123", "status": "404", "uri": "/"})
+			So(entry.Equal(other), ShouldBeFalse)
+			So(entry.Equal(NewEntry(Fields{"remote_addr": "89.234.89.123", "status": "200", "uri": "10"})), ShouldBeFalse)
+			So(entry.Diff(other), ShouldResemble, []string{"bytes", "status", "uri"})
+			So(other.Diff(entry), ShouldResemble, []string{"bytes", "status", "uri"})
+		})
+
+		Convey("Get values with defaults", func() {
+			entry := NewEntry(Fields{"status": "200", "request_time": "0.05", "remote_user": "-"})
+			So(entry.FieldOrDefault("status", "000"), ShouldEqual, "200")
+			So(entry.FieldOrDefault("missing", "000"), ShouldEqual, "000")
+			So(entry.FloatFieldOrDefault("request_time", -1), ShouldEqual, 0.05)
+			So(entry.FloatFieldOrDefault("remote_user", -1), ShouldEqual, -1)
+			So(entry.FloatFieldOrDefault("missing", -1), ShouldEqual, -1)
+			So(NewEntry(Fields{"status": "OK"}).FloatFieldOrDefault("status", -1), ShouldEqual, -1)
+
+			So(entry.MustField("status"), ShouldEqual, "200")
+			So(entry.MustFloatField("request_time"), ShouldEqual, 0.05)
+			So(func() { entry.MustField("missing") }, ShouldPanic)
+			So(func() { NewEntry(Fields{"status": "OK"}).MustFloatField("status") }, ShouldPanic)
+		})
+
+		Convey("Export values in order", func() {
+			entry := NewEntry(Fields{"status": "200", "remote_addr": "89.234.89.123"})
+			So(entry.ToSlice([]string{"remote_addr", "missing", "status"}), ShouldResemble,
+				[]string{"89.234.89.123", "", "200"})
+			So(entry.ToSlice(nil), ShouldBeEmpty)
+		})
+
+		Convey("Set fields in bulk", func() {
+			entry := NewEntry(Fields{"status": "200", "bytes": "10"})
+			value, _ := entry.FloatField("bytes")
+			So(value, ShouldEqual, 10)
+
+			entry.MergeFields(Fields{"bytes": "20", "uri": "/"})
+			So(entry.Fields(), ShouldResemble, Fields{"status": "200", "bytes": "20", "uri": "/"})
+			value, _ = entry.FloatField("bytes")
+			So(value, ShouldEqual, 20)
+
+			fields := Fields{"bytes": "30"}
+			entry.SetFields(fields)
+			fields["status"] = "404"
+			So(entry.Fields(), ShouldResemble, Fields{"bytes": "30"})
+			value, _ = entry.FloatField("bytes")
+			So(value, ShouldEqual, 30)
+		})
 	})
 }
@@ -0,0 +1,54 @@
+package gonx
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Escape is the escaping of the logged values, see nginx log_format escape
+// parameter.
+type Escape int
+
+const (
+	// Values are not escaped or should be kept as they are.
+	EscapeNone Escape = iota
+	// nginx escape=default, special chars are written as "\xXX".
+	EscapeDefault
+	// nginx escape=json, values are escaped as JSON strings.
+	EscapeJSON
+)
+
+// Unescape decodes the logged value. The value is returned as it is if it
+// is not escaped properly.
+func (e Escape) Unescape(value string) string {
+	if strings.IndexByte(value, '\\') < 0 {
+		return value
+	}
+	switch e {
+	case EscapeDefault:
+		return unescapeHex(value)
+	case EscapeJSON:
+		var unquoted string
+		if err := json.Unmarshal([]byte(`"`+value+`"`), &unquoted); err == nil {
+			return unquoted
+		}
+	}
+	return value
+}
+
+// Decode "\xXX" escape sequences.
+func unescapeHex(value string) string {
+	buf := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && value[i+1] == 'x' {
+			if b, err := strconv.ParseUint(value[i+2:i+4], 16, 8); err == nil {
+				buf = append(buf, byte(b))
+				i += 3
+				continue
+			}
+		}
+		buf = append(buf, value[i])
+	}
+	return string(buf)
+}
@@ -0,0 +1,389 @@
+package gonx
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Implements Filter interface to pass entries matching the filter
+// expression, so the conditions could be set in the command line flags and
+// config files, e.g.
+//
+//	status >= 500 && request =~ "^GET /api/"
+//
+// Comparisons are field name, operator and value. Numbers are compared as
+// numbers with ==, !=, <, <=, > and >=, strings are compared with == and
+// != or matched with the regular expressions with =~ and !~. Conditions are
+// combined with &&, || and !, and grouped with parentheses; && binds
+// tighter than ||. Any comparison with a missing field (or a non-numeric
+// value compared to a number) is false, the empty values and "-"
+// placeholders are missing numbers as for Entry.FloatField.
+type Expression struct {
+	expr      string
+	condition condition
+}
+
+// Compile the filter expression, it returns an error on syntax errors and
+// invalid regular expressions.
+func NewExpression(expr string) (*Expression, error) {
+	p := &expressionParser{expr: expr}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	c, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.unexpected()
+	}
+	return &Expression{expr: expr, condition: c}, nil
+}
+
+// Returns the source expression.
+func (i *Expression) String() string {
+	return i.expr
+}
+
+// Pass the entry if it matches the expression, return nil otherwise.
+func (i *Expression) Filter(entry *Entry) *Entry {
+	if i.condition.match(entry) {
+		return entry
+	}
+	return nil
+}
+
+// Reducer interface too. Go through input and apply Filter.
+func (i *Expression) Reduce(input chan *Entry, output chan *Entry) {
+	for entry := range input {
+		if valid := i.Filter(entry); valid != nil {
+			output <- valid
+		}
+	}
+	close(output)
+}
+
+// Implements Filter interface to filter the aggregated entries by the
+// computed fields, as SQL HAVING does. Use it after GroupBy in the Pipeline,
+// e.g. the URIs with more than 100 requests:
+//
+//	having, err := NewHaving("count > 100")
+//	NewPipeline(NewGroupBy([]string{"request_uri"}, new(Count)), having)
+//
+// The zero Having passes nothing.
+type Having struct {
+	expression *Expression
+}
+
+// Returns the Having of the filter expression (see Expression), it returns
+// an error if the expression is invalid.
+func NewHaving(expr string) (*Having, error) {
+	expression, err := NewExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Having{expression}, nil
+}
+
+// Returns the filter expression.
+func (i *Having) String() string {
+	if i.expression == nil {
+		return ""
+	}
+	return i.expression.String()
+}
+
+// Pass the aggregated entry if it matches the expression, return nil
+// otherwise.
+func (i *Having) Filter(entry *Entry) *Entry {
+	if i.expression == nil {
+		return nil
+	}
+	return i.expression.Filter(entry)
+}
+
+// Reducer interface too. Go through input and apply Filter.
+func (i *Having) Reduce(input chan *Entry, output chan *Entry) {
+	reduceFilter(i.Filter, input, output)
+}
+
+type condition interface {
+	match(*Entry) bool
+}
+
+type andCondition struct{ left, right condition }
+
+func (c andCondition) match(entry *Entry) bool { return c.left.match(entry) && c.right.match(entry) }
+
+type orCondition struct{ left, right condition }
+
+func (c orCondition) match(entry *Entry) bool { return c.left.match(entry) || c.right.match(entry) }
+
+type notCondition struct{ condition condition }
+
+func (c notCondition) match(entry *Entry) bool { return !c.condition.match(entry) }
+
+// Field comparison with the string or the number value.
+type comparison struct {
+	field    string
+	op       string
+	value    string
+	number   float64
+	isNumber bool
+	re       *regexp.Regexp
+}
+
+func (c *comparison) match(entry *Entry) bool {
+	value, err := entry.Field(c.field)
+	if err != nil {
+		return false
+	}
+	switch c.op {
+	case "=~":
+		return c.re.MatchString(value)
+	case "!~":
+		return !c.re.MatchString(value)
+	}
+	if !c.isNumber {
+		if c.op == "==" {
+			return value == c.value
+		}
+		return value != c.value
+	}
+	number, err := entry.FloatField(c.field)
+	if err != nil {
+		return false
+	}
+	switch c.op {
+	case "==":
+		return number == c.number
+	case "!=":
+		return number != c.number
+	case "<":
+		return number < c.number
+	case "<=":
+		return number <= c.number
+	case ">":
+		return number > c.number
+	default:
+		return number >= c.number
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenName tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	pos   int
+	value string
+}
+
+// Recursive descent parser of the filter expressions.
+type expressionParser struct {
+	expr   string
+	tokens []token
+	pos    int
+}
+
+// Operators, the longest first.
+var expressionOperators = []string{
+	"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")",
+}
+
+func (p *expressionParser) tokenize() error {
+	for i := 0; i < len(p.expr); {
+		c := rune(p.expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(p.expr) && p.expr[end] != '"' {
+				if p.expr[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(p.expr) {
+				return fmt.Errorf("filter expression: unterminated string at %d", i)
+			}
+			value, err := strconv.Unquote(p.expr[i : end+1])
+			if err != nil {
+				return fmt.Errorf("filter expression: invalid string at %d: %v", i, err)
+			}
+			p.tokens = append(p.tokens, token{tokenString, p.expr[i : end+1], i, value})
+			i = end + 1
+		case c == '-' || c == '.' || unicode.IsDigit(c):
+			end := i + 1
+			for end < len(p.expr) && (p.expr[end] == '.' || unicode.IsDigit(rune(p.expr[end]))) {
+				end++
+			}
+			text := p.expr[i:end]
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return fmt.Errorf("filter expression: invalid number %q at %d", text, i)
+			}
+			p.tokens = append(p.tokens, token{tokenNumber, text, i, text})
+			i = end
+		case c == '_' || unicode.IsLetter(c):
+			end := i + 1
+			for end < len(p.expr) && isNameByte(p.expr[end]) {
+				end++
+			}
+			p.tokens = append(p.tokens, token{tokenName, p.expr[i:end], i, p.expr[i:end]})
+			i = end
+		default:
+			op := ""
+			for _, candidate := range expressionOperators {
+				if strings.HasPrefix(p.expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("filter expression: unexpected %q at %d", c, i)
+			}
+			p.tokens = append(p.tokens, token{tokenOperator, op, i, op})
+			i += len(op)
+		}
+	}
+	return nil
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// Returns the current token if it is the given operator and advances.
+func (p *expressionParser) accept(op string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOperator && p.tokens[p.pos].text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *expressionParser) unexpected() error {
+	if p.pos >= len(p.tokens) {
+		return fmt.Errorf("filter expression: unexpected end of %q", p.expr)
+	}
+	t := p.tokens[p.pos]
+	return fmt.Errorf("filter expression: unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *expressionParser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orCondition{left, right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) and() (condition, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = andCondition{left, right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) unary() (condition, error) {
+	if p.accept("!") {
+		c, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{c}, nil
+	}
+	if p.accept("(") {
+		c, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, p.unexpected()
+		}
+		return c, nil
+	}
+	return p.comparison()
+}
+
+// Returns the token of the given kind and advances, ok is false if there is
+// no such token at the current position.
+func (p *expressionParser) expect(kind tokenKind) (t token, ok bool) {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind {
+		t, ok = p.tokens[p.pos], true
+		p.pos++
+	}
+	return
+}
+
+func (p *expressionParser) comparison() (condition, error) {
+	field, ok := p.expect(tokenName)
+	if !ok {
+		return nil, p.unexpected()
+	}
+	op, ok := p.expect(tokenOperator)
+	if !ok {
+		return nil, p.unexpected()
+	}
+	c := &comparison{field: field.value, op: op.text}
+	numeric, matching := false, false
+	switch op.text {
+	case "==", "!=":
+	case "<", "<=", ">", ">=":
+		numeric = true
+	case "=~", "!~":
+		matching = true
+	default:
+		p.pos--
+		return nil, p.unexpected()
+	}
+	if p.pos >= len(p.tokens) {
+		return nil, p.unexpected()
+	}
+	value := p.tokens[p.pos]
+	switch {
+	case value.kind == tokenNumber && !matching:
+		c.value = value.value
+		c.number, _ = strconv.ParseFloat(value.value, 64)
+		c.isNumber = true
+	case value.kind == tokenString && !numeric:
+		c.value = value.value
+		if matching {
+			re, err := regexp.Compile(value.value)
+			if err != nil {
+				return nil, fmt.Errorf("filter expression: invalid pattern at %d: %v", value.pos, err)
+			}
+			c.re = re
+		}
+	default:
+		return nil, p.unexpected()
+	}
+	p.pos++
+	return c, nil
+}
@@ -0,0 +1,118 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExpression(t *testing.T) {
+	Convey("Test filter expressions", t, func() {
+		entry := NewEntry(Fields{
+			"status":       "502",
+			"request":      "GET /api/users HTTP/1.1",
+			"request_time": "0.250",
+			"remote_user":  "-",
+		})
+		match := func(expr string) bool {
+			filter, err := NewExpression(expr)
+			So(err, ShouldBeNil)
+			return filter.Filter(entry) != nil
+		}
+
+		Convey("Compare numbers", func() {
+			So(match(`status >= 500`), ShouldBeTrue)
+			So(match(`status < 500`), ShouldBeFalse)
+			So(match(`status == 502`), ShouldBeTrue)
+			So(match(`status != 502.0`), ShouldBeFalse)
+			So(match(`request_time > .2`), ShouldBeTrue)
+			So(match(`request_time <= -1`), ShouldBeFalse)
+		})
+
+		Convey("Compare strings", func() {
+			So(match(`remote_user == "-"`), ShouldBeTrue)
+			So(match(`status != "502"`), ShouldBeFalse)
+			So(match(`request =~ "^GET /api/"`), ShouldBeTrue)
+			So(match(`request !~ "\\.js "`), ShouldBeTrue)
+		})
+
+		Convey("Missing and non-numeric fields", func() {
+			So(match(`missing == "x"`), ShouldBeFalse)
+			So(match(`missing != "x"`), ShouldBeFalse)
+			So(match(`request >= 0`), ShouldBeFalse)
+			// Placeholders are missing numbers
+			So(match(`remote_user == 0`), ShouldBeFalse)
+			So(match(`remote_user != 0`), ShouldBeFalse)
+			So(match(`!(missing == "x")`), ShouldBeTrue)
+		})
+
+		Convey("Combine conditions", func() {
+			So(match(`status >= 500 && request =~ "^GET /api"`), ShouldBeTrue)
+			So(match(`status < 500 || request_time > 0.1`), ShouldBeTrue)
+			So(match(`status < 500 && request_time > 0.1 || status == 502`), ShouldBeTrue)
+			So(match(`status < 500 && (request_time > 0.1 || status == 502)`), ShouldBeFalse)
+			So(match(`!!(status == 502)`), ShouldBeTrue)
+		})
+
+		Convey("Syntax errors", func() {
+			for _, expr := range []string{
+				``,
+				`status`,
+				`status >=`,
+				`status >= "500"`,
+				`request =~ 1`,
+				`500 == status`,
+				`status == 500 &&`,
+				`(status == 500`,
+				`status == 500)`,
+				`request == "unterminated`,
+				`request =~ "("`,
+				`status = 500`,
+				`status == 1.2.3`,
+			} {
+				_, err := NewExpression(expr)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("Reduce channel", func() {
+			filter, err := NewExpression(`status >= 500`)
+			So(err, ShouldBeNil)
+			So(filter.String(), ShouldEqual, `status >= 500`)
+			input := make(chan *Entry, 2)
+			output := make(chan *Entry, 2)
+			input <- entry
+			input <- NewEntry(Fields{"status": "200"})
+			close(input)
+			filter.Reduce(input, output)
+			So(<-output, ShouldEqual, entry)
+			_, ok := <-output
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Test Having filter", t, func() {
+		input := make(chan *Entry, 5)
+		for _, uri := range []string{"/a", "/b", "/a", "/c", "/a"} {
+			input <- NewEntry(Fields{"request_uri": uri})
+		}
+		close(input)
+		output := make(chan *Entry, 5)
+
+		Convey("Filter groups", func() {
+			having, err := NewHaving("count > 1")
+			So(err, ShouldBeNil)
+			So(having.String(), ShouldEqual, "count > 1")
+			NewPipeline(NewGroupBy([]string{"request_uri"}, new(Count)), having).Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"request_uri": "/a", "count": "3"})
+			_, ok := <-output
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Invalid expression", func() {
+			_, err := NewHaving("count >")
+			So(err, ShouldNotBeNil)
+			So(new(Having).Filter(NewEmptyEntry()), ShouldBeNil)
+		})
+	})
+}
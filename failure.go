@@ -0,0 +1,181 @@
+package gonx
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FailureCause is the inferred reason of the line parse failure. It is
+// a heuristic, but it points to the log_format discrepancy better than
+// a plain failures count.
+type FailureCause string
+
+const (
+	// Line contains invalid UTF-8 or control characters, e.g. a binary
+	// garbage or a TLS handshake sent to the plain HTTP port.
+	CauseEncoding FailureCause = "encoding"
+	// Line ends before the format does, e.g. the log was rotated or the
+	// disk got full while the line was written.
+	CauseTruncated FailureCause = "truncated"
+	// Line has unbalanced quotes or their number differs from the format,
+	// e.g. unescaped quotes in the user agent.
+	CauseQuoteMismatch FailureCause = "quote_mismatch"
+	// Line has more or less space separated fields than the format, e.g.
+	// the log_format was changed.
+	CauseFieldCount FailureCause = "field_count"
+	// None of the above.
+	CauseUnknown FailureCause = "unknown"
+)
+
+// ParseError is returned by Parser for the lines that do not match the
+// format.
+type ParseError struct {
+	Line   string
+	Format string
+	Cause  FailureCause
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("access log line '%v' does not match given format '%v'", e.Line, e.Format)
+}
+
+// Returns the cause of the parse error, or CauseUnknown if it is not
+// a ParseError.
+func ErrorCause(err error) FailureCause {
+	if e, ok := err.(*ParseError); ok {
+		return e.Cause
+	}
+	return CauseUnknown
+}
+
+// Infer the cause of the line parse failure. The format is empty for the
+// regexp parsers, only the line itself is checked for them. Truncated is
+// true if the line matched the format until its end.
+func failureCause(format string, line string, truncated bool) FailureCause {
+	if !utf8.ValidString(line) || strings.IndexFunc(line, isBinary) >= 0 {
+		return CauseEncoding
+	}
+	if truncated {
+		return CauseTruncated
+	}
+	quotes := countQuotes(line)
+	if quotes%2 != 0 {
+		return CauseQuoteMismatch
+	}
+	if format == "" {
+		return CauseUnknown
+	}
+	if quotes != countQuotes(format) {
+		return CauseQuoteMismatch
+	}
+	if countTokens(line) != countTokens(format) {
+		return CauseFieldCount
+	}
+	return CauseUnknown
+}
+
+// Control characters that are not expected in the text log lines
+func isBinary(r rune) bool {
+	return unicode.IsControl(r) && r != '\t' && r != '\n'
+}
+
+// Count quotes that are not escaped with a backslash
+func countQuotes(s string) (count int) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			count++
+		}
+	}
+	return
+}
+
+// Count space separated tokens, quoted and bracketed values are single
+// tokens.
+func countTokens(s string) (count int) {
+	var closing byte
+	inToken := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case closing != 0:
+			if c == '\\' {
+				i++
+			} else if c == closing {
+				closing = 0
+			}
+		case c == ' ':
+			inToken = false
+		default:
+			if !inToken {
+				count++
+				inToken = true
+			}
+			if c == '"' {
+				closing = '"'
+			} else if c == '[' {
+				closing = ']'
+			}
+		}
+	}
+	return
+}
+
+// FailureCounter wraps the parser to count parse failures by their causes.
+// Use it to report why the lines were skipped:
+//
+//	counter := gonx.NewFailureCounter(gonx.NewParser(format))
+//	reader := gonx.NewParserReader(file, counter)
+//	// ... read entries
+//	fmt.Println(counter.Counts())
+type FailureCounter struct {
+	StringParser
+
+	mu     sync.Mutex
+	counts map[FailureCause]uint64
+}
+
+// Returns a new FailureCounter for the given parser.
+func NewFailureCounter(parser StringParser) *FailureCounter {
+	return &FailureCounter{
+		StringParser: parser,
+		counts:       make(map[FailureCause]uint64),
+	}
+}
+
+// Parse the line with the wrapped parser and count the failure cause if
+// it failed.
+func (c *FailureCounter) ParseString(line string) (entry *Entry, err error) {
+	entry, err = c.StringParser.ParseString(line)
+	if err != nil {
+		c.mu.Lock()
+		c.counts[ErrorCause(err)]++
+		c.mu.Unlock()
+	}
+	return
+}
+
+// Check whether the line should be folded into the previous record, if the
+// wrapped parser is a multiline one.
+func (c *FailureCounter) IsContinuation(line string) bool {
+	if folder, ok := c.StringParser.(lineFolder); ok {
+		return folder.IsContinuation(line)
+	}
+	return false
+}
+
+// Returns a copy of the failure counts by cause.
+func (c *FailureCounter) Counts() map[FailureCause]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[FailureCause]uint64, len(c.counts))
+	for cause, count := range c.counts {
+		counts[cause] = count
+	}
+	return counts
+}
@@ -0,0 +1,67 @@
+package gonx
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFailureCause(t *testing.T) {
+	Convey("Test parse failure causes", t, func() {
+		parser := NewParser(`$remote_addr [$time_local] "$request" $status "$http_user_agent"`)
+		cause := func(line string) FailureCause {
+			_, err := parser.ParseString(line)
+			So(err, ShouldNotBeNil)
+			return ErrorCause(err)
+		}
+
+		Convey("Classify failures", func() {
+			So(cause("\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03"), ShouldEqual, CauseEncoding)
+			So(cause("89.234.89.123 [08/Nov/2013:13:39:18 +0000] \"GET /\xff HTTP/1.1\" 200"), ShouldEqual, CauseEncoding)
+			So(cause(`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET /api/foo/b`), ShouldEqual, CauseTruncated)
+			So(cause(`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 "Foo "Bar" Baz"`), ShouldEqual, CauseQuoteMismatch)
+			So(cause(`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 "curl/7.68.0" ^_^`), ShouldEqual, CauseFieldCount)
+			So(cause(`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 "curl" 0.1`), ShouldEqual, CauseFieldCount)
+			So(cause(`89.234.89.123 "GET / HTTP/1.1" 200 "curl/7.68.0"`), ShouldEqual, CauseFieldCount)
+			So(cause(`89.234.89.123 {08/Nov/2013:13:39:18} "GET / HTTP/1.1" 200 "curl/7.68.0"`), ShouldEqual, CauseUnknown)
+		})
+
+		Convey("Classify regexp parser failures", func() {
+			parser := NewRegexpParser(regexp.MustCompile(`^(?P<remote_addr>\S+) "(?P<request>[^"]*)"$`))
+			_, err := parser.ParseString(`89.234.89.123 "GET / HTTP/1.1`)
+			So(ErrorCause(err), ShouldEqual, CauseQuoteMismatch)
+			_, err = parser.ParseString(`89.234.89.123 GET`)
+			So(ErrorCause(err), ShouldEqual, CauseUnknown)
+		})
+
+		Convey("Count failures by cause", func() {
+			counter := NewFailureCounter(parser)
+			reader := NewParserReader(strings.NewReader(strings.Join([]string{
+				`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 "curl/7.68.0"`,
+				`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 "curl`,
+				`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1`,
+				`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 "Foo "Bar" Baz"`,
+			}, "\n")), counter)
+			count := 0
+			for {
+				if _, err := reader.Read(); err != nil {
+					break
+				}
+				count++
+			}
+			So(count, ShouldEqual, 1)
+			So(counter.Counts(), ShouldResemble, map[FailureCause]uint64{
+				CauseTruncated:     2,
+				CauseQuoteMismatch: 1,
+			})
+		})
+
+		Convey("Error message", func() {
+			_, err := parser.ParseString("foo")
+			So(err.Error(), ShouldStartWith, "access log line 'foo' does not match given format")
+			So(ErrorCause(nil), ShouldEqual, CauseUnknown)
+		})
+	})
+}
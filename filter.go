@@ -1,6 +1,14 @@
 package gonx
 
-import "time"
+import (
+	"container/list"
+	"math"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // Filter interface for Entries channel limiting.
 //
@@ -11,23 +19,44 @@ type Filter interface {
 	Filter(*Entry) *Entry
 }
 
+// Filters with the state between the entries, e.g. Dedup. Their Reduce and
+// Chain make a new state for each run, so the GroupBy groups and the
+// consecutive runs do not share it.
+type statefulFilter interface {
+	Filter
+	// Returns the Filter function with a new state.
+	newFilter() func(*Entry) *Entry
+}
+
+// Apply the filter function to the input, see statefulFilter.
+func reduceFilter(filter func(*Entry) *Entry, input chan *Entry, output chan *Entry) {
+	for entry := range input {
+		if valid := filter(entry); valid != nil {
+			output <- valid
+		}
+	}
+	close(output)
+}
+
 // Implements Filter interface to filter Entries with timestamp fields within
-// the specified datetime interval.
+// the specified datetime interval. The Start is inclusive and the End is
+// exclusive unless IncludeEnd is set. Zero Start or End means the interval
+// is open on that side.
 type Datetime struct {
-	Field  string
-	Format string
-	Start  time.Time
-	End    time.Time
+	Field      string
+	Format     string
+	Start      time.Time
+	End        time.Time
+	IncludeEnd bool
+	// The input is ordered by time, so Reduce stops at the first entry
+	// after the End.
+	StopAfterEnd bool
 }
 
 // Check field value to be in desired datetime range.
 func (i *Datetime) Filter(entry *Entry) (validEntry *Entry) {
-	val, err := entry.Field(i.Field)
-	if err != nil {
-		// TODO handle error
-		return
-	}
-	t, err := time.Parse(i.Format, val)
+	// Typed time is used if the field was parsed already
+	t, err := entry.TimeField(i.Field, i.Format)
 	if err != nil {
 		// TODO handle error
 		return
@@ -38,22 +67,461 @@ func (i *Datetime) Filter(entry *Entry) (validEntry *Entry) {
 	return
 }
 
-// Reducer interface too. Go through input and apply Filter.
+// Reducer interface too. Go through input and apply Filter. If StopAfterEnd
+// is set the output is closed at the first entry after the End, so the next
+// reducers do not wait for the rest of the input, and the input reading is
+// stopped: MapReduce or ReduceEntries do not read the rest of the file if
+// the Datetime is their reducer or the first stage of their Pipeline. The
+// entries read already are drained. Note that MapReduce parses the lines
+// concurrently, so the entries around the End could be reordered.
 func (i *Datetime) Reduce(input chan *Entry, output chan *Entry) {
 	for entry := range input {
 		if valid := i.Filter(entry); valid != nil {
 			output <- valid
+		} else if i.StopAfterEnd && i.afterEnd(entry) {
+			stopInput(input)
+			break
 		}
 	}
 	close(output)
+	for range input {
+	}
 }
 
 func (i *Datetime) withinBounds(t time.Time) bool {
-	if t.Equal(i.Start) {
-		return true
+	if !i.Start.IsZero() && t.Before(i.Start) {
+		return false
 	}
-	if t.After(i.Start) && t.Before(i.End) {
+	if i.End.IsZero() || t.Before(i.End) {
 		return true
 	}
-	return false
+	return i.IncludeEnd && t.Equal(i.End)
+}
+
+// Check the entry time is after the End.
+func (i *Datetime) afterEnd(entry *Entry) bool {
+	if i.End.IsZero() {
+		return false
+	}
+	t, err := entry.TimeField(i.Field, i.Format)
+	if err != nil {
+		return false
+	}
+	return t.After(i.End) || (t.Equal(i.End) && !i.IncludeEnd)
+}
+
+// Implements Filter interface to pass a random sample of entries, each
+// entry is passed with the Rate probability (0.1 for 10% of entries).
+//
+// Random numbers are generated with the given Seed, so the same Seed and
+// the same entries order give exactly the same sample. Note that MapReduce
+// parses lines concurrently and the entries order could differ between the
+// runs; use ReduceEntries with a Reader to reproduce a sample.
+//
+// Each Reduce run (e.g. of each GroupBy group) has its own random numbers
+// of the Seed. The direct Filter calls share the ones kept on the Sample,
+// they are not safe for concurrent use.
+type Sample struct {
+	Rate float64
+	Seed int64
+
+	filter func(*Entry) *Entry
+}
+
+// Pass the entry with the Rate probability, return nil otherwise.
+func (i *Sample) Filter(entry *Entry) *Entry {
+	if i.filter == nil {
+		i.filter = i.newFilter()
+	}
+	return i.filter(entry)
+}
+
+func (i *Sample) newFilter() func(*Entry) *Entry {
+	random := rand.New(rand.NewSource(i.Seed))
+	return func(entry *Entry) *Entry {
+		if random.Float64() < i.Rate {
+			return entry
+		}
+		return nil
+	}
+}
+
+// Reducer interface too. Go through input and apply Filter, the sample of
+// each run is the same for the same Seed and entries order.
+func (i *Sample) Reduce(input chan *Entry, output chan *Entry) {
+	reduceFilter(i.newFilter(), input, output)
+}
+
+// Implements Filter interface to pass entries matching the Func predicate,
+// so arbitrary conditions could be used in the Pipeline without a Reducer
+// implementation, e.g. server errors only:
+//
+//	&Predicate{func(entry *Entry) bool {
+//		status, err := entry.IntField("status")
+//		return err == nil && status >= 500
+//	}}
+//
+// The Filter name is taken by the interface, hence the name.
+type Predicate struct {
+	Func func(*Entry) bool
+}
+
+// Pass the entry if Func returns true, return nil otherwise.
+func (i *Predicate) Filter(entry *Entry) *Entry {
+	if i.Func(entry) {
+		return entry
+	}
+	return nil
+}
+
+// Reducer interface too. Go through input and apply Filter.
+func (i *Predicate) Reduce(input chan *Entry, output chan *Entry) {
+	for entry := range input {
+		if valid := i.Filter(entry); valid != nil {
+			output <- valid
+		}
+	}
+	close(output)
+}
+
+// Implements Filter interface to pass entries with the Field value matching
+// the Regexp, or not matching it if Exclude is set, e.g. for the
+// config-driven pipelines:
+//
+//	api, err := NewMatchFilter("request", `^GET /api/`)
+//	bots, err := NewMatchFilter("http_user_agent", `(?i)bot`)
+//	bots.Exclude = true
+//
+// Entries without the Field never match, nothing matches the nil Regexp.
+type MatchFilter struct {
+	Field   string
+	Regexp  *regexp.Regexp
+	Exclude bool
+}
+
+// Returns the MatchFilter of the field value pattern, it returns an error
+// if the pattern is invalid.
+func NewMatchFilter(field, pattern string) (*MatchFilter, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &MatchFilter{Field: field, Regexp: re}, nil
+}
+
+// Pass the entry if the Field value matches the Regexp (or does not match
+// it in the Exclude mode), return nil otherwise.
+func (i *MatchFilter) Filter(entry *Entry) *Entry {
+	value, err := entry.Field(i.Field)
+	matched := err == nil && i.Regexp != nil && i.Regexp.MatchString(value)
+	if matched != i.Exclude {
+		return entry
+	}
+	return nil
+}
+
+// Reducer interface too. Go through input and apply Filter.
+func (i *MatchFilter) Reduce(input chan *Entry, output chan *Entry) {
+	reduceFilter(i.Filter, input, output)
+}
+
+// Implements Filter interface to drop the entries with the Fields values
+// seen before, e.g. the double-shipped logs by $request_id:
+//
+//	&Dedup{Fields: []string{"request_id"}}
+//
+// All the seen keys are kept if Size is 0, otherwise only the Size most
+// recently seen keys are, so the memory is bounded but the duplicates of
+// the older entries are passed. Entries without any of the Fields are
+// always passed.
+//
+// Each Reduce run (e.g. of each GroupBy group) has its own seen keys. The
+// direct Filter calls share the keys kept on the Dedup, they are not safe
+// for concurrent use.
+type Dedup struct {
+	Fields []string
+	Size   int
+
+	filter func(*Entry) *Entry
+}
+
+// Pass the entry if its key is not seen yet, return nil otherwise.
+func (i *Dedup) Filter(entry *Entry) *Entry {
+	if i.filter == nil {
+		i.filter = i.newFilter()
+	}
+	return i.filter(entry)
+}
+
+func (i *Dedup) newFilter() func(*Entry) *Entry {
+	fields, size := i.Fields, i.Size
+	seen := make(map[string]*list.Element)
+	recent := list.New()
+	return func(entry *Entry) *Entry {
+		if !entry.hasFields(fields) {
+			return entry
+		}
+		key := entry.FieldsHash(fields)
+		if element, ok := seen[key]; ok {
+			recent.MoveToFront(element)
+			return nil
+		}
+		seen[key] = recent.PushFront(key)
+		if size > 0 && recent.Len() > size {
+			delete(seen, recent.Remove(recent.Back()).(string))
+		}
+		return entry
+	}
+}
+
+// Reducer interface too. Go through input and drop the duplicates seen in
+// this run.
+func (i *Dedup) Reduce(input chan *Entry, output chan *Entry) {
+	reduceFilter(i.newFilter(), input, output)
+}
+
+// Implements Filter interface to set the exponentially weighted moving
+// average of the numeric Field values on each entry, e.g. the request_time
+// trend in the follow mode. The average is set to the Target field, Field
+// with "_ewma" suffix by default. Note that it sets the field on the given
+// Entry.
+//
+// Each value has the Alpha weight (0.1 by default), so the recent values
+// matter more with the larger Alpha. Set Window and TimeField to weight
+// the values by the time between the entries instead, for the irregular
+// traffic: the weight is 1 - exp(-elapsed / Window). Entries should be
+// ordered by time then.
+//
+// Entries without a valid value are passed with the current average. Each
+// Reduce run (e.g. of each GroupBy group) has its own average. The direct
+// Filter calls share the average kept on the EWMA, they are not safe for
+// concurrent use.
+type EWMA struct {
+	Field  string
+	Alpha  float64
+	Target string
+	Window time.Duration
+	// Timestamp field for the Window, and its layout. The nginx layout for
+	// the field name (see Entry.DefaultTimeField) is used by default.
+	TimeField string
+	Format    string
+
+	filter func(*Entry) *Entry
+}
+
+// Update the average with the entry value and set the Target field.
+func (i *EWMA) Filter(entry *Entry) *Entry {
+	if i.filter == nil {
+		i.filter = i.newFilter()
+	}
+	return i.filter(entry)
+}
+
+func (i *EWMA) newFilter() func(*Entry) *Entry {
+	target := i.Target
+	if target == "" {
+		target = i.Field + "_ewma"
+	}
+	alpha := i.Alpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.1
+	}
+	var average float64
+	var last time.Time
+	started := false
+	add := func(entry *Entry, value float64) {
+		weight := alpha
+		if i.Window > 0 && i.TimeField != "" {
+			t, err := entry.timeField(i.TimeField, i.Format)
+			if err != nil {
+				return
+			}
+			elapsed := t.Sub(last)
+			if elapsed < 0 {
+				elapsed = 0
+			}
+			weight = 1 - math.Exp(-float64(elapsed)/float64(i.Window))
+			last = t
+		}
+		if !started {
+			average = value
+			started = true
+			return
+		}
+		average += weight * (value - average)
+	}
+	return func(entry *Entry) *Entry {
+		if value, err := entry.FloatField(i.Field); err == nil {
+			add(entry, value)
+		}
+		if started {
+			entry.SetField(target, formatValue(average))
+		}
+		return entry
+	}
+}
+
+// Reducer interface too. Go through input and set the average of this run
+// on each Entry.
+func (i *EWMA) Reduce(input chan *Entry, output chan *Entry) {
+	reduceFilter(i.newFilter(), input, output)
+}
+
+// How MultiValue filter combines the field values.
+type MultiValueMode int
+
+const (
+	// Keep the last value, e.g. the upstream which sent the response.
+	MultiValueLast MultiValueMode = iota
+	// Keep the first value.
+	MultiValueFirst
+	// Sum the values, e.g. the total time spent in upstreams.
+	MultiValueSum
+	// Keep the field as it is and set each value as the indexed field,
+	// e.g. upstream_addr_0, upstream_addr_1 and upstream_addr_count.
+	MultiValueSplit
+)
+
+// Implements Filter interface to turn the multi-value fields, like
+// $upstream_addr or $upstream_response_time (see Entry.Values), into the
+// single values, so Sum, Avg and GroupBy handle them correctly. Note that it
+// sets the fields on the given Entry.
+type MultiValue struct {
+	Fields []string
+	Mode   MultiValueMode
+}
+
+// Replace the fields values according to the Mode. Entries are always
+// passed, missing fields are skipped.
+func (i *MultiValue) Filter(entry *Entry) *Entry {
+	for _, name := range i.Fields {
+		values, err := entry.Values(name)
+		if err != nil {
+			continue
+		}
+		switch i.Mode {
+		case MultiValueLast:
+			entry.SetField(name, values[len(values)-1])
+		case MultiValueFirst:
+			entry.SetField(name, values[0])
+		case MultiValueSum:
+			numbers, err := entry.FloatValues(name)
+			if err != nil {
+				continue
+			}
+			var total float64
+			for _, value := range numbers {
+				total += value
+			}
+			entry.SetField(name, strconv.FormatFloat(total, 'f', -1, 64))
+		case MultiValueSplit:
+			for j, value := range values {
+				entry.SetField(name+"_"+strconv.Itoa(j), value)
+			}
+			entry.SetUintField(name+"_count", uint64(len(values)))
+		}
+	}
+	return entry
+}
+
+// Reducer interface too. Go through input and apply Filter.
+func (i *MultiValue) Reduce(input chan *Entry, output chan *Entry) {
+	for entry := range input {
+		output <- i.Filter(entry)
+	}
+	close(output)
+}
+
+// Implements Filter interface to label numeric latency field values with
+// human-friendly duration classes, e.g. "<50ms", "50–200ms", "200ms–1s" and
+// ">1s". Use it in the Pipeline before GroupBy to get latency-class
+// breakdowns. Note that it sets the label field on the given Entry.
+type DurationClass struct {
+	// Latency field name, values are in seconds as nginx $request_time.
+	Field string
+	// Ascending class boundaries, 50ms, 200ms and 1s by default.
+	Thresholds []time.Duration
+	// Optional custom labels, one more than thresholds.
+	Labels []string
+	// Label field name, Field with "_class" suffix by default.
+	Target string
+}
+
+var defaultDurationThresholds = []time.Duration{
+	50 * time.Millisecond, 200 * time.Millisecond, time.Second,
+}
+
+// Set duration class label field. Entries without a valid latency value are
+// passed through unlabeled.
+func (r *DurationClass) Filter(entry *Entry) *Entry {
+	d, err := entry.DurationField(r.Field)
+	if err != nil {
+		return entry
+	}
+	target := r.Target
+	if target == "" {
+		target = r.Field + "_class"
+	}
+	entry.SetField(target, r.Label(d))
+	return entry
+}
+
+// Reducer interface too. Go through input and label each Entry.
+func (r *DurationClass) Reduce(input chan *Entry, output chan *Entry) {
+	for entry := range input {
+		output <- r.Filter(entry)
+	}
+	close(output)
+}
+
+// Label returns the class label for the given duration.
+func (r *DurationClass) Label(d time.Duration) string {
+	thresholds := r.Thresholds
+	if len(thresholds) == 0 {
+		thresholds = defaultDurationThresholds
+	}
+	i := 0
+	for i < len(thresholds) && d >= thresholds[i] {
+		i++
+	}
+	if len(r.Labels) == len(thresholds)+1 {
+		return r.Labels[i]
+	}
+	switch i {
+	case 0:
+		return "<" + shortDuration(thresholds[0])
+	case len(thresholds):
+		return ">" + shortDuration(thresholds[i-1])
+	}
+	lower, upper := shortDuration(thresholds[i-1]), shortDuration(thresholds[i])
+	if unit := durationUnit(upper); durationUnit(lower) == unit {
+		lower = strings.TrimSuffix(lower, unit)
+	}
+	return lower + "–" + upper
+}
+
+var durationUnits = []struct {
+	name string
+	unit time.Duration
+}{
+	{"h", time.Hour},
+	{"m", time.Minute},
+	{"s", time.Second},
+	{"ms", time.Millisecond},
+	{"µs", time.Microsecond},
+	{"ns", time.Nanosecond},
+}
+
+// Format duration with the largest unit it fits, e.g. 200ms, 1.5s or 2m.
+func shortDuration(d time.Duration) string {
+	for _, u := range durationUnits {
+		if d >= u.unit || u.unit == time.Nanosecond {
+			return strconv.FormatFloat(float64(d)/float64(u.unit), 'f', -1, 64) + u.name
+		}
+	}
+	return ""
+}
+
+func durationUnit(formatted string) string {
+	return strings.TrimLeft(formatted, "0123456789.")
 }
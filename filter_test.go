@@ -2,6 +2,7 @@ package gonx
 
 import (
 	. "github.com/smartystreets/goconvey/convey"
+	"regexp"
 	"testing"
 	"time"
 )
@@ -46,6 +47,7 @@ func TestFilter(t *testing.T) {
 
 				// entry's timestamp meets filter condition
 				So(filter.Filter(feb), ShouldEqual, feb)
+				So(filter.Filter(may), ShouldEqual, may)
 			})
 
 			Convey("End only", func() {
@@ -61,6 +63,18 @@ func TestFilter(t *testing.T) {
 				// entry is out of datetime range
 				So(filter.Filter(may), ShouldBeNil)
 			})
+
+			Convey("Inclusive end", func() {
+				filter := &Datetime{
+					Field:      "timestamp",
+					Format:     time.RFC3339,
+					Start:      start,
+					End:        end,
+					IncludeEnd: true,
+				}
+				So(filter.Filter(may), ShouldEqual, may)
+				So(filter.Filter(jan), ShouldBeNil)
+			})
 		})
 
 		Convey("Deal with input channel", func() {
@@ -99,6 +113,20 @@ func TestFilter(t *testing.T) {
 				So(results, ShouldResemble, expected)
 			})
 
+			Convey("Stop after end", func() {
+				filter.Start = time.Time{}
+				filter.End = time.Date(2015, time.March, 3, 3, 3, 3, 0, time.UTC)
+				filter.StopAfterEnd = true
+				filter.Reduce(input, output)
+
+				results := []string{}
+				for result := range output {
+					results = append(results, result.Fields()["foo"])
+				}
+				So(results, ShouldResemble, []string{"12", "34"})
+				So(input, ShouldBeEmpty)
+			})
+
 			Convey("Filter channel", func() {
 				chain := NewChain(filter, &Avg{[]string{"foo"}}, &Count{})
 				chain.Reduce(input, output)
@@ -119,4 +147,325 @@ func TestFilter(t *testing.T) {
 			})
 		})
 	})
+
+	Convey("Test DurationClass filter", t, func() {
+		filter := &DurationClass{Field: "request_time"}
+
+		Convey("Default labels", func() {
+			So(filter.Label(10*time.Millisecond), ShouldEqual, "<50ms")
+			So(filter.Label(50*time.Millisecond), ShouldEqual, "50–200ms")
+			So(filter.Label(500*time.Millisecond), ShouldEqual, "200ms–1s")
+			So(filter.Label(3*time.Second), ShouldEqual, ">1s")
+		})
+
+		Convey("Custom thresholds and labels", func() {
+			filter.Thresholds = []time.Duration{1500 * time.Millisecond, 2 * time.Minute}
+			So(filter.Label(time.Second), ShouldEqual, "<1.5s")
+			So(filter.Label(time.Minute), ShouldEqual, "1.5s–2m")
+
+			filter.Labels = []string{"fast", "slow", "timeout"}
+			So(filter.Label(time.Hour), ShouldEqual, "timeout")
+		})
+
+		Convey("Label entries", func() {
+			entry := filter.Filter(NewEntry(Fields{"request_time": "0.120"}))
+			So(entry, ShouldNotBeNil)
+			label, err := entry.Field("request_time_class")
+			So(err, ShouldBeNil)
+			So(label, ShouldEqual, "50–200ms")
+
+			filter.Target = "latency"
+			entry = filter.Filter(NewEntry(Fields{"request_time": "-"}))
+			So(entry, ShouldNotBeNil)
+			_, err = entry.Field("latency")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test Sample filter", t, func() {
+		sample := func(filter Filter) (passed int) {
+			for i := 0; i < 1000; i++ {
+				if filter.Filter(NewEmptyEntry()) != nil {
+					passed++
+				}
+			}
+			return
+		}
+
+		Convey("Pass entries with the rate probability", func() {
+			passed := sample(&Sample{Rate: 0.1, Seed: 42})
+			So(passed, ShouldBeBetween, 50, 150)
+			So(sample(&Sample{Rate: 0}), ShouldEqual, 0)
+			So(sample(&Sample{Rate: 1}), ShouldEqual, 1000)
+		})
+
+		Convey("Reproduce sample with the same seed", func() {
+			first := &Sample{Rate: 0.5, Seed: 42}
+			second := &Sample{Rate: 0.5, Seed: 42}
+			for i := 0; i < 100; i++ {
+				entry := NewEmptyEntry()
+				So(first.Filter(entry), ShouldEqual, second.Filter(entry))
+			}
+		})
+
+		Convey("Reproduce sample of each Reduce run", func() {
+			filter := &Sample{Rate: 0.5, Seed: 42}
+			reduce := func() (passed []*Entry) {
+				input := make(chan *Entry, 100)
+				output := make(chan *Entry, 100)
+				for i := 0; i < 100; i++ {
+					entry := NewEmptyEntry()
+					entry.SetUintField("id", uint64(i))
+					input <- entry
+				}
+				close(input)
+				filter.Reduce(input, output)
+				for entry := range output {
+					passed = append(passed, entry)
+				}
+				return
+			}
+			So(reduce(), ShouldResemble, reduce())
+		})
+	})
+
+	Convey("Test MultiValue filter", t, func() {
+		entry := func() *Entry {
+			return NewEntry(Fields{
+				"upstream_addr":          "192.168.1.1:80, 192.168.1.2:80 : 192.168.10.1:80",
+				"upstream_response_time": "0.005, 0.020 : 0.010",
+			})
+		}
+
+		Convey("Keep the last value", func() {
+			filter := &MultiValue{Fields: []string{"upstream_addr", "missing"}}
+			result := filter.Filter(entry())
+			So(result.Fields()["upstream_addr"], ShouldEqual, "192.168.10.1:80")
+			_, err := result.Field("missing")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Keep the first value", func() {
+			filter := &MultiValue{Fields: []string{"upstream_addr"}, Mode: MultiValueFirst}
+			So(filter.Filter(entry()).Fields()["upstream_addr"], ShouldEqual, "192.168.1.1:80")
+		})
+
+		Convey("Sum the values", func() {
+			filter := &MultiValue{Fields: []string{"upstream_response_time"}, Mode: MultiValueSum}
+			So(filter.Filter(entry()).Fields()["upstream_response_time"], ShouldEqual, "0.035")
+		})
+
+		Convey("Split the values", func() {
+			filter := &MultiValue{Fields: []string{"upstream_addr"}, Mode: MultiValueSplit}
+			fields := filter.Filter(entry()).Fields()
+			So(fields["upstream_addr_0"], ShouldEqual, "192.168.1.1:80")
+			So(fields["upstream_addr_2"], ShouldEqual, "192.168.10.1:80")
+			So(fields["upstream_addr_count"], ShouldEqual, "3")
+		})
+	})
+
+	Convey("Test Predicate filter", t, func() {
+		filter := &Predicate{func(entry *Entry) bool {
+			status, err := entry.IntField("status")
+			return err == nil && status >= 500
+		}}
+
+		Convey("Filter Entry", func() {
+			So(filter.Filter(NewEntry(Fields{"status": "502"})), ShouldNotBeNil)
+			So(filter.Filter(NewEntry(Fields{"status": "200"})), ShouldBeNil)
+			So(filter.Filter(NewEntry(Fields{"status": "-"})), ShouldBeNil)
+		})
+
+		Convey("Reduce channel", func() {
+			input := make(chan *Entry, 3)
+			output := make(chan *Entry, 3)
+			for _, status := range []string{"500", "404", "503"} {
+				input <- NewEntry(Fields{"status": status})
+			}
+			close(input)
+			filter.Reduce(input, output)
+			var statuses []string
+			for entry := range output {
+				statuses = append(statuses, entry.Fields()["status"])
+			}
+			So(statuses, ShouldResemble, []string{"500", "503"})
+		})
+	})
+
+	Convey("Test MatchFilter filter", t, func() {
+		api := NewEntry(Fields{"request": "GET /api/users HTTP/1.1"})
+		static := NewEntry(Fields{"request": "GET /static/app.js HTTP/1.1"})
+		missing := NewEmptyEntry()
+
+		Convey("Include matching entries", func() {
+			filter, err := NewMatchFilter("request", `^GET /api/`)
+			So(err, ShouldBeNil)
+			So(filter.Filter(api), ShouldEqual, api)
+			So(filter.Filter(static), ShouldBeNil)
+			So(filter.Filter(missing), ShouldBeNil)
+		})
+
+		Convey("Exclude matching entries", func() {
+			filter, err := NewMatchFilter("request", `^GET /api/`)
+			So(err, ShouldBeNil)
+			filter.Exclude = true
+			So(filter.Filter(api), ShouldBeNil)
+			So(filter.Filter(static), ShouldEqual, static)
+			So(filter.Filter(missing), ShouldEqual, missing)
+		})
+
+		Convey("Invalid pattern", func() {
+			_, err := NewMatchFilter("request", `(`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Nil regexp", func() {
+			filter := &MatchFilter{Field: "request"}
+			So(filter.Filter(api), ShouldBeNil)
+		})
+
+		Convey("Reduce channel", func() {
+			input := make(chan *Entry, 3)
+			output := make(chan *Entry, 3)
+			input <- api
+			input <- static
+			input <- missing
+			close(input)
+			(&MatchFilter{Field: "request", Regexp: regexp.MustCompile(`\.js `)}).Reduce(input, output)
+			So(<-output, ShouldEqual, static)
+			_, ok := <-output
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Test Dedup filter", t, func() {
+		ids := func(filter *Dedup, values ...string) (passed []string) {
+			for _, value := range values {
+				entry := NewEntry(Fields{"request_id": value})
+				if value == "" {
+					entry = NewEmptyEntry()
+				}
+				if filter.Filter(entry) != nil {
+					passed = append(passed, value)
+				}
+			}
+			return
+		}
+
+		Convey("Drop all seen keys", func() {
+			filter := &Dedup{Fields: []string{"request_id"}}
+			So(ids(filter, "a", "b", "a", "c", "b", "", ""), ShouldResemble, []string{"a", "b", "c", "", ""})
+		})
+
+		Convey("Drop recently seen keys", func() {
+			filter := &Dedup{Fields: []string{"request_id"}, Size: 2}
+			So(ids(filter, "a", "b", "a", "c", "a", "b"), ShouldResemble, []string{"a", "b", "c", "b"})
+		})
+
+		Convey("Reduce channel", func() {
+			input := make(chan *Entry, 3)
+			output := make(chan *Entry, 3)
+			for _, id := range []string{"a", "a", "b"} {
+				input <- NewEntry(Fields{"request_id": id})
+			}
+			close(input)
+			(&Dedup{Fields: []string{"request_id"}}).Reduce(input, output)
+			So(output, ShouldHaveLength, 2)
+		})
+
+		Convey("Drop duplicates within each group", func() {
+			input := make(chan *Entry, 6)
+			output := make(chan *Entry, 2)
+			for _, fields := range []Fields{
+				{"host": "a.com", "request_id": "1"},
+				{"host": "b.com", "request_id": "1"},
+				{"host": "a.com", "request_id": "1"},
+				{"host": "b.com", "request_id": "2"},
+				{"host": "a.com", "request_id": "2"},
+				{"host": "b.com", "request_id": "2"},
+			} {
+				input <- NewEntry(fields)
+			}
+			close(input)
+			dedup := &Dedup{Fields: []string{"request_id"}}
+			NewGroupBy([]string{"host"}, dedup, new(Count)).Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"host": "a.com", "count": "2"})
+			So((<-output).Fields(), ShouldResemble, Fields{"host": "b.com", "count": "2"})
+		})
+
+		Convey("Reset seen keys between runs", func() {
+			dedup := &Dedup{Fields: []string{"request_id"}}
+			for i := 0; i < 2; i++ {
+				input := make(chan *Entry, 1)
+				output := make(chan *Entry, 1)
+				input <- NewEntry(Fields{"request_id": "a"})
+				close(input)
+				dedup.Reduce(input, output)
+				So(output, ShouldHaveLength, 1)
+			}
+		})
+	})
+
+	Convey("Test EWMA filter", t, func() {
+		Convey("Weight values with alpha", func() {
+			filter := &EWMA{Field: "request_time", Alpha: 0.5}
+			var averages []string
+			for _, value := range []string{"1", "3", "invalid", "1"} {
+				entry := filter.Filter(NewEntry(Fields{"request_time": value}))
+				averages = append(averages, entry.Fields()["request_time_ewma"])
+			}
+			So(averages, ShouldResemble, []string{"1", "2", "2", "1.5"})
+		})
+
+		Convey("No average before the first value", func() {
+			filter := &EWMA{Field: "request_time", Target: "trend"}
+			entry := filter.Filter(NewEntry(Fields{"request_time": "x"}))
+			_, err := entry.Field("trend")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Weight values by time", func() {
+			filter := &EWMA{Field: "request_time", Window: time.Minute, TimeField: "time_local"}
+			filter.Filter(NewEntry(Fields{"request_time": "1", "time_local": "08/Nov/2013:13:00:00 +0000"}))
+			// The same time has no weight
+			entry := filter.Filter(NewEntry(Fields{"request_time": "5", "time_local": "08/Nov/2013:13:00:00 +0000"}))
+			So(entry.Fields()["request_time_ewma"], ShouldEqual, "1")
+			entry = filter.Filter(NewEntry(Fields{"request_time": "5", "time_local": "08/Nov/2013:14:00:00 +0000"}))
+			average, _ := entry.FloatField("request_time_ewma")
+			So(average, ShouldAlmostEqual, 5, 0.0001)
+		})
+
+		Convey("Reduce channel", func() {
+			input := make(chan *Entry, 2)
+			output := make(chan *Entry, 2)
+			input <- NewEntry(Fields{"request_time": "2"})
+			input <- NewEntry(Fields{"request_time": "4"})
+			close(input)
+			(&EWMA{Field: "request_time"}).Reduce(input, output)
+			So((<-output).Fields()["request_time_ewma"], ShouldEqual, "2")
+			So((<-output).Fields()["request_time_ewma"], ShouldEqual, "2.2")
+		})
+
+		Convey("Average within each group", func() {
+			input := make(chan *Entry, 4)
+			output := make(chan *Entry, 4)
+			for _, fields := range []Fields{
+				{"host": "a.com", "request_time": "1"},
+				{"host": "b.com", "request_time": "9"},
+				{"host": "a.com", "request_time": "1"},
+				{"host": "b.com", "request_time": "9"},
+			} {
+				input <- NewEntry(fields)
+			}
+			close(input)
+			groupBy := NewGroupBy([]string{"host"}, &EWMA{Field: "request_time"})
+			groupBy.Flatten = true
+			groupBy.Reduce(input, output)
+			var averages []string
+			for entry := range output {
+				averages = append(averages, entry.Fields()["request_time_ewma"])
+			}
+			So(averages, ShouldResemble, []string{"1", "1", "9", "9"})
+		})
+	})
 }
@@ -0,0 +1,80 @@
+package gonx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GoAccess log-format specifiers and the gonx field names they are stored
+// as. Fields skipped with %^ are the "_" variables, which are not set.
+var goAccessFields = map[byte]string{
+	'x': "datetime",
+	'd': "date",
+	't': "time",
+	'v': "server_name",
+	'e': "remote_user",
+	'C': "upstream_cache_status",
+	'h': "remote_addr",
+	'r': "request",
+	'm': "request_method",
+	'U': "request_uri",
+	'q': "query_string",
+	'H': "server_protocol",
+	's': "status",
+	'b': "body_bytes_sent",
+	'R': "http_referer",
+	'u': "http_user_agent",
+	'K': "ssl_protocol",
+	'k': "ssl_cipher",
+	'M': "sent_http_content_type",
+	'D': "request_time_us",
+	'T': "request_time",
+	'L': "request_time_ms",
+	'^': "_",
+}
+
+// GoAccess predefined log formats.
+var goAccessFormats = map[string]string{
+	"COMBINED":  `%h %^[%d:%t %^] "%r" %s %b "%R" "%u"`,
+	"VCOMBINED": `%v:%^ %h %^[%d:%t %^] "%r" %s %b "%R" "%u"`,
+	"COMMON":    `%h %^[%d:%t %^] "%r" %s %b`,
+	"VCOMMON":   `%v:%^ %h %^[%d:%t %^] "%r" %s %b`,
+}
+
+// GoAccessFormat translates the GoAccess log-format specification, e.g.
+// `%h %^[%d:%t %^] "%r" %s %b`, or the predefined format name (COMBINED,
+// VCOMBINED, COMMON or VCOMMON) to the gonx format. Date and time are
+// stored as they are, parse them with the GoAccess date-format and
+// time-format.
+func GoAccessFormat(spec string) (string, error) {
+	if predefined, ok := goAccessFormats[spec]; ok {
+		spec = predefined
+	}
+	var format strings.Builder
+	for i := 0; i < len(spec); i++ {
+		if spec[i] != '%' {
+			format.WriteByte(spec[i])
+			continue
+		}
+		if i+1 == len(spec) {
+			return "", fmt.Errorf("log-format specifier is missing at the end of '%v'", spec)
+		}
+		i++
+		name, ok := goAccessFields[spec[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported log-format specifier '%%%c'", spec[i])
+		}
+		format.WriteString("$" + name)
+	}
+	return format.String(), nil
+}
+
+// NewGoAccessParser returns a parser for the GoAccess log-format
+// specification, see GoAccessFormat.
+func NewGoAccessParser(spec string) (*Parser, error) {
+	format, err := GoAccessFormat(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewParser(format), nil
+}
@@ -0,0 +1,40 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGoAccessFormat(t *testing.T) {
+	Convey("Test GoAccess log-format translation", t, func() {
+		Convey("Translate specification", func() {
+			format, err := GoAccessFormat(`%h %^[%d:%t %^] "%r" %s %b "%R" "%u" %T`)
+			So(err, ShouldBeNil)
+			So(format, ShouldEqual, `$remote_addr $_[$date:$time $_] "$request" $status $body_bytes_sent `+
+				`"$http_referer" "$http_user_agent" $request_time`)
+
+			_, err = GoAccessFormat(`%h %~`)
+			So(err, ShouldNotBeNil)
+			_, err = GoAccessFormat(`%h %`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Parse with predefined format", func() {
+			parser, err := NewGoAccessParser("COMBINED")
+			So(err, ShouldBeNil)
+			entry, err := parser.ParseString(`89.234.89.123 - - [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/7.68.0"`)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"remote_addr":     "89.234.89.123",
+				"date":            "08/Nov/2013",
+				"time":            "13:39:18",
+				"request":         "GET / HTTP/1.1",
+				"status":          "200",
+				"body_bytes_sent": "612",
+				"http_referer":    "-",
+				"http_user_agent": "curl/7.68.0",
+			}))
+		})
+	})
+}
@@ -0,0 +1,78 @@
+package gonx
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGrok(t *testing.T) {
+	Convey("Test Grok patterns", t, func() {
+		Convey("Parse with standard pattern", func() {
+			parser, err := NewGrokParser(`^%{COMBINEDAPACHELOG}$`)
+			So(err, ShouldBeNil)
+
+			line := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 ` +
+				`"http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`
+			expected := NewEntry(Fields{
+				"clientip":    "127.0.0.1",
+				"ident":       "-",
+				"auth":        "frank",
+				"timestamp":   "10/Oct/2000:13:55:36 -0700",
+				"verb":        "GET",
+				"request":     "/apache_pb.gif",
+				"httpversion": "1.0",
+				"response":    "200",
+				"bytes":       "2326",
+				"referrer":    `"http://www.example.com/start.html"`,
+				"agent":       `"Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			})
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, expected)
+
+			_, err = parser.ParseString(`GET /api/foo/bar HTTP/1.1`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Parse IPv6 hosts", func() {
+			parser, err := NewGrokParser(`^%{IPORHOST:client} %{INT:status:int}$`)
+			So(err, ShouldBeNil)
+			for _, host := range []string{"2001:db8::ff00:42:8329", "::1", "::ffff:10.0.0.1", "example.com"} {
+				entry, err := parser.ParseString(host + " 200")
+				So(err, ShouldBeNil)
+				So(entry.Fields()["client"], ShouldEqual, host)
+			}
+		})
+
+		Convey("Custom patterns", func() {
+			grok := NewGrok()
+			err := grok.AddPatterns(strings.NewReader(`
+				# Custom patterns file
+				REQUEST_ID [a-f0-9]{16}
+				TRACED %{REQUEST_ID:[trace][id]} (?<duration>\d+)ms
+			`))
+			So(err, ShouldBeNil)
+
+			parser, err := grok.Parser(`%{TRACED}`)
+			So(err, ShouldBeNil)
+			entry, err := parser.ParseString("0123456789abcdef 12ms")
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{"trace_id": "0123456789abcdef", "duration": "12"}))
+		})
+
+		Convey("Invalid patterns", func() {
+			_, err := NewGrokParser(`%{UNKNOWN:foo}`)
+			So(err, ShouldNotBeNil)
+
+			grok := NewGrok()
+			grok.AddPattern("LOOP", `a%{LOOP}`)
+			_, err = grok.Parser(`%{LOOP}`)
+			So(err, ShouldNotBeNil)
+
+			err = grok.AddPatterns(strings.NewReader("BROKEN"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
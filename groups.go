@@ -0,0 +1,429 @@
+package gonx
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// GroupBy groups state.
+type groups interface {
+	has(key string) bool
+	len() int
+	// Create the group with the result entry, the group fields values.
+	create(key string, result *Entry)
+	add(key string, entry *Entry)
+	// Returns the groups results in the group keys order, so the output
+	// order is the same between runs. The spilled groups are written after
+	// these ones, see GroupBy.SpillDir.
+	results(partial bool) []*Entry
+}
+
+// Groups with the reducers Chain goroutine and channels for each group.
+type chainGroups struct {
+	reducers            []Reducer
+	inputCap, outputCap int
+	// Report the reducers panics, see GroupBy.Err.
+	setErr              func(error)
+	chains              map[string]*Chain
+	subInput, subOutput map[string]chan *Entry
+}
+
+func (g *chainGroups) has(key string) bool {
+	_, ok := g.subInput[key]
+	return ok
+}
+
+func (g *chainGroups) len() int {
+	return len(g.subInput)
+}
+
+func (g *chainGroups) create(key string, result *Entry) {
+	g.subInput[key] = make(chan *Entry, g.inputCap)
+	g.subOutput[key] = make(chan *Entry, g.outputCap+1)
+	g.subOutput[key] <- result
+	g.chains[key] = NewChain(g.reducers...)
+	go g.chains[key].Reduce(g.subInput[key], g.subOutput[key])
+}
+
+func (g *chainGroups) add(key string, entry *Entry) {
+	g.subInput[key] <- entry
+}
+
+func (g *chainGroups) results(partial bool) []*Entry {
+	keys := make([]string, 0, len(g.subInput))
+	for key, ch := range g.subInput {
+		close(ch)
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var results []*Entry
+	for _, key := range keys {
+		ch := g.subOutput[key]
+		entry := <-ch
+		entry.Merge(<-ch)
+		if err := g.chains[key].Err(); err != nil {
+			g.setErr(err)
+		}
+		if partial {
+			entry.SetField("partial", "true")
+		}
+		results = append(results, entry)
+	}
+	return results
+}
+
+// Groups with the goroutine and channels for each group reducer, all the
+// results of the reducers are written, see GroupBy.Flatten.
+type flatGroups struct {
+	reducers            []Reducer
+	inputCap, outputCap int
+	// Report the reducers panics, see GroupBy.Err.
+	setErr func(error)
+	groups map[string]*flatGroup
+}
+
+type flatGroup struct {
+	result  *Entry
+	inputs  []chan *Entry
+	results [][]*Entry
+	wg      sync.WaitGroup
+}
+
+func (g *flatGroups) has(key string) bool {
+	_, ok := g.groups[key]
+	return ok
+}
+
+func (g *flatGroups) len() int {
+	return len(g.groups)
+}
+
+func (g *flatGroups) create(key string, result *Entry) {
+	group := &flatGroup{
+		result:  result,
+		inputs:  make([]chan *Entry, len(g.reducers)),
+		results: make([][]*Entry, len(g.reducers)),
+	}
+	for i, reducer := range g.reducers {
+		input := make(chan *Entry, g.inputCap)
+		output := make(chan *Entry, g.outputCap)
+		group.inputs[i] = input
+		go runRecovered(reducer, input, output, g.setErr)
+		// Results are collected concurrently, so the reducers writing them
+		// before the input is closed are not blocked.
+		group.wg.Add(1)
+		go func(i int) {
+			defer group.wg.Done()
+			for entry := range output {
+				group.results[i] = append(group.results[i], entry)
+			}
+		}(i)
+	}
+	g.groups[key] = group
+}
+
+func (g *flatGroups) add(key string, entry *Entry) {
+	for _, input := range g.groups[key].inputs {
+		input <- entry
+	}
+}
+
+func (g *flatGroups) results(partial bool) []*Entry {
+	keys := make([]string, 0, len(g.groups))
+	for key, group := range g.groups {
+		for _, input := range group.inputs {
+			close(input)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var results []*Entry
+	for _, key := range keys {
+		group := g.groups[key]
+		group.wg.Wait()
+		for _, reducerResults := range group.results {
+			for _, result := range reducerResults {
+				entry := group.result.Copy()
+				entry.Merge(result)
+				if partial {
+					entry.SetField("partial", "true")
+				}
+				results = append(results, entry)
+			}
+		}
+	}
+	return results
+}
+
+// Groups aggregated in place, see Aggregator.
+type aggregateGroups struct {
+	aggregators []Aggregator
+	groups      map[string]*aggregateGroup
+}
+
+type aggregateGroup struct {
+	result     *Entry
+	aggregates []Aggregate
+}
+
+func (g *aggregateGroups) has(key string) bool {
+	_, ok := g.groups[key]
+	return ok
+}
+
+func (g *aggregateGroups) len() int {
+	return len(g.groups)
+}
+
+func (g *aggregateGroups) create(key string, result *Entry) {
+	group := &aggregateGroup{result, make([]Aggregate, len(g.aggregators))}
+	for i, aggregator := range g.aggregators {
+		group.aggregates[i] = aggregator.NewAggregate()
+	}
+	g.groups[key] = group
+}
+
+func (g *aggregateGroups) add(key string, entry *Entry) {
+	for _, aggregate := range g.groups[key].aggregates {
+		aggregate.Add(entry)
+	}
+}
+
+func (g *aggregateGroups) results(partial bool) []*Entry {
+	keys := make([]string, 0, len(g.groups))
+	for key := range g.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var results []*Entry
+	for _, key := range keys {
+		group := g.groups[key]
+		// The state is kept by StatefulGroupBy after the results are written
+		entry := group.result.Copy()
+		for _, aggregate := range group.aggregates {
+			entry.Merge(aggregate.Result())
+		}
+		if partial {
+			entry.SetField("partial", "true")
+		}
+		results = append(results, entry)
+	}
+	return results
+}
+
+// Merge the groups of the other run of the same aggregators into these
+// ones, it returns an error if any of the aggregates is not Mergeable.
+func (g *aggregateGroups) merge(other *aggregateGroups) error {
+	for key, group := range other.groups {
+		if !g.has(key) {
+			g.create(key, group.result.Copy())
+		}
+		for i, aggregate := range g.groups[key].aggregates {
+			mergeable, ok := aggregate.(Mergeable)
+			if !ok {
+				return fmt.Errorf("gonx: %T state is not mergeable", g.aggregators[i])
+			}
+			if err := mergeable.Merge(group.aggregates[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Entries sorted by the field values, see GroupBy.OrderBy.
+type orderedEntries struct {
+	entries    []*Entry
+	field      string
+	descending bool
+}
+
+func (s *orderedEntries) Len() int      { return len(s.entries) }
+func (s *orderedEntries) Swap(i, j int) { s.entries[i], s.entries[j] = s.entries[j], s.entries[i] }
+
+func (s *orderedEntries) Less(i, j int) bool {
+	a, errA := s.entries[i].Field(s.field)
+	b, errB := s.entries[j].Field(s.field)
+	if errA != nil || errB != nil {
+		// Entries without the field are the last
+		return errA == nil && errB != nil
+	}
+	if s.descending {
+		a, b = b, a
+	}
+	// Numbers go before the other values, so the order is transitive
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil {
+		return x < y
+	}
+	if errX == nil || errY == nil {
+		return errX == nil
+	}
+	return a < b
+}
+
+// Group key and fields values of the collapsed groups.
+const otherGroup = "__other"
+
+// Limits the number of the distinct groups, see GroupBy.MaxCardinality. The
+// collapsed counts are of the current "__other" group result.
+type cardinalityGuard struct {
+	max     int
+	keys    map[string]bool
+	other   *Entry
+	entries uint64
+	groups  *hyperLogLog
+}
+
+func newCardinalityGuard(max int) *cardinalityGuard {
+	return &cardinalityGuard{max: max, keys: make(map[string]bool)}
+}
+
+// Check the group is within the limit, the first max ones are.
+func (g *cardinalityGuard) admit(key string) bool {
+	if g.keys[key] {
+		return true
+	}
+	if len(g.keys) < g.max {
+		g.keys[key] = true
+		return true
+	}
+	return false
+}
+
+// Returns the "__other" group result.
+func (g *cardinalityGuard) newOther(fields []string, keyField string) *Entry {
+	g.other = NewEmptyEntry()
+	for _, name := range fields {
+		g.other.SetField(name, otherGroup)
+	}
+	if keyField != "" {
+		g.other.SetField(keyField, otherGroup)
+	}
+	g.entries = 0
+	g.groups = newHyperLogLog(0)
+	return g.other
+}
+
+// Count the entry of the collapsed group.
+func (g *cardinalityGuard) collapse(key string) {
+	g.entries++
+	g.groups.add(key)
+}
+
+// Write the collapsed counts to the "__other" group result before it is
+// flushed, the guard could be nil.
+func (g *cardinalityGuard) report() {
+	g.update()
+	if g != nil {
+		g.other = nil
+	}
+}
+
+// Write the collapsed counts to the "__other" group result, which is kept
+// after it is written, see GroupBy.Cumulative.
+func (g *cardinalityGuard) update() {
+	if g == nil || g.other == nil {
+		return
+	}
+	g.other.SetUintField("collapsed_groups", g.groups.count())
+	g.other.SetUintField("collapsed_entries", g.entries)
+}
+
+// Spilled entry, the typed times, the time layout and the raw line are kept
+// with the fields.
+type spilledEntry struct {
+	Fields Fields               `json:"fields"`
+	Times  map[string]time.Time `json:"times,omitempty"`
+	Layout string               `json:"layout,omitempty"`
+	Raw    string               `json:"raw,omitempty"`
+}
+
+// Temporary file of the JSON encoded entries, see GroupBy.SpillDir.
+type spillFile struct {
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	// First error of the file, the background read one is set before the
+	// entries channel is closed.
+	err error
+}
+
+func newSpillFile(dir string) (*spillFile, error) {
+	file, err := ioutil.TempFile(dir, "gonx-groupby-")
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+	return &spillFile{file: file, writer: writer, encoder: json.NewEncoder(writer)}, nil
+}
+
+func (s *spillFile) write(entry *Entry) error {
+	spilled := spilledEntry{entry.fields, entry.times, entry.layout, entry.raw}
+	if err := s.encoder.Encode(spilled); err != nil {
+		return fmt.Errorf("gonx: GroupBy spill write: %v", err)
+	}
+	return nil
+}
+
+// Returns the channel of the written entries, they are read from the file
+// in the background as far as they are written. The channel is closed on
+// the write or read error too, check readErr when it is.
+func (s *spillFile) entries(capacity int) chan *Entry {
+	entries := make(chan *Entry, capacity)
+	if err := s.writer.Flush(); err != nil {
+		s.err = fmt.Errorf("gonx: GroupBy spill write: %v", err)
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		s.err = fmt.Errorf("gonx: GroupBy spill read: %v", err)
+		close(entries)
+		return entries
+	}
+	go func() {
+		defer close(entries)
+		decoder := json.NewDecoder(bufio.NewReader(s.file))
+		for {
+			var spilled spilledEntry
+			err := decoder.Decode(&spilled)
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				if s.err == nil {
+					s.err = fmt.Errorf("gonx: GroupBy spill read: %v", err)
+				}
+				return
+			}
+			entry := NewEmptyEntry()
+			for name, value := range spilled.Fields {
+				entry.fields[name] = value
+			}
+			entry.times = spilled.Times
+			entry.layout = spilled.Layout
+			entry.raw = spilled.Raw
+			entries <- entry
+		}
+	}()
+	return entries
+}
+
+// Returns the first error of the file, call it after the entries channel
+// is closed.
+func (s *spillFile) readErr() error {
+	return s.err
+}
+
+// Close and remove the file.
+func (s *spillFile) remove() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
@@ -0,0 +1,415 @@
+package gonx
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroups(t *testing.T) {
+	Convey("Test GroupBy groups limit", t, func() {
+		input := make(chan *Entry, 10)
+		for _, uri := range []string{"/a", "/b", "/c", "/a", "/d", "/b", "/e"} {
+			input <- NewEntry(Fields{"uri": uri, "bytes": "10"})
+		}
+		close(input)
+		output := make(chan *Entry, 10)
+		results := func() (results []Fields) {
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			return
+		}
+
+		Convey("Flush partial results", func() {
+			groupBy := NewGroupBy([]string{"uri"}, new(Count))
+			groupBy.MaxGroups = 2
+			groupBy.Reduce(input, output)
+			So(results(), ShouldResemble, []Fields{
+				{"uri": "/a", "count": "1", "partial": "true"},
+				{"uri": "/b", "count": "1", "partial": "true"},
+				{"uri": "/a", "count": "1", "partial": "true"},
+				{"uri": "/c", "count": "1", "partial": "true"},
+				{"uri": "/b", "count": "1", "partial": "true"},
+				{"uri": "/d", "count": "1", "partial": "true"},
+				{"uri": "/e", "count": "1", "partial": "true"},
+			})
+		})
+
+		Convey("Spill to disk", func() {
+			dir, err := ioutil.TempDir("", "gonx")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			for _, reducer := range []Reducer{new(Count), NewChain(new(Count))} {
+				input := make(chan *Entry, 10)
+				for _, uri := range []string{"/a", "/b", "/c", "/a", "/d", "/b", "/e", "/c"} {
+					input <- NewEntry(Fields{"uri": uri})
+				}
+				close(input)
+				output = make(chan *Entry, 10)
+				groupBy := NewGroupBy([]string{"uri"}, reducer)
+				groupBy.MaxGroups = 2
+				groupBy.SpillDir = dir
+				groupBy.Reduce(input, output)
+				So(results(), ShouldResemble, []Fields{
+					{"uri": "/a", "count": "2"},
+					{"uri": "/b", "count": "2"},
+					{"uri": "/c", "count": "2"},
+					{"uri": "/d", "count": "1"},
+					{"uri": "/e", "count": "1"},
+				})
+				So(groupBy.Err(), ShouldBeNil)
+				files, _ := ioutil.ReadDir(dir)
+				So(files, ShouldBeEmpty)
+			}
+		})
+
+		Convey("Spill typed time fields", func() {
+			dir, err := ioutil.TempDir("", "gonx")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			input := make(chan *Entry, 10)
+			for i, uri := range []string{"/a", "/b", "/a", "/b"} {
+				entry := NewEntry(Fields{"uri": uri})
+				// The string value is not parsed back with the layout
+				t := time.Date(2013, time.November, 8+i, 13, 39, 18, 0, time.UTC)
+				entry.SetTimeField("time", t, "15:04")
+				input <- entry
+			}
+			close(input)
+			output = make(chan *Entry, 10)
+			groupBy := NewGroupBy([]string{"uri"}, NewGroupByTime("time", 24*time.Hour, new(Count)))
+			groupBy.Flatten = true
+			groupBy.MaxGroups = 1
+			groupBy.SpillDir = dir
+			groupBy.Reduce(input, output)
+			So(results(), ShouldResemble, []Fields{
+				{"uri": "/a", "time": "2013-11-08T00:00:00Z", "count": "1"},
+				{"uri": "/a", "time": "2013-11-10T00:00:00Z", "count": "1"},
+				{"uri": "/b", "time": "2013-11-09T00:00:00Z", "count": "1"},
+				{"uri": "/b", "time": "2013-11-11T00:00:00Z", "count": "1"},
+			})
+			So(groupBy.Err(), ShouldBeNil)
+		})
+
+		Convey("Flush partial results if spill file cannot be created", func() {
+			groupBy := NewGroupBy([]string{"uri"}, new(Count))
+			groupBy.MaxGroups = 4
+			groupBy.SpillDir = "/nonexistent/gonx"
+			groupBy.Reduce(input, output)
+			So(results(), ShouldHaveLength, 5)
+		})
+	})
+
+	Convey("Test GroupBy aggregates in place", t, func() {
+		input := make(chan *Entry, 1000)
+		for i := 0; i < 1000; i++ {
+			input <- NewEntry(Fields{"uri": "/" + strconv.Itoa(i%10), "bytes": strconv.Itoa(i)})
+		}
+		close(input)
+		groupBy := NewGroupBy([]string{"uri"}, new(Count), &Sum{[]string{"bytes"}})
+		groups := groupBy.newGroups(0, 0)
+		So(groups, ShouldHaveSameTypeAs, &aggregateGroups{})
+		So(NewGroupBy(nil, new(Distinct)).newGroups(0, 0), ShouldHaveSameTypeAs, &chainGroups{})
+
+		output := make(chan *Entry, 10)
+		groupBy.Reduce(input, output)
+		So((<-output).Fields(), ShouldResemble, Fields{"uri": "/0", "count": "100", "bytes": "49500.00"})
+		So(output, ShouldHaveLength, 9)
+	})
+	Convey("Test GroupBy incremental emission", t, func() {
+		output := make(chan *Entry, 10)
+		results := func() (results []Fields) {
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			return
+		}
+
+		Convey("Emit every N entries", func() {
+			input := make(chan *Entry, 10)
+			for _, uri := range []string{"/a", "/b", "/a", "/a", "/b"} {
+				input <- NewEntry(Fields{"uri": uri})
+			}
+			close(input)
+			groupBy := NewGroupBy([]string{"uri"}, new(Count))
+			groupBy.EmitEvery = 3
+			groupBy.Reduce(input, output)
+			So(results(), ShouldResemble, []Fields{
+				{"uri": "/a", "count": "2", "partial": "true"},
+				{"uri": "/b", "count": "1", "partial": "true"},
+				{"uri": "/a", "count": "1", "partial": "true"},
+				{"uri": "/b", "count": "1", "partial": "true"},
+			})
+		})
+
+		Convey("Emit cumulative results", func() {
+			input := make(chan *Entry, 10)
+			for _, uri := range []string{"/a", "/b", "/a", "/a", "/b", "/c", "/c"} {
+				input <- NewEntry(Fields{"uri": uri})
+			}
+			close(input)
+			groupBy := NewGroupBy([]string{"uri"}, new(Count))
+			groupBy.EmitEvery = 3
+			groupBy.Cumulative = true
+			groupBy.MaxCardinality = 2
+			groupBy.Reduce(input, output)
+			So(results(), ShouldResemble, []Fields{
+				{"uri": "/a", "count": "2", "partial": "true"},
+				{"uri": "/b", "count": "1", "partial": "true"},
+				{"uri": "/a", "count": "3", "partial": "true"},
+				{"uri": "/b", "count": "2", "partial": "true"},
+				{"uri": "__other", "count": "1", "collapsed_groups": "1", "collapsed_entries": "1", "partial": "true"},
+				{"uri": "/a", "count": "3"},
+				{"uri": "/b", "count": "2"},
+				{"uri": "__other", "count": "2", "collapsed_groups": "1", "collapsed_entries": "2"},
+			})
+			So(groupBy.Err(), ShouldBeNil)
+		})
+
+		Convey("Emit deltas of the non-aggregators", func() {
+			input := make(chan *Entry, 10)
+			for _, uri := range []string{"/a", "/b", "/a", "/a", "/b"} {
+				input <- NewEntry(Fields{"uri": uri})
+			}
+			close(input)
+			groupBy := NewGroupBy([]string{"uri"}, NewChain(new(Count)))
+			groupBy.EmitEvery = 3
+			groupBy.Cumulative = true
+			groupBy.Reduce(input, output)
+			So(results(), ShouldResemble, []Fields{
+				{"uri": "/a", "count": "2", "partial": "true"},
+				{"uri": "/b", "count": "1", "partial": "true"},
+				{"uri": "/a", "count": "1", "partial": "true"},
+				{"uri": "/b", "count": "1", "partial": "true"},
+			})
+			So(groupBy.Err(), ShouldNotBeNil)
+		})
+
+		Convey("Merge deltas downstream", func() {
+			input := make(chan *Entry, 10)
+			for _, uri := range []string{"/a", "/b", "/a", "/a", "/b"} {
+				input <- NewEntry(Fields{"uri": uri})
+			}
+			close(input)
+			groupBy := NewGroupBy([]string{"uri"}, new(Count))
+			groupBy.EmitEvery = 3
+			totals := NewGroupBy([]string{"uri"}, &Sum{[]string{"count"}})
+			totals.EmitEvery = 1
+			totals.Cumulative = true
+			NewPipeline(groupBy, totals).Reduce(input, output)
+			var last Fields
+			for _, fields := range results() {
+				last = fields
+			}
+			So(last, ShouldResemble, Fields{"uri": "/b", "count": "2.00"})
+		})
+
+		Convey("Emit every interval", func() {
+			input := make(chan *Entry)
+			groupBy := NewGroupBy([]string{"uri"}, NewChain(new(Count)))
+			groupBy.EmitInterval = 10 * time.Millisecond
+			go groupBy.Reduce(input, output)
+			input <- NewEntry(Fields{"uri": "/a"})
+			input <- NewEntry(Fields{"uri": "/a"})
+			So((<-output).Fields(), ShouldResemble, Fields{"uri": "/a", "count": "2", "partial": "true"})
+			input <- NewEntry(Fields{"uri": "/b"})
+			close(input)
+			So(results(), ShouldResemble, []Fields{{"uri": "/b", "count": "1", "partial": "true"}})
+		})
+	})
+
+	Convey("Test GroupBy flattened results", t, func() {
+		input := make(chan *Entry, 10)
+		for _, fields := range []Fields{
+			{"host": "a.com", "uri": "/a"},
+			{"host": "b.com", "uri": "/c"},
+			{"host": "a.com", "uri": "/b"},
+			{"host": "a.com", "uri": "/a"},
+			{"host": "a.com", "uri": "/c"},
+			{"host": "a.com", "uri": "/b"},
+			{"host": "a.com", "uri": "/a"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		output := make(chan *Entry, 10)
+		var results []Fields
+
+		Convey("Top URIs per host", func() {
+			groupBy := NewGroupBy([]string{"host"}, &TopN{Field: "uri", N: 2})
+			groupBy.Flatten = true
+			groupBy.Reduce(input, output)
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			So(results, ShouldResemble, []Fields{
+				{"host": "a.com", "uri": "/a", "count": "3"},
+				{"host": "a.com", "uri": "/b", "count": "2"},
+				{"host": "b.com", "uri": "/c", "count": "1"},
+			})
+		})
+
+		Convey("Write results of each reducer", func() {
+			groupBy := NewGroupBy([]string{"host"}, new(Count), new(ReadAll))
+			groupBy.Flatten = true
+			groupBy.Reduce(input, output)
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			So(results, ShouldHaveLength, 9)
+			So(results[0], ShouldResemble, Fields{"host": "a.com", "count": "6"})
+			So(results[7], ShouldResemble, Fields{"host": "b.com", "count": "1"})
+			So(results[8], ShouldResemble, Fields{"host": "b.com", "uri": "/c"})
+		})
+	})
+
+	Convey("Test GroupBy cardinality guard", t, func() {
+		input := make(chan *Entry, 10)
+		for _, uri := range []string{"/a", "/b", "/c", "/a", "/d", "/c", "/b"} {
+			input <- NewEntry(Fields{"uri": uri})
+		}
+		close(input)
+		output := make(chan *Entry, 10)
+		var results []Fields
+
+		Convey("Collapse groups over the limit", func() {
+			groupBy := NewGroupBy([]string{"uri"}, new(Count))
+			groupBy.MaxCardinality = 2
+			groupBy.Reduce(input, output)
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			So(results, ShouldResemble, []Fields{
+				{"uri": "/a", "count": "2"},
+				{"uri": "/b", "count": "2"},
+				{"uri": "__other", "count": "3", "collapsed_groups": "2", "collapsed_entries": "3"},
+			})
+		})
+
+		Convey("Collapse groups of the partial results", func() {
+			groupBy := NewGroupBy([]string{"uri"}, NewChain(new(Count)))
+			groupBy.MaxCardinality = 1
+			groupBy.EmitEvery = 5
+			groupBy.Reduce(input, output)
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			So(results, ShouldResemble, []Fields{
+				{"uri": "/a", "count": "2", "partial": "true"},
+				{"uri": "__other", "count": "3", "collapsed_groups": "3", "collapsed_entries": "3", "partial": "true"},
+				{"uri": "__other", "count": "2", "collapsed_groups": "2", "collapsed_entries": "2", "partial": "true"},
+			})
+		})
+	})
+
+	Convey("Test GroupBy results order", t, func() {
+		input := make(chan *Entry, 10)
+		for _, fields := range []Fields{
+			{"uri": "/b", "bytes": "9"},
+			{"uri": "/a", "bytes": "10"},
+			{"uri": "/c", "bytes": "100"},
+			{"uri": "/a", "bytes": "10"},
+			{"uri": "/c", "bytes": "100"},
+			{"uri": "/d"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		output := make(chan *Entry, 10)
+		uris := func() (uris []string) {
+			for entry := range output {
+				uris = append(uris, entry.Fields()["uri"])
+			}
+			return
+		}
+
+		Convey("Order by key", func() {
+			NewGroupBy([]string{"uri"}, new(Count)).Reduce(input, output)
+			So(uris(), ShouldResemble, []string{"/a", "/b", "/c", "/d"})
+		})
+
+		Convey("Order by count descending", func() {
+			groupBy := NewGroupBy([]string{"uri"}, new(Count))
+			groupBy.OrderBy, groupBy.Descending = "count", true
+			groupBy.Reduce(input, output)
+			So(uris(), ShouldResemble, []string{"/a", "/c", "/b", "/d"})
+		})
+
+		Convey("Order by numbers", func() {
+			groupBy := NewGroupBy([]string{"uri"}, NewChain(&Avg{[]string{"bytes"}}))
+			groupBy.OrderBy = "bytes"
+			groupBy.Reduce(input, output)
+			// Results without the field are the last
+			So(uris(), ShouldResemble, []string{"/b", "/a", "/c", "/d"})
+		})
+
+		Convey("Order numbers before other values", func() {
+			entries := []*Entry{
+				NewEntry(Fields{"uri": "/a", "value": "10"}),
+				NewEntry(Fields{"uri": "/b", "value": "abc"}),
+				NewEntry(Fields{"uri": "/c", "value": "9"}),
+				NewEntry(Fields{"uri": "/d", "value": "-"}),
+				NewEntry(Fields{"uri": "/e", "value": "100"}),
+			}
+			sort.Stable(&orderedEntries{entries, "value", false})
+			var ordered []string
+			for _, entry := range entries {
+				ordered = append(ordered, entry.Fields()["uri"])
+			}
+			So(ordered, ShouldResemble, []string{"/c", "/a", "/e", "/d", "/b"})
+		})
+	})
+
+	Convey("Test GroupBy spill file errors", t, func() {
+		dir, err := ioutil.TempDir("", "gonx")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		spill, err := newSpillFile(dir)
+		So(err, ShouldBeNil)
+		defer spill.remove()
+		count := func(entries chan *Entry) (count int) {
+			for range entries {
+				count++
+			}
+			return
+		}
+
+		Convey("Read the entries written before the read error", func() {
+			So(spill.write(NewEntry(Fields{"uri": "/a"})), ShouldBeNil)
+			spill.writer.WriteString("{\"uri\":")
+			So(count(spill.entries(1)), ShouldEqual, 1)
+			So(spill.readErr(), ShouldNotBeNil)
+		})
+
+		Convey("Keep typed times and raw lines", func() {
+			t := time.Date(2013, time.November, 8, 13, 39, 18, 0, time.UTC)
+			entry := NewEntry(Fields{"uri": "/a"})
+			entry.SetTimeField("time", t, "15:04")
+			entry.SetTimeLayout("15:04")
+			entry.raw = "/a 13:39"
+			So(spill.write(entry), ShouldBeNil)
+			read := <-spill.entries(1)
+			So(read.Fields(), ShouldResemble, Fields{"uri": "/a", "time": "13:39"})
+			value, err := read.DefaultTimeField("time")
+			So(err, ShouldBeNil)
+			So(value.Equal(t), ShouldBeTrue)
+			So(read.Raw(), ShouldEqual, "/a 13:39")
+			So(spill.readErr(), ShouldBeNil)
+		})
+
+		Convey("Write error", func() {
+			spill.file.Close()
+			So(spill.write(NewEntry(Fields{"uri": "/a"})), ShouldBeNil)
+			So(count(spill.entries(1)), ShouldEqual, 0)
+			So(spill.readErr(), ShouldNotBeNil)
+		})
+	})
+}
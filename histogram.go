@@ -0,0 +1,101 @@
+package gonx
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Implements Reducer interface to count the Field values distribution, e.g.
+// the response size or the latency. Buckets are the upper bounds of the
+// buckets, the counts are cumulative as in the Prometheus histograms: each
+// bucket counts the values less than or equal to its bound. The result
+// entry has the fields named by the Field:
+//
+//	request_time_bucket_0.05  values <= 0.05
+//	request_time_bucket_0.2   values <= 0.2
+//	request_time_bucket_+Inf  all the values
+//	request_time_sum          sum of the values
+//	request_time_count        number of the values
+//
+// Missing and invalid values are skipped.
+type Histogram struct {
+	Field   string
+	Buckets []float64
+}
+
+// Returns a Histogram of the latency Field in seconds, e.g. nginx
+// $request_time, with the LatencyBuckets from 1ms to 10s.
+func NewLatencyHistogram(field string) *Histogram {
+	return &Histogram{
+		Field:   field,
+		Buckets: LatencyBuckets(time.Millisecond, 10*time.Second),
+	}
+}
+
+// ExponentialBuckets returns count bounds, the first is start and each next
+// one is factor times the previous, e.g. 0.001, 0.002, 0.004 for start
+// 0.001 and factor 2.
+func ExponentialBuckets(start float64, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// LatencyBuckets returns the bounds in seconds from min to max (inclusive)
+// in the 1-2-5 log scale, e.g. 1ms, 2ms, 5ms, 10ms, 20ms, 50ms, 100ms and so
+// on.
+func LatencyBuckets(min time.Duration, max time.Duration) []float64 {
+	var buckets []float64
+	for decade := time.Microsecond; decade <= max; decade *= 10 {
+		for _, step := range []time.Duration{1, 2, 5} {
+			if bound := step * decade; bound >= min && bound <= max {
+				buckets = append(buckets, bound.Seconds())
+			}
+		}
+	}
+	return buckets
+}
+
+// Count the values in the buckets and write the histogram to the output.
+func (r *Histogram) Reduce(input chan *Entry, output chan *Entry) {
+	bounds := append([]float64(nil), r.Buckets...)
+	sort.Float64s(bounds)
+	counts := make([]uint64, len(bounds))
+	var total uint64
+	var sum float64
+	for entry := range input {
+		value, err := entry.FloatField(r.Field)
+		if err != nil {
+			continue
+		}
+		// Only the first matching bucket is counted, the counts are
+		// accumulated below
+		if i := sort.SearchFloat64s(bounds, value); i < len(bounds) {
+			counts[i]++
+		}
+		total++
+		sum += value
+	}
+	entry := NewEmptyEntry()
+	var cumulative uint64
+	for i, bound := range bounds {
+		cumulative += counts[i]
+		entry.SetUintField(HistogramBucket(r.Field, bound), cumulative)
+	}
+	entry.SetUintField(HistogramBucket(r.Field, math.Inf(1)), total)
+	entry.SetField(r.Field+"_sum", formatValue(sum))
+	entry.SetUintField(r.Field+"_count", total)
+	output <- entry
+	close(output)
+}
+
+// HistogramBucket returns the name of the Histogram bucket field, e.g.
+// request_time_bucket_0.05 or request_time_bucket_+Inf.
+func HistogramBucket(field string, bound float64) string {
+	return field + "_bucket_" + strconv.FormatFloat(bound, 'g', -1, 64)
+}
@@ -0,0 +1,53 @@
+package gonx
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHistogram(t *testing.T) {
+	Convey("Test Histogram reducer", t, func() {
+		input := make(chan *Entry, 10)
+		for _, value := range []string{"0.010", "0.050", "0.120", "0.700", "2.5", "-", "invalid"} {
+			input <- NewEntry(Fields{"request_time": value})
+		}
+		close(input)
+		output := make(chan *Entry, 1)
+
+		Convey("Count cumulative buckets", func() {
+			reducer := &Histogram{Field: "request_time", Buckets: []float64{1, 0.05, 0.2}}
+			reducer.Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{
+				"request_time_bucket_0.05": "2",
+				"request_time_bucket_0.2":  "3",
+				"request_time_bucket_1":    "4",
+				"request_time_bucket_+Inf": "5",
+				"request_time_sum":         "3.38",
+				"request_time_count":       "5",
+			})
+		})
+
+		Convey("Generate buckets", func() {
+			So(ExponentialBuckets(0.001, 2, 4), ShouldResemble, []float64{0.001, 0.002, 0.004, 0.008})
+			So(LatencyBuckets(time.Millisecond, 100*time.Millisecond), ShouldResemble,
+				[]float64{0.001, 0.002, 0.005, 0.01, 0.02, 0.05, 0.1})
+			So(LatencyBuckets(3*time.Millisecond, 40*time.Millisecond), ShouldResemble,
+				[]float64{0.005, 0.01, 0.02})
+
+			reducer := NewLatencyHistogram("request_time")
+			So(reducer.Buckets, ShouldHaveLength, 13)
+			reducer.Reduce(input, output)
+			result := <-output
+			So(result.Fields()["request_time_bucket_0.01"], ShouldEqual, "1")
+			So(result.Fields()["request_time_bucket_10"], ShouldEqual, "5")
+		})
+
+		Convey("Bucket names", func() {
+			So(HistogramBucket("bytes", 1e6), ShouldEqual, "bytes_bucket_1e+06")
+			So(HistogramBucket("bytes", math.Inf(1)), ShouldEqual, "bytes_bucket_+Inf")
+		})
+	})
+}
@@ -0,0 +1,133 @@
+package gonx
+
+import (
+	"encoding/base64"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"strings"
+)
+
+// Implements Reducer interface to count the distinct Fields values
+// combinations approximately in the constant memory, e.g. unique visitors
+// per vhost per day over hundreds of millions of lines. The result field is
+// named the same way as the Distinct one, e.g. distinct_remote_addr.
+//
+// It uses the HyperLogLog sketch with 2^Precision registers of one byte,
+// the standard error is 1.04 / sqrt(2^Precision).
+//
+// Sketches are mergeable, so the counts of the partial GroupBy results (see
+// GroupBy.MemoryLimit) or of the different log files could be combined. Set
+// Sketch to write the registers to the result field with the "_sketch"
+// suffix, e.g. distinct_remote_addr_sketch. Input entries with that field
+// are merged into the count, e.g. the unique IPs per URI of the partial
+// results are merged with the Pipeline of GroupBy and GroupBy:
+//
+//	distinct := &ApproxDistinct{Fields: []string{"remote_addr"}, Sketch: true}
+//	NewPipeline(groupBy, NewGroupBy([]string{"request_uri"}, distinct))
+//
+// Sketches of another Precision are skipped.
+type ApproxDistinct struct {
+	Fields []string
+	// Number of the index bits from 4 to 18, 14 by default (16KB of
+	// registers and 0.81% error).
+	Precision uint8
+	// Write the sketch registers encoded with base64 to be merged later.
+	Sketch bool
+}
+
+// Count distinct values, entries without any of the Fields are skipped
+// unless they have the sketch field.
+func (r *ApproxDistinct) Reduce(input chan *Entry, output chan *Entry) {
+	name := "distinct_" + strings.Join(r.Fields, "_")
+	sketch := newHyperLogLog(r.Precision)
+	for entry := range input {
+		if entry.hasFields(r.Fields) {
+			sketch.add(entry.FieldsHash(r.Fields))
+		} else if encoded, err := entry.Field(name + "_sketch"); err == nil {
+			sketch.merge(encoded)
+		}
+	}
+	entry := NewEmptyEntry()
+	entry.SetUintField(name, sketch.count())
+	if r.Sketch {
+		entry.SetField(name+"_sketch", base64.RawStdEncoding.EncodeToString(sketch.registers))
+	}
+	output <- entry
+	close(output)
+}
+
+type hyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func newHyperLogLog(precision uint8) *hyperLogLog {
+	if precision == 0 {
+		precision = 14
+	} else if precision < 4 {
+		precision = 4
+	} else if precision > 18 {
+		precision = 18
+	}
+	return &hyperLogLog{precision, make([]uint8, 1<<precision)}
+}
+
+// Add the value, the first bits of its hash are the register index and the
+// register keeps the maximum position of the first 1 bit of the rest.
+func (h *hyperLogLog) add(value string) {
+	hash := fnv.New64a()
+	io.WriteString(hash, value)
+	x := mix64(hash.Sum64())
+	index := x >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(x<<h.precision|1<<(h.precision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Merge the base64 encoded registers of the sketch with the same precision,
+// each register keeps the maximum of both.
+func (h *hyperLogLog) merge(encoded string) bool {
+	registers, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(registers) != len(h.registers) {
+		return false
+	}
+	for i, rank := range registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+	return true
+}
+
+// Estimate the number of distinct values, small numbers are estimated with
+// the linear counting of the empty registers.
+func (h *hyperLogLog) count() uint64 {
+	m := float64(len(h.registers))
+	var sum float64
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Finalizer of the MurmurHash3, it spreads FNV hash bits evenly, the first
+// bits are used as the register index.
+func mix64(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
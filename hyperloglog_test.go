@@ -0,0 +1,84 @@
+package gonx
+
+import (
+	"encoding/base64"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApproxDistinct(t *testing.T) {
+	Convey("Test approximate distinct count", t, func() {
+		Convey("Estimate cardinality", func() {
+			for _, n := range []int{0, 10, 1000, 100000} {
+				sketch := newHyperLogLog(0)
+				for i := 0; i < n; i++ {
+					// Each value is added twice
+					sketch.add("10.0." + strconv.Itoa(i))
+					sketch.add("10.0." + strconv.Itoa(i))
+				}
+				So(float64(sketch.count()), ShouldAlmostEqual, n, 0.02*float64(n))
+			}
+			So(newHyperLogLog(2).precision, ShouldEqual, 4)
+			So(newHyperLogLog(30).precision, ShouldEqual, 18)
+		})
+
+		Convey("Reduce entries", func() {
+			input := make(chan *Entry, 100)
+			output := make(chan *Entry, 1)
+			go func() {
+				for i := 0; i < 3000; i++ {
+					input <- NewEntry(Fields{"remote_addr": "10.0.0." + strconv.Itoa(i%300)})
+				}
+				input <- NewEntry(Fields{})
+				close(input)
+			}()
+			reducer := &ApproxDistinct{Fields: []string{"remote_addr"}}
+			reducer.Reduce(input, output)
+			count, err := (<-output).FloatField("distinct_remote_addr")
+			So(err, ShouldBeNil)
+			So(count, ShouldAlmostEqual, 300, 3)
+		})
+
+		Convey("Merge sketches", func() {
+			add := func(sketch *hyperLogLog, from, to int) *hyperLogLog {
+				for i := from; i < to; i++ {
+					sketch.add("10.0." + strconv.Itoa(i))
+				}
+				return sketch
+			}
+			first, second := add(newHyperLogLog(10), 0, 600), add(newHyperLogLog(10), 400, 1000)
+			So(first.merge(base64.RawStdEncoding.EncodeToString(second.registers)), ShouldBeTrue)
+			So(first.count(), ShouldEqual, add(newHyperLogLog(10), 0, 1000).count())
+			So(first.merge(base64.RawStdEncoding.EncodeToString(newHyperLogLog(12).registers)), ShouldBeFalse)
+			So(first.merge("invalid!"), ShouldBeFalse)
+		})
+
+		Convey("Merge partial group results", func() {
+			input := make(chan *Entry, 100)
+			output := make(chan *Entry, 10)
+			go func() {
+				for i := 0; i < 2000; i++ {
+					input <- NewEntry(Fields{
+						"request_uri": "/" + strconv.Itoa(i%2),
+						"remote_addr": "10.0.0." + strconv.Itoa(i%500),
+					})
+				}
+				close(input)
+			}()
+			distinct := &ApproxDistinct{Fields: []string{"remote_addr"}, Sketch: true}
+			// Sketches of each address per URI are merged per URI
+			NewPipeline(
+				NewGroupBy([]string{"request_uri", "remote_addr"}, distinct),
+				NewGroupBy([]string{"request_uri"}, distinct),
+			).Reduce(input, output)
+			for _, uri := range []string{"/0", "/1"} {
+				result := <-output
+				So(result.Fields()["request_uri"], ShouldEqual, uri)
+				count, _ := result.FloatField("distinct_remote_addr")
+				So(count, ShouldAlmostEqual, 250, 3)
+			}
+		})
+	})
+}
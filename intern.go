@@ -0,0 +1,40 @@
+package gonx
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Maximum number of names in the nameTable, the names which do not fit are
+// not interned. It protects from the unbounded growth when the names come
+// from the data, e.g. the request headers names.
+const maxInternedNames = 10000
+
+// Field names table shared by the entries of the same parser. Parsers that
+// take the names from the lines (e.g. JSON keys or LTSV labels) intern them,
+// so millions of entries share the same name strings instead of their own
+// copies, which also keep the whole lines in memory.
+type nameTable struct {
+	names sync.Map
+	size  int64
+}
+
+// Return the interned copy of the name. Nil table returns the name as it is.
+func (t *nameTable) intern(name string) string {
+	if t == nil {
+		return name
+	}
+	if interned, ok := t.names.Load(name); ok {
+		return interned.(string)
+	}
+	// Copy the name, it could be a part of the line
+	name = string([]byte(name))
+	if atomic.LoadInt64(&t.size) >= maxInternedNames {
+		return name
+	}
+	interned, loaded := t.names.LoadOrStore(name, name)
+	if !loaded {
+		atomic.AddInt64(&t.size, 1)
+	}
+	return interned.(string)
+}
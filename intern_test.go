@@ -0,0 +1,38 @@
+package gonx
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNameTable(t *testing.T) {
+	Convey("Test field names interning", t, func() {
+		table := new(nameTable)
+		line := "status:200"
+		So(table.intern(line[:6]), ShouldEqual, "status")
+		So(table.intern("status"), ShouldEqual, "status")
+		So(table.size, ShouldEqual, 1)
+
+		Convey("Nil table", func() {
+			var table *nameTable
+			So(table.intern("status"), ShouldEqual, "status")
+		})
+
+		Convey("Limit the table size", func() {
+			for i := 0; i < maxInternedNames+10; i++ {
+				table.intern("name_" + strconv.Itoa(i))
+			}
+			So(table.size, ShouldEqual, maxInternedNames)
+			So(table.intern("name_x"), ShouldEqual, "name_x")
+		})
+
+		Convey("Parsers share the names", func() {
+			parser := NewLTSVParser()
+			parser.ParseString("host:127.0.0.1\tstatus:200")
+			parser.ParseString("host:127.0.0.2\tstatus:404")
+			So(parser.names.size, ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,142 @@
+package gonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JSONParser parses log records written as JSON objects, one object per line.
+// Nested objects are flattened into plain Entry fields.
+type JSONParser struct {
+	// Separator joins the keys of nested objects into a field name.
+	Separator string
+
+	// Fields renames flattened keys. Keys are paths of the nested object
+	// names separated by ">", e.g. "request>headers>User-Agent". A path
+	// ending with ">*" renames all the children of the object: the value
+	// is used as a prefix for the child names converted nginx-style, so
+	// "request>headers>*": "http_" gives "http_user_agent".
+	Fields map[string]string
+
+	names *nameTable
+}
+
+// Returns a new JSONParser, nested keys will be joined with "_".
+func NewJSONParser() *JSONParser {
+	return &JSONParser{Separator: "_", names: new(nameTable)}
+}
+
+// Returns a new JSONParser which keeps the nested keys as dot-separated
+// paths, e.g. {"request": {"headers": {"user_agent": "curl"}}} is stored as
+// the "request.headers.user_agent" field. Use the paths as field names in
+// Field, GroupBy or Sum configuration. Unlike the "_" joined names, paths
+// are not mixed up with the keys which contain "_" themselves.
+func NewNestedJSONParser() *JSONParser {
+	return &JSONParser{Separator: ".", names: new(nameTable)}
+}
+
+// Parse JSON log record. Numbers are kept as they were written, arrays of
+// scalars are joined with ", " and other arrays are kept as JSON strings.
+func (parser *JSONParser) ParseString(line string) (entry *Entry, err error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	var record map[string]interface{}
+	err = decoder.Decode(&record)
+	if err == nil && record == nil {
+		err = fmt.Errorf("not an object")
+	}
+	if err != nil {
+		err = fmt.Errorf("access log line '%v' is not a JSON object: %v", line, err)
+		return
+	}
+	entry = NewEmptyEntry()
+	parser.flatten(entry, nil, record)
+	return
+}
+
+func (parser *JSONParser) flatten(entry *Entry, path []string, object map[string]interface{}) {
+	for key, value := range object {
+		keyPath := make([]string, len(path)+1)
+		copy(keyPath, path)
+		keyPath[len(path)] = key
+		if nested, ok := value.(map[string]interface{}); ok {
+			parser.flatten(entry, keyPath, nested)
+			continue
+		}
+		entry.SetField(parser.names.intern(parser.fieldName(keyPath)), jsonString(value))
+	}
+}
+
+func (parser *JSONParser) fieldName(path []string) string {
+	if name, ok := parser.Fields[strings.Join(path, ">")]; ok {
+		return name
+	}
+	last := len(path) - 1
+	if prefix, ok := parser.Fields[strings.Join(path[:last], ">")+">*"]; ok {
+		return prefix + nginxName(path[last])
+	}
+	return strings.Join(path, parser.Separator)
+}
+
+// MarshalJSON implements json.Marshaler, Entry is encoded as the object of
+// its string fields. Use json.Encoder to write the entries as NDJSON.
+func (entry *Entry) MarshalJSON() ([]byte, error) {
+	if entry.fields == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(entry.fields)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, it replaces the Entry fields
+// with the object ones. Values are converted and nested objects flattened
+// the same way the JSONParser does.
+func (entry *Entry) UnmarshalJSON(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var record map[string]interface{}
+	if err := decoder.Decode(&record); err != nil {
+		return err
+	}
+	if record == nil {
+		return nil
+	}
+	*entry = *NewEmptyEntry()
+	NewJSONParser().flatten(entry, nil, record)
+	return nil
+}
+
+// Converts the JSON value to the Entry field string.
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				raw, _ := json.Marshal(v)
+				return string(raw)
+			}
+			values[i] = jsonString(item)
+		}
+		return strings.Join(values, ", ")
+	}
+	raw, _ := json.Marshal(value)
+	return string(raw)
+}
+
+// Converts HTTP header name to the nginx variable name suffix,
+// e.g. User-Agent to user_agent.
+func nginxName(name string) string {
+	return strings.ToLower(strings.Replace(name, "-", "_", -1))
+}
@@ -0,0 +1,134 @@
+package gonx
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONParser(t *testing.T) {
+	Convey("Test JSON Parser", t, func() {
+		parser := NewJSONParser()
+
+		Convey("Parse flat object", func() {
+			line := `{"remote_addr":"89.234.89.123","status":200,"request_time":0.050,"cached":false,"upstream":null}`
+			expected := NewEntry(Fields{
+				"remote_addr":  "89.234.89.123",
+				"status":       "200",
+				"request_time": "0.050",
+				"cached":       "false",
+				"upstream":     "",
+			})
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, expected)
+		})
+
+		Convey("Flatten nested objects and arrays", func() {
+			line := `{"request":{"uri":"/foo","headers":{"Accept":["text/html","*/*"]}},"tags":[{"a":1}]}`
+			expected := NewEntry(Fields{
+				"request_uri":            "/foo",
+				"request_headers_Accept": "text/html, */*",
+				"tags":                   `[{"a":1}]`,
+			})
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, expected)
+		})
+
+		Convey("Keep nested paths", func() {
+			parser := NewNestedJSONParser()
+			line := `{"request":{"uri":"/foo","headers":{"user_agent":"curl/7.68.0"}},"request_time":0.5}`
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"request.uri":                "/foo",
+				"request.headers.user_agent": "curl/7.68.0",
+				"request_time":               "0.5",
+			}))
+
+			input := make(chan *Entry, 2)
+			output := make(chan *Entry, 2)
+			input <- entry
+			entry, _ = parser.ParseString(`{"request":{"uri":"/foo","headers":{"user_agent":"wget"}},"request_time":1}`)
+			input <- entry
+			close(input)
+			NewGroupBy([]string{"request.uri"}, &Sum{[]string{"request_time"}}).Reduce(input, output)
+			So(<-output, ShouldResemble, NewEntry(Fields{"request.uri": "/foo", "request_time": "1.50"}))
+		})
+
+		Convey("Rename fields", func() {
+			parser.Fields = map[string]string{
+				"request>uri":       "uri",
+				"request>headers>*": "http_",
+			}
+			line := `{"request":{"uri":"/foo","headers":{"User-Agent":["curl/7.68.0"]}}}`
+			expected := NewEntry(Fields{
+				"uri":             "/foo",
+				"http_user_agent": "curl/7.68.0",
+			})
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, expected)
+		})
+
+		Convey("Parse invalid string", func() {
+			_, err := parser.ParseString(`89.234.89.123 "GET /api/foo/bar HTTP/1.1"`)
+			So(err, ShouldNotBeNil)
+
+			_, err = parser.ParseString(`null`)
+			So(err, ShouldNotBeNil)
+
+			_, err = parser.ParseString(`[1, 2]`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEntryJSON(t *testing.T) {
+	Convey("Test Entry JSON marshalling", t, func() {
+		entry := NewEntry(Fields{"remote_addr": "89.234.89.123", "status": "200"})
+
+		Convey("Marshal fields", func() {
+			data, err := json.Marshal(entry)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, `{"remote_addr":"89.234.89.123","status":"200"}`)
+
+			data, err = json.Marshal(&Entry{})
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, `{}`)
+		})
+
+		Convey("Re-ingest NDJSON", func() {
+			var buf bytes.Buffer
+			encoder := json.NewEncoder(&buf)
+			So(encoder.Encode(entry), ShouldBeNil)
+			So(encoder.Encode(NewEntry(Fields{"count": "3"})), ShouldBeNil)
+
+			decoder := json.NewDecoder(&buf)
+			var decoded []*Entry
+			for decoder.More() {
+				result := new(Entry)
+				So(decoder.Decode(result), ShouldBeNil)
+				decoded = append(decoded, result)
+			}
+			So(decoded, ShouldResemble, []*Entry{entry, NewEntry(Fields{"count": "3"})})
+		})
+
+		Convey("Unmarshal typed values", func() {
+			result := NewEntry(Fields{"stale": "value"})
+			err := json.Unmarshal([]byte(`{"status": 200, "time": 0.050, "ok": true, "upstream": {"addr": "10.0.0.1"}}`), result)
+			So(err, ShouldBeNil)
+			So(result, ShouldResemble, NewEntry(Fields{
+				"status":        "200",
+				"time":          "0.050",
+				"ok":            "true",
+				"upstream_addr": "10.0.0.1",
+			}))
+
+			So(json.Unmarshal([]byte(`[1, 2]`), result), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package gonx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LTSV label characters, see http://ltsv.org
+var ltsvLabel = regexp.MustCompile(`^[0-9A-Za-z_.-]+$`)
+
+// LTSVParser parses log records written in the Labeled Tab-separated Values
+// format, e.g. "host:127.0.0.1<TAB>status:200". Labels are used as field
+// names as they are.
+type LTSVParser struct {
+	names *nameTable
+}
+
+// Returns a new LTSVParser.
+func NewLTSVParser() *LTSVParser {
+	return &LTSVParser{names: new(nameTable)}
+}
+
+// Parse LTSV log record. An error is returned if any of the tab-separated
+// values is not labeled.
+func (parser *LTSVParser) ParseString(line string) (entry *Entry, err error) {
+	entry = NewEmptyEntry()
+	for _, field := range strings.Split(line, "\t") {
+		i := strings.Index(field, ":")
+		if i < 0 || !ltsvLabel.MatchString(field[:i]) {
+			return nil, fmt.Errorf("access log line '%v' is not LTSV, bad field '%v'", line, field)
+		}
+		entry.SetField(parser.names.intern(field[:i]), field[i+1:])
+	}
+	return
+}
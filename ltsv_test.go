@@ -0,0 +1,35 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLTSVParser(t *testing.T) {
+	Convey("Test LTSV Parser", t, func() {
+		parser := NewLTSVParser()
+
+		Convey("Parse labeled values", func() {
+			line := "host:127.0.0.1\tident:-\ttime:[10/Oct/2000:13:55:36 -0700]\treq:GET / HTTP/1.1\tstatus:200"
+			expected := NewEntry(Fields{
+				"host":   "127.0.0.1",
+				"ident":  "-",
+				"time":   "[10/Oct/2000:13:55:36 -0700]",
+				"req":    "GET / HTTP/1.1",
+				"status": "200",
+			})
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, expected)
+		})
+
+		Convey("Parse invalid string", func() {
+			_, err := parser.ParseString("host:127.0.0.1\tGET / HTTP/1.1")
+			So(err, ShouldNotBeNil)
+
+			_, err = parser.ParseString(`{"host":"127.0.0.1"}`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
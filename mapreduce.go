@@ -5,17 +5,62 @@ import (
 	"bytes"
 	"io"
 	"sync"
+	"sync/atomic"
 )
 
 func handleError(err error) {
 	//fmt.Fprintln(os.Stderr, err)
 }
 
+// Parsers that implement lineFolder interface get multi-line records, see
+// MultilineParser.
+type lineFolder interface {
+	IsContinuation(line string) bool
+}
+
+// Stop signals of the MapReduce and ReduceEntries inputs by the input
+// channel, see stopInput.
+var inputStops sync.Map
+
+// Signal to stop reading the input source.
+type inputStop struct {
+	once sync.Once
+	done chan struct{}
+}
+
+// Register the stop signal of the input, remove it when the input is
+// closed.
+func newInputStop(input chan *Entry) *inputStop {
+	stop := &inputStop{done: make(chan struct{})}
+	inputStops.Store(input, stop)
+	return stop
+}
+
+func (s *inputStop) stopped() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop reading the source of the input early, e.g. of the time ordered log
+// file after the Datetime interval end. MapReduce and ReduceEntries do not
+// read the next lines then, but the entries read already are still written
+// to the input, so it should be drained. Other inputs are not affected.
+func stopInput(input chan *Entry) {
+	if value, ok := inputStops.Load(input); ok {
+		stop := value.(*inputStop)
+		stop.once.Do(func() { close(stop.done) })
+	}
+}
+
 // Iterate over given file and map each it's line into Entry record using
 // parser and apply reducer to the Entries channel. Execution terminates
 // when result will be readed from reducer's output channel, but the mapper
 // works and fills input Entries channel until all lines will be read from
-// the fiven file.
+// the fiven file, or the reducer stops the input (see Datetime.StopAfterEnd).
 func MapReduce(file io.Reader, parser StringParser, reducer Reducer) chan *Entry {
 	// Input file lines. This channel is unbuffered to publish
 	// next line to handle only when previous is taken by mapper.
@@ -23,6 +68,9 @@ func MapReduce(file io.Reader, parser StringParser, reducer Reducer) chan *Entry
 
 	// Host thread to spawn new mappers
 	var entries = make(chan *Entry, 10)
+	stop := newInputStop(entries)
+	var parsed, failed int64
+	parseSpan := StartSpan("gonx.parse")
 	go func(topLoad int) {
 		// Create semafore channel with capacity equal to the output channel
 		// capacity. Use it to control mapper goroutines spawn.
@@ -55,8 +103,10 @@ func MapReduce(file io.Reader, parser StringParser, reducer Reducer) chan *Entry
 					// Write result Entry to the output channel. This will
 					// block goroutine runtime until channel is free to
 					// accept new item.
+					atomic.AddInt64(&parsed, 1)
 					entries <- entry
 				} else {
+					atomic.AddInt64(&failed, 1)
 					handleError(err)
 				}
 				// Increment semaphore to allow new mapper workers to spawn
@@ -65,21 +115,59 @@ func MapReduce(file io.Reader, parser StringParser, reducer Reducer) chan *Entry
 		}
 		// Wait for all mappers to complete, then send a quit signal
 		wg.Wait()
+		parseSpan.SetCount("entries", parsed)
+		parseSpan.SetCount("errors", failed)
+		parseSpan.End()
+		inputStops.Delete(entries)
 		close(entries)
 	}(cap(entries))
 
 	// Run reducer routine.
-	var output = make(chan *Entry)
-	go reducer.Reduce(entries, output)
+	output := traceReduce(reducer, entries)
 
 	go func() {
+		readSpan := StartSpan("gonx.read")
+		var count int64
 		reader := bufio.NewReader(file)
+		folder, multiline := parser.(lineFolder)
+		// Feed mapper routines unless the input is stopped
+		send := func(line string) bool {
+			if stop.stopped() {
+				return false
+			}
+			select {
+			case lines <- line:
+				return true
+			case <-stop.done:
+				return false
+			}
+		}
+		var record string
+		pending, stopped := false, false
 		line, err := readLine(reader)
-		for err == nil {
+		for err == nil && !stopped {
+			count++
 			// Read next line from the file and feed mapper routines.
-			lines <- line
-			line, err = readLine(reader)
+			if !multiline {
+				stopped = !send(line)
+			} else if pending && folder.IsContinuation(line) {
+				record += "\n" + line
+			} else {
+				// The record is complete when the next one starts
+				if pending {
+					stopped = !send(record)
+				}
+				record, pending = line, true
+			}
+			if !stopped {
+				line, err = readLine(reader)
+			}
+		}
+		if pending && !stopped {
+			send(record)
 		}
+		readSpan.SetCount("lines", count)
+		readSpan.End()
 		close(lines)
 
 		if err != nil && err != io.EOF {
@@ -90,6 +178,36 @@ func MapReduce(file io.Reader, parser StringParser, reducer Reducer) chan *Entry
 	return output
 }
 
+// Read all entries from the given source and apply reducer to them. Reading
+// stops on the first error, errors other than io.EOF are handled the same
+// way as MapReduce handles the file read errors. The reducer could stop it
+// early too, see Datetime.StopAfterEnd.
+func ReduceEntries(source EntryReader, reducer Reducer) chan *Entry {
+	var entries = make(chan *Entry, 10)
+	stop := newInputStop(entries)
+	go func() {
+		span := StartSpan("gonx.read")
+		var count int64
+		for !stop.stopped() {
+			entry, err := source.Read()
+			if err != nil {
+				if err != io.EOF {
+					handleError(err)
+				}
+				break
+			}
+			count++
+			entries <- entry
+		}
+		span.SetCount("entries", count)
+		span.End()
+		inputStops.Delete(entries)
+		close(entries)
+	}()
+
+	return traceReduce(reducer, entries)
+}
+
 func readLine(reader *bufio.Reader) (string, error) {
 	line, isPrefix, err := reader.ReadLine()
 	if err != nil {
@@ -0,0 +1,243 @@
+package gonx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParsersFromConfig reads nginx config file and returns parsers for all
+// the log_format directives found, by the format name. The include
+// directives are followed, relative paths are resolved against the config
+// file directory. Includes that match no files are skipped.
+func ParsersFromConfig(path string) (map[string]*Parser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	config := newNginxConfig(filepath.Dir(path))
+	config.visited[absPath(path)] = true
+	if err := config.read(file); err != nil {
+		return nil, err
+	}
+	return config.parsers, nil
+}
+
+// Nginx config reader collects log formats from the config files.
+type nginxConfig struct {
+	// Directory to resolve relative include paths
+	dir     string
+	visited map[string]bool
+	parsers map[string]*Parser
+}
+
+func newNginxConfig(dir string) *nginxConfig {
+	return &nginxConfig{
+		dir:     dir,
+		visited: make(map[string]bool),
+		parsers: make(map[string]*Parser),
+	}
+}
+
+// Read config directives and handle log_format and include ones, all the
+// others are skipped.
+func (c *nginxConfig) read(conf io.Reader) error {
+	tokens := newNginxTokenizer(conf)
+	var directive []string
+	for {
+		token, quoted, err := tokens.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !quoted && (token == ";" || token == "{" || token == "}") {
+			if token == ";" && len(directive) > 0 {
+				if err := c.handle(directive); err != nil {
+					return err
+				}
+			}
+			directive = directive[:0]
+			continue
+		}
+		directive = append(directive, token)
+	}
+}
+
+func (c *nginxConfig) handle(directive []string) error {
+	switch directive[0] {
+	case "log_format":
+		return c.logFormat(directive[1:])
+	case "include":
+		if len(directive) != 2 {
+			return fmt.Errorf("invalid number of arguments in \"include\" directive")
+		}
+		return c.include(directive[1])
+	}
+	return nil
+}
+
+// Handle "log_format name [escape=default|json|none] string ..."
+func (c *nginxConfig) logFormat(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("invalid number of arguments in \"log_format\" directive")
+	}
+	name, args := args[0], args[1:]
+	if _, dup := c.parsers[name]; dup {
+		return fmt.Errorf("duplicate \"log_format\" name \"%v\"", name)
+	}
+	escape := EscapeNone
+	if strings.HasPrefix(args[0], "escape=") {
+		switch args[0] {
+		case "escape=default":
+			escape = EscapeDefault
+		case "escape=json":
+			escape = EscapeJSON
+		case "escape=none":
+		default:
+			return fmt.Errorf("unknown log format escaping \"%v\"", args[0])
+		}
+		args = args[1:]
+	}
+	parser := NewParser(strings.Join(args, ""))
+	parser.Escape = escape
+	c.parsers[name] = parser
+	return nil
+}
+
+func (c *nginxConfig) include(pattern string) error {
+	return includeFiles(c.dir, pattern, c.visited, c.read)
+}
+
+// Read the config files matching the pattern, relative patterns are
+// resolved against the dir. Files that are already visited are skipped to
+// avoid include cycles.
+func includeFiles(dir string, pattern string, visited map[string]bool, read func(io.Reader) error) error {
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if abs := absPath(path); visited[abs] {
+			continue
+		} else {
+			visited[abs] = true
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		err = read(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	return nil
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Nginx config tokenizer. Tokens are words, quoted strings and the special
+// characters ";", "{" and "}". Comments are skipped.
+type nginxTokenizer struct {
+	reader *bufio.Reader
+}
+
+func newNginxTokenizer(conf io.Reader) *nginxTokenizer {
+	return &nginxTokenizer{bufio.NewReader(conf)}
+}
+
+// Returns the next token, quoted is true for the quoted strings.
+func (t *nginxTokenizer) next() (token string, quoted bool, err error) {
+	var c byte
+	// Skip spaces and comments
+	for {
+		if c, err = t.reader.ReadByte(); err != nil {
+			return
+		}
+		if c == '#' {
+			if _, err = t.reader.ReadString('\n'); err != nil {
+				return
+			}
+			continue
+		}
+		if !isNginxSpace(c) {
+			break
+		}
+	}
+	switch c {
+	case ';', '{', '}':
+		return string(c), false, nil
+	case '"', '\'':
+		token, err = t.quoted(c)
+		return token, true, err
+	}
+	var word strings.Builder
+	word.WriteByte(c)
+	for {
+		if c, err = t.reader.ReadByte(); err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			break
+		}
+		if isNginxSpace(c) || c == ';' || c == '{' || c == '}' {
+			t.reader.UnreadByte()
+			break
+		}
+		word.WriteByte(c)
+	}
+	return word.String(), false, err
+}
+
+// Read quoted string until the closing quote.
+func (t *nginxTokenizer) quoted(quote byte) (string, error) {
+	var value strings.Builder
+	for {
+		c, err := t.reader.ReadByte()
+		if err == io.EOF {
+			return "", fmt.Errorf("unexpected end of file, expecting %c", quote)
+		}
+		if err != nil {
+			return "", err
+		}
+		if c == quote {
+			return value.String(), nil
+		}
+		if c == '\\' {
+			if c, err = t.reader.ReadByte(); err != nil {
+				continue
+			}
+			switch c {
+			case '"', '\'', '\\':
+			case 't':
+				c = '\t'
+			case 'r':
+				c = '\r'
+			case 'n':
+				c = '\n'
+			default:
+				value.WriteByte('\\')
+			}
+		}
+		value.WriteByte(c)
+	}
+}
+
+func isNginxSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
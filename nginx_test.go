@@ -0,0 +1,67 @@
+package gonx
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNginxConfig(t *testing.T) {
+	Convey("Test nginx config parsing", t, func() {
+		dir := t.TempDir()
+		write := func(name, content string) string {
+			path := filepath.Join(dir, name)
+			So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+			So(os.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+			return path
+		}
+		conf := write("nginx.conf", `
+			# log_format commented '$remote_addr';
+			http {
+				include mime.types;
+				include conf.d/*.conf;
+				log_format main '$remote_addr - $remote_user [$time_local] '
+				                "\"$request\" $status";
+			}
+		`)
+		write("mime.types", `types { text/html html; }`)
+		write("conf.d/json.conf", `log_format json escape=json '{"uri":"$request_uri"}';`)
+		write("conf.d/short.conf", "log_format short $remote_addr;\ninclude nginx.conf;\n")
+
+		Convey("Find all log formats", func() {
+			parsers, err := ParsersFromConfig(conf)
+			So(err, ShouldBeNil)
+			So(len(parsers), ShouldEqual, 3)
+			So(parsers["main"].format, ShouldEqual, `$remote_addr - $remote_user [$time_local] "$request" $status`)
+			So(parsers["json"].format, ShouldEqual, `{"uri":"$request_uri"}`)
+			So(parsers["json"].Escape, ShouldEqual, EscapeJSON)
+			So(parsers["short"].format, ShouldEqual, "$remote_addr")
+		})
+
+		Convey("Find log format in included file", func() {
+			file, err := os.Open(conf)
+			So(err, ShouldBeNil)
+			defer file.Close()
+			parser, err := NewNginxParser(file, "short")
+			So(err, ShouldBeNil)
+			So(parser.format, ShouldEqual, "$remote_addr")
+		})
+
+		Convey("Invalid configs", func() {
+			_, err := ParsersFromConfig(filepath.Join(dir, "missing.conf"))
+			So(err, ShouldNotBeNil)
+
+			_, err = ParsersFromConfig(write("broken.conf", `log_format main '$remote_addr;`))
+			So(err, ShouldNotBeNil)
+
+			_, err = ParsersFromConfig(write("dup.conf", `log_format a $status; log_format a $status;`))
+			So(err, ShouldNotBeNil)
+
+			_, err = NewNginxParser(strings.NewReader(`log_format main $status;`), "other")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
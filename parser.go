@@ -1,11 +1,13 @@
 package gonx
 
 import (
-	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // StringParser is the interface that wraps the ParseString method.
@@ -17,73 +19,254 @@ type StringParser interface {
 type Parser struct {
 	format string
 	regexp *regexp.Regexp
+	// The same regexp, but values could contain backslash escaped chars
+	escapedRegexp *regexp.Regexp
+	// Matches the same lines as the regexps above, but much faster
+	scanner *formatScanner
+
+	// Escaping of the logged values (nginx log_format escape parameter).
+	// Values are decoded according to it, EscapeNone by default.
+	Escape Escape
+
+	// Convert "-" placeholders nginx writes for the empty values (e.g.
+	// $http_referer or $remote_user) to the empty strings.
+	DashAsEmpty bool
+
+	// Time fields layouts by the field name, e.g. NginxTimeLayouts. These
+	// fields are parsed once and Entry.TimeField returns the typed time
+	// with the logged timezone. Values that do not match the layout are
+	// kept as strings only.
+	TimeLayouts map[string]string
+
+	// Split the $request line into the request_method, request_uri and
+	// server_protocol fields, unless they are set by the format already.
+	SplitRequest bool
 }
 
 // Returns a new Parser, use given log format to create its internal
-// strings parsing regexp.
+// strings parsing regexp. Variables followed by "?" are optional, e.g.
+// "$status $request_time?" matches lines with and without the request time,
+// missing optional values are not set. Variables ending with "*" capture
+// the logged headers, e.g. "$http_*" for the "Host: example.com; Accept: */*"
+// value sets http_host and http_accept fields. Values of the "$_" variables
+// are skipped.
 func NewParser(format string) *Parser {
-	re := regexp.MustCompile(`\\\$([a-z_]+)(\\?(.))`).ReplaceAllString(
-		regexp.QuoteMeta(format+" "), "(?P<$1>[^$3]*)$2")
-	return &Parser{format, regexp.MustCompile(fmt.Sprintf("^%v$", strings.Trim(re, " ")))}
+	scanner := newFormatScanner(format)
+	return &Parser{
+		format:        format,
+		regexp:        scanner.regexp(false),
+		escapedRegexp: scanner.regexp(true),
+		scanner:       scanner,
+	}
+}
+
+// Returns a new Parser which uses given regexp to parse log lines. Entry
+// fields are filled with the named capture groups, unnamed groups and the
+// optional groups which did not participate in the match are ignored.
+// Use it for the lines that the format syntax can't express.
+func NewRegexpParser(re *regexp.Regexp) *Parser {
+	return &Parser{regexp: re}
+}
+
+// Returns the names of the format variables (or the regexp named groups) in
+// the format order, e.g. to write the entries as CSV columns with
+// Entry.ToSlice. The skipped "$_" variables and the catch-all headers
+// variables are not included.
+func (parser *Parser) Fields() []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && name != "_" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if parser.scanner != nil {
+		for _, field := range parser.scanner.fields {
+			if !field.headers {
+				add(field.name)
+			}
+		}
+		return names
+	}
+	for _, name := range parser.regexp.SubexpNames() {
+		add(name)
+	}
+	return names
 }
 
 // Parse log file line using internal format regexp. If line do not match
 // given format an error will be returned.
 func (parser *Parser) ParseString(line string) (entry *Entry, err error) {
+	if parser.scanner != nil {
+		return parser.scan(line)
+	}
 	re := parser.regexp
-	fields := re.FindStringSubmatch(line)
+	if parser.Escape == EscapeJSON && parser.escapedRegexp != nil {
+		// Escaped quotes should not end the value
+		re = parser.escapedRegexp
+	}
+	fields := re.FindStringSubmatchIndex(line)
 	if fields == nil {
-		err = fmt.Errorf("access log line '%v' does not match given format '%v'", line, re)
+		err = &ParseError{line, re.String(), failureCause("", line, false)}
 		return
 	}
 
 	// Iterate over subexp foung and fill the map record
 	entry = NewEmptyEntry()
 	for i, name := range re.SubexpNames() {
-		if i == 0 {
+		if i == 0 || name == "" || fields[2*i] < 0 {
 			continue
 		}
-		entry.SetField(name, fields[i])
+		parser.setField(entry, name, line[fields[2*i]:fields[2*i+1]])
 	}
+	parser.derive(entry)
 	return
 }
 
-// NewNginxParser parse nginx conf file to find log_format with given name and
-// returns parser for this format. It returns an error if cannot find the needle.
-func NewNginxParser(conf io.Reader, name string) (parser *Parser, err error) {
-	scanner := bufio.NewScanner(conf)
-	re := regexp.MustCompile(fmt.Sprintf(`^\s*log_format\s+%v\s+(.+)\s*$`, name))
-	found := false
-	var format string
-	for scanner.Scan() {
-		var line string
-		if !found {
-			// Find a log_format definition
-			line = scanner.Text()
-			formatDef := re.FindStringSubmatch(line)
-			if formatDef == nil {
-				continue
-			}
-			found = true
-			line = formatDef[1]
-		} else {
-			line = scanner.Text()
+// Parse log file line with the format scanner.
+func (parser *Parser) scan(line string) (entry *Entry, err error) {
+	entry = NewEmptyEntry()
+	matched, ok := parser.scanner.scan(line, parser.Escape == EscapeJSON, func(name, value string) {
+		parser.setField(entry, name, value)
+	})
+	if !ok {
+		re := parser.regexp
+		if parser.Escape == EscapeJSON {
+			re = parser.escapedRegexp
 		}
-		// Look for a definition end
-		re = regexp.MustCompile(`^\s*(.*?)\s*(;|$)`)
-		lineSplit := re.FindStringSubmatch(line)
-		if l := len(lineSplit[1]); l > 2 {
-			format += lineSplit[1][1 : l-1]
+		cause := failureCause(parser.format, line, matched == len(line))
+		return nil, &ParseError{line, re.String(), cause}
+	}
+	parser.derive(entry)
+	return
+}
+
+// Set fields derived from the parsed ones.
+func (parser *Parser) derive(entry *Entry) {
+	parser.parseTimes(entry)
+	if parser.SplitRequest {
+		splitRequest(entry)
+	}
+}
+
+// Set typed times for the TimeLayouts fields.
+func (parser *Parser) parseTimes(entry *Entry) {
+	for name, layout := range parser.TimeLayouts {
+		value, err := entry.Field(name)
+		if err != nil || isEmptyValue(value) {
+			continue
 		}
-		if lineSplit[2] == ";" {
-			break
+		if t, err := time.Parse(layout, value); err == nil {
+			entry.setTime(name, t)
 		}
 	}
-	if !found {
+}
+
+func (parser *Parser) setField(entry *Entry, name, value string) {
+	if name == "_" {
+		// Skipped value
+		return
+	}
+	if parser.DashAsEmpty && value == "-" {
+		value = ""
+	}
+	entry.SetField(name, parser.Escape.Unescape(value))
+}
+
+// MultilineParser folds the continuation lines into the previous record
+// before parsing, e.g. stack traces of the error log records. Folded lines
+// are joined with "\n".
+type MultilineParser struct {
+	StringParser
+	// Continuation reports whether the line continues the previous record.
+	Continuation func(line string) bool
+}
+
+// Returns a new MultilineParser which parses folded records with the given
+// parser.
+func NewMultilineParser(parser StringParser, continuation func(line string) bool) *MultilineParser {
+	return &MultilineParser{parser, continuation}
+}
+
+// Check whether the line should be folded into the previous record.
+func (parser *MultilineParser) IsContinuation(line string) bool {
+	return parser.Continuation(line)
+}
+
+// RecordStart returns a continuation predicate for the records that start
+// with the given regexp match, e.g. a timestamp. All the lines that do not
+// match are continuation lines.
+func RecordStart(re *regexp.Regexp) func(line string) bool {
+	return func(line string) bool {
+		return !re.MatchString(line)
+	}
+}
+
+// RawParser attaches the original line to the parsed entries, so filtered
+// entries could be written byte-for-byte, see Entry.Raw.
+type RawParser struct {
+	StringParser
+}
+
+// Returns a new RawParser which keeps the lines parsed with given parser.
+func NewRawParser(parser StringParser) *RawParser {
+	return &RawParser{parser}
+}
+
+// Parse the line and attach it to the entry.
+func (parser *RawParser) ParseString(line string) (entry *Entry, err error) {
+	entry, err = parser.StringParser.ParseString(line)
+	if err == nil {
+		entry.raw = line
+	}
+	return
+}
+
+// Check whether the line should be folded into the previous record, if
+// the wrapped parser is the MultilineParser.
+func (parser *RawParser) IsContinuation(line string) bool {
+	folder, ok := parser.StringParser.(lineFolder)
+	return ok && folder.IsContinuation(line)
+}
+
+// NewNginxParser parse nginx conf file to find log_format with given name and
+// returns parser for this format. It returns an error if cannot find the needle.
+// The include directives are followed, see ParsersFromConfig. Relative paths
+// are resolved against the conf file directory if it is an *os.File, or
+// against the working directory otherwise.
+func NewNginxParser(conf io.Reader, name string) (parser *Parser, err error) {
+	config := newNginxConfig(".")
+	if file, ok := conf.(*os.File); ok {
+		config.dir = filepath.Dir(file.Name())
+		config.visited[absPath(file.Name())] = true
+	}
+	if err = config.read(conf); err != nil {
+		return
+	}
+	parser, ok := config.parsers[name]
+	if !ok {
 		err = fmt.Errorf("`log_format %v` not found in given config", name)
-	} else {
-		err = scanner.Err()
 	}
-	parser = NewParser(format)
 	return
 }
+
+// Split the request line, e.g. "GET /index.html HTTP/1.1". The protocol is
+// missing for HTTP/0.9 requests. Malformed lines (e.g. binary garbage) are
+// not split.
+func splitRequest(entry *Entry) {
+	request, err := entry.Field("request")
+	if err != nil {
+		return
+	}
+	parts := strings.Split(request, " ")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return
+	}
+	names := []string{"request_method", "request_uri", "server_protocol"}
+	for i, value := range parts {
+		if _, err := entry.Field(names[i]); err != nil {
+			entry.SetField(names[i], value)
+		}
+	}
+}
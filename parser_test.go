@@ -2,6 +2,7 @@ package gonx
 
 import (
 	. "github.com/smartystreets/goconvey/convey"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -72,5 +73,192 @@ func TestParser(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(parser.format, ShouldEqual, expected)
 		})
+
+		Convey("Regexp parser", func() {
+			re := regexp.MustCompile(`^(?P<remote_addr>\S+) (?:\[(?P<time_local>[^]]+)\] )?"(?P<request>(?:[^"\\]|\\.)*)" (\d+)$`)
+			parser := NewRegexpParser(re)
+
+			Convey("ParseString", func() {
+				line := `89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET /api/foo/\"bar\" HTTP/1.1" 200`
+				expected := NewEntry(Fields{
+					"remote_addr": "89.234.89.123",
+					"time_local":  "08/Nov/2013:13:39:18 +0000",
+					"request":     `GET /api/foo/\"bar\" HTTP/1.1`,
+				})
+				entry, err := parser.ParseString(line)
+				So(err, ShouldBeNil)
+				So(entry, ShouldResemble, expected)
+			})
+
+			Convey("Skip optional groups", func() {
+				line := `89.234.89.123 "GET /api/foo/bar HTTP/1.1" 200`
+				expected := NewEntry(Fields{
+					"remote_addr": "89.234.89.123",
+					"request":     "GET /api/foo/bar HTTP/1.1",
+				})
+				entry, err := parser.ParseString(line)
+				So(err, ShouldBeNil)
+				So(entry, ShouldResemble, expected)
+			})
+
+			Convey("Parse invalid string", func() {
+				_, err := parser.ParseString(`GET /api/foo/bar HTTP/1.1`)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("Multiline parser", func() {
+			parser := NewMultilineParser(
+				NewParser("$time_local [$level] $message"),
+				RecordStart(regexp.MustCompile(`^\d{4}/\d\d/\d\d`)),
+			)
+			So(parser.IsContinuation("2013/11/08 13:39:18 [error] foo"), ShouldBeFalse)
+			So(parser.IsContinuation("    at bar (baz.js:1:2)"), ShouldBeTrue)
+
+			// Folded lines are parsed as a single string
+			entry, err := parser.ParseString("2013/11/08 [error] foo\nbar")
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"time_local": "2013/11/08",
+				"level":      "error",
+				"message":    "foo\nbar",
+			}))
+		})
+
+		Convey("Unescape values", func() {
+			parser := NewParser(`$remote_addr "$request" "$http_user_agent"`)
+
+			Convey("Keep escaped values by default", func() {
+				entry, err := parser.ParseString(`89.234.89.123 "GET /foo HTTP/1.1" "Mozilla \x22Test\x22"`)
+				So(err, ShouldBeNil)
+				So(entry.Fields()["http_user_agent"], ShouldEqual, `Mozilla \x22Test\x22`)
+			})
+
+			Convey("Nginx default escaping", func() {
+				parser.Escape = EscapeDefault
+				entry, err := parser.ParseString(`89.234.89.123 "GET /\xD0\xB0 HTTP/1.1" "Mozilla \x22Test\x22 \x5Cx"`)
+				So(err, ShouldBeNil)
+				So(entry.Fields()["request"], ShouldEqual, "GET /а HTTP/1.1")
+				So(entry.Fields()["http_user_agent"], ShouldEqual, `Mozilla "Test" \x`)
+			})
+
+			Convey("Nginx JSON escaping", func() {
+				parser.Escape = EscapeJSON
+				entry, err := parser.ParseString(`89.234.89.123 "GET /foo HTTP/1.1" "Mozilla \"Test\" \\ é"`)
+				So(err, ShouldBeNil)
+				So(entry.Fields()["http_user_agent"], ShouldEqual, `Mozilla "Test" \ é`)
+			})
+		})
+
+		Convey("Normalize dash placeholders", func() {
+			parser := NewParser(`$remote_addr $remote_user "$http_referer" $body_bytes_sent`)
+			parser.DashAsEmpty = true
+			entry, err := parser.ParseString(`89.234.89.123 - "-" -`)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"remote_addr":     "89.234.89.123",
+				"remote_user":     "",
+				"http_referer":    "",
+				"body_bytes_sent": "",
+			}))
+		})
+
+		Convey("Optional variables", func() {
+			parser := NewParser(`$remote_addr "$request" $status $request_time?`)
+			So(parser.regexp.String(), ShouldEqual,
+				`^(?P<remote_addr>[^ ]*) "(?P<request>[^"]*)" (?P<status>[^ ]*)(?: (?P<request_time>[^ ]*))?$`)
+
+			entry, err := parser.ParseString(`89.234.89.123 "GET / HTTP/1.1" 200 0.050`)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"remote_addr":  "89.234.89.123",
+				"request":      "GET / HTTP/1.1",
+				"status":       "200",
+				"request_time": "0.050",
+			}))
+
+			entry, err = parser.ParseString(`89.234.89.123 "GET / HTTP/1.1" 200`)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"remote_addr": "89.234.89.123",
+				"request":     "GET / HTTP/1.1",
+				"status":      "200",
+			}))
+
+			_, err = parser.ParseString(`89.234.89.123 "GET / HTTP/1.1"`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Catch-all headers", func() {
+			parser := NewParser(`$remote_addr "$http_*" "$sent_http_*"`)
+			line := `89.234.89.123 "Host: example.com; Accept: text/html, */*; X-Request-Id: abc" ` +
+				`"Date: Mon, 01 Jan 2024 10:00:00 GMT, Content-Type: text/html"`
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"remote_addr":            "89.234.89.123",
+				"http_host":              "example.com",
+				"http_accept":            "text/html, */*",
+				"http_x_request_id":      "abc",
+				"sent_http_date":         "Mon, 01 Jan 2024 10:00:00 GMT",
+				"sent_http_content_type": "text/html",
+			}))
+
+			entry, err = parser.ParseString(`89.234.89.123 "-" ""`)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{"remote_addr": "89.234.89.123"}))
+		})
+
+		Convey("Typed time fields", func() {
+			parser := NewParser(`$remote_addr [$time_local] $msec`)
+			parser.TimeLayouts = NginxTimeLayouts
+			entry, err := parser.ParseString(`89.234.89.123 [08/Nov/2013:13:39:18 +0300] 1383907158.000`)
+			So(err, ShouldBeNil)
+			So(entry.times, ShouldContainKey, "time_local")
+			logged, err := entry.DefaultTimeField("time_local")
+			So(err, ShouldBeNil)
+			So(logged.Unix(), ShouldEqual, 1383907158)
+			So(logged.Format(TimeLocalLayout), ShouldEqual, "08/Nov/2013:13:39:18 +0300")
+
+			entry, err = parser.ParseString(`89.234.89.123 [-] 1383907158.000`)
+			So(err, ShouldBeNil)
+			So(entry.times, ShouldBeNil)
+		})
+
+		Convey("Format fields order", func() {
+			parser := NewParser(`$remote_addr $_ [$time_local] "$request" $status "$http_*" $remote_addr`)
+			So(parser.Fields(), ShouldResemble, []string{"remote_addr", "time_local", "request", "status"})
+
+			entry, err := parser.ParseString(`89.234.89.123 - [08/Nov/2013:13:39:18 +0000] "GET / HTTP/1.1" 200 "Host: example.com" 89.234.89.123`)
+			So(err, ShouldBeNil)
+			So(entry.ToSlice(parser.Fields()), ShouldResemble,
+				[]string{"89.234.89.123", "08/Nov/2013:13:39:18 +0000", "GET / HTTP/1.1", "200"})
+
+			re := regexp.MustCompile(`^(?P<remote_addr>\S+) (\d+) (?P<status>\d+)$`)
+			So(NewRegexpParser(re).Fields(), ShouldResemble, []string{"remote_addr", "status"})
+		})
+
+		Convey("Split request line", func() {
+			parser := NewParser(`$remote_addr "$request" $server_protocol`)
+			parser.SplitRequest = true
+			entry, err := parser.ParseString(`89.234.89.123 "GET /api/foo?bar=1 HTTP/1.0" HTTP/1.1`)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"remote_addr":     "89.234.89.123",
+				"request":         "GET /api/foo?bar=1 HTTP/1.0",
+				"request_method":  "GET",
+				"request_uri":     "/api/foo?bar=1",
+				"server_protocol": "HTTP/1.1",
+			}))
+
+			entry, err = parser.ParseString(`89.234.89.123 "GET /" -`)
+			So(err, ShouldBeNil)
+			So(entry.Fields()["request_uri"], ShouldEqual, "/")
+
+			entry, err = parser.ParseString(`89.234.89.123 "\x16\x03\x01" -`)
+			So(err, ShouldBeNil)
+			_, err = entry.Field("request_method")
+			So(err, ShouldNotBeNil)
+		})
 	})
 }
@@ -0,0 +1,31 @@
+//go:build linux
+// +build linux
+
+package gonx
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// LoadPlugin opens the Go plugin built with -buildmode=plugin. Plugin init
+// functions should register its parsers and filters with RegisterParser and
+// RegisterFilter. If the plugin exports a "Register" function, it is called
+// after the plugin is opened. Plugins are supported on Linux only.
+func LoadPlugin(path string) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return err
+	}
+	sym, err := p.Lookup("Register")
+	if err != nil {
+		// Register function is optional
+		return nil
+	}
+	register, ok := sym.(func())
+	if !ok {
+		return fmt.Errorf("plugin %v exports Register of type %T, func() expected", path, sym)
+	}
+	register()
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package gonx
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// LoadPlugin is not supported on this platform, register parsers and
+// filters in the package init functions instead.
+func LoadPlugin(path string) error {
+	return fmt.Errorf("plugins are not supported on %v", runtime.GOOS)
+}
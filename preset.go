@@ -0,0 +1,153 @@
+package gonx
+
+import (
+	"regexp"
+)
+
+// The Common Log Format, e.g. the default Apache httpd access log.
+const CommonFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent`
+
+// The nginx predefined "combined" log format.
+const CombinedFormat = CommonFormat + ` "$http_referer" "$http_user_agent"`
+
+// Caddy access log keys and the gonx field names they are stored as. The
+// names follow nginx variables, so the same reducers work for both servers.
+var caddyFields = map[string]string{
+	"ts":                      "msec",
+	"duration":                "request_time",
+	"size":                    "body_bytes_sent",
+	"bytes_read":              "request_length",
+	"status":                  "status",
+	"user_id":                 "remote_user",
+	"request>remote_ip":       "remote_addr",
+	"request>remote_port":     "remote_port",
+	"request>client_ip":       "client_addr",
+	"request>proto":           "server_protocol",
+	"request>method":          "request_method",
+	"request>host":            "host",
+	"request>uri":             "request_uri",
+	"request>headers>*":       "http_",
+	"request>tls>*":           "ssl_",
+	"resp_headers>*":          "sent_http_",
+	"request>tls>proto":       "ssl_alpn_protocol",
+	"request>tls>version":     "ssl_protocol",
+	"request>tls>resumed":     "ssl_session_reused",
+	"request>tls>server_name": "ssl_server_name",
+}
+
+// NewCaddyParser returns a parser for the Caddy JSON access log. Nested
+// request keys are flattened into nginx-like names, e.g. request>uri becomes
+// request_uri and request>headers>User-Agent becomes http_user_agent. Keys
+// without a predefined name are joined with "_".
+func NewCaddyParser() *JSONParser {
+	parser := NewJSONParser()
+	parser.Fields = copyNames(caddyFields)
+	return parser
+}
+
+// Returns a copy of the keys names, so the parsers could change their own
+// ones.
+func copyNames(names map[string]string) map[string]string {
+	copied := make(map[string]string, len(names))
+	for key, name := range names {
+		copied[key] = name
+	}
+	return copied
+}
+
+// Traefik access log in the Common Log Format mode. The request duration is
+// logged in milliseconds with the "ms" suffix, e.g. "3ms".
+const TraefikFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent ` +
+	`"$http_referer" "$http_user_agent" $request_count "$router_name" "$server_url" $request_duration`
+
+// NewTraefikParser returns a parser for the Traefik access log written in
+// the default Common Log Format mode.
+func NewTraefikParser() *Parser {
+	return NewParser(TraefikFormat)
+}
+
+// Traefik JSON access log keys and the gonx field names they are stored as.
+// Field names are the same as for the Common Log Format mode.
+var traefikFields = map[string]string{
+	"ClientHost":               "remote_addr",
+	"ClientPort":               "remote_port",
+	"ClientUsername":           "remote_user",
+	"StartUTC":                 "time_iso8601",
+	"RequestMethod":            "request_method",
+	"RequestPath":              "request_uri",
+	"RequestProtocol":          "server_protocol",
+	"RequestHost":              "host",
+	"RequestScheme":            "scheme",
+	"RequestContentSize":       "request_length",
+	"DownstreamStatus":         "status",
+	"DownstreamContentSize":    "body_bytes_sent",
+	"RequestCount":             "request_count",
+	"RouterName":               "router_name",
+	"ServiceURL":               "server_url",
+	"request_Referer":          "http_referer",
+	"request_User-Agent":       "http_user_agent",
+	"request_X-Forwarded-For":  "http_x_forwarded_for",
+	"downstream_Content-Type":  "sent_http_content_type",
+	"downstream_Cache-Control": "sent_http_cache_control",
+}
+
+// NewTraefikJSONParser returns a parser for the Traefik access log written
+// in the JSON mode. Common keys are renamed to the nginx-like names used by
+// NewTraefikParser, the rest are kept as they are. Note that Duration and
+// the other timings are logged in nanoseconds.
+func NewTraefikJSONParser() *JSONParser {
+	parser := NewJSONParser()
+	parser.Fields = copyNames(traefikFields)
+	return parser
+}
+
+// AWS Application Load Balancer access log. Fields are named after nginx
+// variables where they have the same meaning (e.g. elb_status_code is
+// status, sent_bytes is bytes_sent), the rest keep their AWS names. Client
+// and target are logged as "ip:port".
+const ALBFormat = `$type $time $elb $client $target $request_processing_time $target_processing_time ` +
+	`$response_processing_time $status $target_status $request_length $bytes_sent "$request" ` +
+	`"$http_user_agent" $ssl_cipher $ssl_protocol $target_group_arn "$trace_id" "$ssl_server_name" ` +
+	`"$chosen_cert_arn" $matched_rule_priority $request_creation_time "$actions_executed" "$redirect_url" ` +
+	`"$error_reason" "$target_list" "$target_status_list" "$classification" "$classification_reason"`
+
+// NewALBParser returns a parser for the AWS Application Load Balancer
+// access log.
+func NewALBParser() *Parser {
+	return NewParser(ALBFormat)
+}
+
+// The varnishncsa default output format spec. The format spec syntax is
+// the same as the Apache LogFormat, see ApacheFormat.
+const VarnishncsaSpec = `%h %l %u %t "%r" %s %b "%{Referer}i" "%{User-agent}i"`
+
+// NewVarnishncsaParser returns a parser for the varnishncsa output written
+// with the given format spec (the -F option), or with the default one if
+// the spec is empty. Varnish extensions are supported, e.g.
+// %{Varnish:hitmiss}x is stored as varnish_hitmiss and
+// %{Varnish:time_firstbyte}x as varnish_time_firstbyte.
+func NewVarnishncsaParser(spec string) (*Parser, error) {
+	if spec == "" {
+		spec = VarnishncsaSpec
+	}
+	format, err := ApacheFormat(spec)
+	if err != nil {
+		return nil, err
+	}
+	return NewParser(format), nil
+}
+
+// Squid native access log, the "squid" logformat. Fields are separated by
+// one or more spaces, because the elapsed time is padded.
+var squidRegexp = regexp.MustCompile(`^(?P<msec>\d+\.\d+)\s+(?P<elapsed>-?\d+) (?P<remote_addr>\S+) ` +
+	`(?P<squid_result>[^/\s]+)/(?P<status>\d+) (?P<bytes_sent>\d+) (?P<request_method>\S+) ` +
+	`(?P<request_uri>\S+) (?P<remote_user>\S+) (?P<squid_hierarchy>[^/\s]+)/(?P<upstream_addr>\S+) ` +
+	`(?P<content_type>\S+)$`)
+
+// NewSquidParser returns a parser for the Squid native access log. The
+// elapsed time is in milliseconds, the result code (e.g. TCP_MISS) is
+// stored as squid_result and the hierarchy code (e.g. DIRECT) as
+// squid_hierarchy.
+func NewSquidParser() *Parser {
+	return NewRegexpParser(squidRegexp)
+}
@@ -0,0 +1,176 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPresets(t *testing.T) {
+	Convey("Test log format presets", t, func() {
+		Convey("Caddy JSON log", func() {
+			parser := NewCaddyParser()
+			line := `{"level":"info","ts":1646861401.5241024,"logger":"http.log.access","msg":"handled request",` +
+				`"request":{"remote_ip":"127.0.0.1","remote_port":"41342","proto":"HTTP/2.0","method":"GET",` +
+				`"host":"localhost","uri":"/api/foo?bar=1","headers":{"User-Agent":["curl/7.82.0"],"Accept":["*/*"]},` +
+				`"tls":{"resumed":false,"version":772,"server_name":"localhost"}},` +
+				`"bytes_read":0,"user_id":"","duration":0.000929675,"size":10900,"status":200,` +
+				`"resp_headers":{"Content-Type":["text/html; charset=utf-8"]}}`
+			expected := NewEntry(Fields{
+				"level":                  "info",
+				"msec":                   "1646861401.5241024",
+				"logger":                 "http.log.access",
+				"msg":                    "handled request",
+				"remote_addr":            "127.0.0.1",
+				"remote_port":            "41342",
+				"server_protocol":        "HTTP/2.0",
+				"request_method":         "GET",
+				"host":                   "localhost",
+				"request_uri":            "/api/foo?bar=1",
+				"http_user_agent":        "curl/7.82.0",
+				"http_accept":            "*/*",
+				"ssl_session_reused":     "false",
+				"ssl_protocol":           "772",
+				"ssl_server_name":        "localhost",
+				"request_length":         "0",
+				"remote_user":            "",
+				"request_time":           "0.000929675",
+				"body_bytes_sent":        "10900",
+				"status":                 "200",
+				"sent_http_content_type": "text/html; charset=utf-8",
+			})
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, expected)
+
+			// Parsers have their own names
+			parser.Fields["status"] = "code"
+			So(NewCaddyParser().Fields["status"], ShouldEqual, "status")
+		})
+
+		Convey("Traefik Common Log Format", func() {
+			parser := NewTraefikParser()
+			line := `10.42.0.1 - - [10/Oct/2020:13:55:36 +0000] "GET /api/foo HTTP/1.1" 200 1024 "-" ` +
+				`"curl/7.68.0" 42 "api@kubernetes" "http://10.42.0.15:8080" 3ms`
+			expected := NewEntry(Fields{
+				"remote_addr":      "10.42.0.1",
+				"remote_user":      "-",
+				"time_local":       "10/Oct/2020:13:55:36 +0000",
+				"request":          "GET /api/foo HTTP/1.1",
+				"status":           "200",
+				"body_bytes_sent":  "1024",
+				"http_referer":     "-",
+				"http_user_agent":  "curl/7.68.0",
+				"request_count":    "42",
+				"router_name":      "api@kubernetes",
+				"server_url":       "http://10.42.0.15:8080",
+				"request_duration": "3ms",
+			})
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, expected)
+		})
+
+		Convey("Traefik JSON log", func() {
+			parser := NewTraefikJSONParser()
+			line := `{"ClientHost":"10.42.0.1","ClientPort":"51234","ClientUsername":"-","DownstreamContentSize":1024,` +
+				`"DownstreamStatus":200,"Duration":3012345,"RequestHost":"example.com","RequestMethod":"GET",` +
+				`"RequestPath":"/api/foo","RequestProtocol":"HTTP/1.1","RouterName":"api@kubernetes",` +
+				`"StartUTC":"2020-10-10T13:55:36.123456789Z","request_User-Agent":"curl/7.68.0"}`
+			expected := NewEntry(Fields{
+				"remote_addr":     "10.42.0.1",
+				"remote_port":     "51234",
+				"remote_user":     "-",
+				"body_bytes_sent": "1024",
+				"status":          "200",
+				"Duration":        "3012345",
+				"host":            "example.com",
+				"request_method":  "GET",
+				"request_uri":     "/api/foo",
+				"server_protocol": "HTTP/1.1",
+				"router_name":     "api@kubernetes",
+				"time_iso8601":    "2020-10-10T13:55:36.123456789Z",
+				"http_user_agent": "curl/7.68.0",
+			})
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, expected)
+
+			// Parsers have their own names
+			parser.Fields["DownstreamStatus"] = "code"
+			So(NewTraefikJSONParser().Fields["DownstreamStatus"], ShouldEqual, "status")
+		})
+
+		Convey("AWS ALB log", func() {
+			parser := NewALBParser()
+			line := `http 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 ` +
+				`10.0.0.1:80 0.000 0.001 0.000 200 200 34 366 "GET http://www.example.com:80/ HTTP/1.1" ` +
+				`"curl/7.46.0" - - arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 ` +
+				`"Root=1-58337262-36d228ad5d99923122bbe354" "-" "-" 0 2018-07-02T22:22:48.364000Z "forward" "-" "-" ` +
+				`"10.0.0.1:80" "200" "-" "-"`
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry.Fields(), ShouldContainKey, "trace_id")
+			status, _ := entry.Field("status")
+			So(status, ShouldEqual, "200")
+			client, _ := entry.Field("client")
+			So(client, ShouldEqual, "192.168.131.39:2817")
+			request, _ := entry.Field("request")
+			So(request, ShouldEqual, "GET http://www.example.com:80/ HTTP/1.1")
+		})
+
+		Convey("Varnishncsa log", func() {
+			parser, err := NewVarnishncsaParser("")
+			So(err, ShouldBeNil)
+			line := `192.168.1.10 - - [10/Oct/2020:13:55:36 +0000] "GET http://example.com/ HTTP/1.1" 200 612 "-" "curl/7.68.0"`
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"remote_addr":     "192.168.1.10",
+				"remote_logname":  "-",
+				"remote_user":     "-",
+				"time_local":      "10/Oct/2020:13:55:36 +0000",
+				"request":         "GET http://example.com/ HTTP/1.1",
+				"status":          "200",
+				"body_bytes_sent": "612",
+				"http_referer":    "-",
+				"http_user_agent": "curl/7.68.0",
+			}))
+
+			parser, err = NewVarnishncsaParser(`%h %{Varnish:hitmiss}x %{Varnish:time_firstbyte}x %D`)
+			So(err, ShouldBeNil)
+			So(parser.format, ShouldEqual, "$remote_addr $varnish_hitmiss $varnish_time_firstbyte $request_time_us")
+			entry, err = parser.ParseString(`192.168.1.10 hit 0.000125 312`)
+			So(err, ShouldBeNil)
+			So(entry.Fields()["varnish_hitmiss"], ShouldEqual, "hit")
+
+			_, err = NewVarnishncsaParser(`%h %J`)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Squid native log", func() {
+			parser := NewSquidParser()
+			line := `1286536308.779    180 192.168.0.224 TCP_MISS/200 411 GET http://example.com/ - DIRECT/93.184.216.34 text/html`
+			entry, err := parser.ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{
+				"msec":            "1286536308.779",
+				"elapsed":         "180",
+				"remote_addr":     "192.168.0.224",
+				"squid_result":    "TCP_MISS",
+				"status":          "200",
+				"bytes_sent":      "411",
+				"request_method":  "GET",
+				"request_uri":     "http://example.com/",
+				"remote_user":     "-",
+				"squid_hierarchy": "DIRECT",
+				"upstream_addr":   "93.184.216.34",
+				"content_type":    "text/html",
+			}))
+
+			name, _, err := DetectFormat([]string{line})
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "squid")
+		})
+	})
+}
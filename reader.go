@@ -4,10 +4,23 @@ import (
 	"io"
 )
 
+// EntryReader is the interface that wraps the Read method. It is implemented
+// by Reader and could be implemented by any other source of the entries,
+// e.g. a message queue consumer.
+//
+// Read should return io.EOF when there are no more entries to read.
+type EntryReader interface {
+	Read() (entry *Entry, err error)
+}
+
 // Log file reader. Use specific constructors to create it.
 type Reader struct {
+	// Attach the original lines to the entries, see Entry.Raw. Set it
+	// before the first Read.
+	KeepRaw bool
+
 	file    io.Reader
-	parser  *Parser
+	parser  StringParser
 	entries chan *Entry
 }
 
@@ -19,6 +32,15 @@ func NewReader(logFile io.Reader, format string) *Reader {
 	}
 }
 
+// Creates reader which uses given parser, e.g. JSONParser or
+// MultilineParser.
+func NewParserReader(logFile io.Reader, parser StringParser) *Reader {
+	return &Reader{
+		file:   logFile,
+		parser: parser,
+	}
+}
+
 // Creates reader for nginx log format. Nginx config parser will be used
 // to get particular format from the conf file.
 func NewNginxReader(logFile io.Reader, nginxConf io.Reader, formatName string) (reader *Reader, err error) {
@@ -36,7 +58,11 @@ func NewNginxReader(logFile io.Reader, nginxConf io.Reader, formatName string) (
 // Get next parsed Entry from the log file. Return EOF if there is no Entries to read.
 func (r *Reader) Read() (entry *Entry, err error) {
 	if r.entries == nil {
-		r.entries = MapReduce(r.file, r.parser, new(ReadAll))
+		parser := r.parser
+		if r.KeepRaw {
+			parser = NewRawParser(parser)
+		}
+		r.entries = MapReduce(r.file, parser, new(ReadAll))
 	}
 	entry, ok := <-r.entries
 	if !ok {
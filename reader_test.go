@@ -3,7 +3,9 @@ package gonx
 import (
 	"io"
 	"math/rand"
+	"regexp"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -24,6 +26,50 @@ func RandString(n int) string {
 	return string(b)
 }
 
+// Log of the time ordered records, one per second, it counts the records
+// read. It is read as the lines or as the entries.
+type timeLog struct {
+	size  int64
+	lines int64
+	line  []byte
+}
+
+func (l *timeLog) next() (time.Time, error) {
+	lines := atomic.LoadInt64(&l.lines)
+	if lines == l.size {
+		return time.Time{}, io.EOF
+	}
+	atomic.AddInt64(&l.lines, 1)
+	return time.Date(2015, time.March, 3, 0, 0, 0, 0, time.UTC).Add(time.Duration(lines) * time.Second), nil
+}
+
+func (l *timeLog) Read(p []byte) (int, error) {
+	if len(l.line) == 0 {
+		t, err := l.next()
+		if err != nil {
+			return 0, err
+		}
+		l.line = []byte(t.Format(time.RFC3339) + "\n")
+	}
+	n := copy(p, l.line)
+	l.line = l.line[n:]
+	return n, nil
+}
+
+type timeLogEntries struct {
+	*timeLog
+}
+
+func (l timeLogEntries) Read() (*Entry, error) {
+	t, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+	entry := NewEmptyEntry()
+	entry.SetTimeField("time", t, time.RFC3339)
+	return entry, nil
+}
+
 func TestReader(t *testing.T) {
 	Convey("Test Reader", t, func() {
 		format := "$remote_addr [$time_local] \"$request\""
@@ -56,5 +102,104 @@ func TestReader(t *testing.T) {
 			_, err := reader.Read()
 			So(err, ShouldBeNil)
 		})
+
+		Convey("Test reduce entries", func() {
+			file := strings.NewReader(`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET /api/foo/bar HTTP/1.1"
+89.234.89.123 [08/Nov/2013:13:39:19 +0000] "GET /api/foo/baz HTTP/1.1"`)
+			var source EntryReader = NewReader(file, format)
+			output := ReduceEntries(source, new(Count))
+
+			result, ok := <-output
+			So(ok, ShouldBeTrue)
+			count, err := result.FloatField("count")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 2)
+		})
+
+		Convey("Test stop reading early", func() {
+			filter := &Datetime{
+				Field:        "time",
+				Format:       time.RFC3339,
+				End:          time.Date(2015, time.March, 3, 0, 0, 10, 0, time.UTC),
+				StopAfterEnd: true,
+			}
+			count := func(output chan *Entry) (count int) {
+				for range output {
+					count++
+				}
+				return
+			}
+
+			file := &timeLog{size: 100000}
+			So(count(ReduceEntries(timeLogEntries{file}, filter)), ShouldEqual, 10)
+			// The rest of the input is drained after the output is closed
+			time.Sleep(50 * time.Millisecond)
+			So(atomic.LoadInt64(&file.lines), ShouldBeLessThan, 100)
+
+			// Lines are parsed concurrently, so the entries around the End
+			// could be reordered
+			file = &timeLog{size: 100000}
+			So(count(MapReduce(file, NewParser("$time"), NewPipeline(filter, new(ReadAll)))), ShouldBeLessThanOrEqualTo, 10)
+			time.Sleep(50 * time.Millisecond)
+			So(atomic.LoadInt64(&file.lines), ShouldBeLessThan, 1000)
+		})
+
+		Convey("Test multiline records", func() {
+			file := strings.NewReader(`2013/11/08 [error] first
+Traceback:
+  line 1
+2013/11/08 [info] second
+2013/11/08 [error] third
+  line 3`)
+			parser := NewMultilineParser(
+				NewRegexpParser(regexp.MustCompile(`(?s)^(?P<date>\S+) \[(?P<level>\w+)\] (?P<message>.*)$`)),
+				RecordStart(regexp.MustCompile(`^\d{4}/`)),
+			)
+			reader := NewParserReader(file, parser)
+
+			messages := make(map[string]bool)
+			for {
+				entry, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				So(err, ShouldBeNil)
+				message, _ := entry.Field("message")
+				messages[message] = true
+			}
+			So(messages, ShouldResemble, map[string]bool{
+				"first\nTraceback:\n  line 1": true,
+				"second":                      true,
+				"third\n  line 3":             true,
+			})
+		})
+
+		Convey("Test raw lines", func() {
+			line := `89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET /api/foo/bar HTTP/1.1"`
+			reader := NewReader(strings.NewReader(line+"\ninvalid"), format)
+			reader.KeepRaw = true
+			entry, err := reader.Read()
+			So(err, ShouldBeNil)
+			So(entry.Raw(), ShouldEqual, line)
+			entry.SetField("request", "")
+			So(entry.Raw(), ShouldEqual, line)
+			_, err = reader.Read()
+			So(err, ShouldEqual, io.EOF)
+
+			// Multiline records are kept folded
+			parser := NewRawParser(NewMultilineParser(
+				NewRegexpParser(regexp.MustCompile(`(?s)^(?P<date>\S+) \[(?P<level>\w+)\] (?P<message>.*)$`)),
+				RecordStart(regexp.MustCompile(`^\d{4}/`)),
+			))
+			reader = NewParserReader(strings.NewReader("2013/11/08 [error] first\n  line 1"), parser)
+			entry, err = reader.Read()
+			So(err, ShouldBeNil)
+			So(entry.Raw(), ShouldEqual, "2013/11/08 [error] first\n  line 1")
+
+			// Lines are not kept by default
+			entry, err = NewParser(format).ParseString(line)
+			So(err, ShouldBeNil)
+			So(entry.Raw(), ShouldBeEmpty)
+		})
 	})
 }
@@ -1,5 +1,17 @@
 package gonx
 
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
 // Reducer interface for Entries channel redure.
 //
 // Each Reduce method should accept input channel of Entries, do it's job and
@@ -7,6 +19,12 @@ package gonx
 //
 // It does not return values because usually it runs in a separate
 // goroutine and it is handy to use channel for reduced data retrieval.
+//
+// Entries are not safe for concurrent use. The Chain passes the same Entry
+// to all its reducers at once, so reducers should treat the input entries as
+// read-only: copy the entry (see Entry.Copy) before changing it. Filters of
+// the Chain are applied before the entry is shared, so they could change it.
+// The output entries belong to the reader of the output channel.
 type Reducer interface {
 	Reduce(input chan *Entry, output chan *Entry)
 }
@@ -26,24 +44,58 @@ func (r *ReadAll) Reduce(input chan *Entry, output chan *Entry) {
 	close(output)
 }
 
-// Implements Reducer interface to count entries
-type Count struct {
+// Implements Reducer interface to write only the first N entries, e.g. to
+// look at a few samples of the filtered entries.
+type Limit struct {
+	N int
 }
 
-// Simply count entrries and write a sum to the output channel
-func (r *Count) Reduce(input chan *Entry, output chan *Entry) {
-	var count uint64
-	for {
-		_, ok := <-input
+// Redirect the first N input entries to the output and close it, so the
+// next reducers do not wait for the rest of the input. The rest of the input
+// is drained, so the writers are not blocked.
+func (r *Limit) Reduce(input chan *Entry, output chan *Entry) {
+	count := 0
+	for count < r.N {
+		entry, ok := <-input
 		if !ok {
 			break
 		}
+		output <- entry
 		count++
 	}
-	entry := NewEmptyEntry()
-	entry.SetUintField("count", count)
-	output <- entry
 	close(output)
+	for range input {
+	}
+}
+
+// Implements Reducer interface to drop the first N entries, e.g. to page
+// through the filtered entries with Limit:
+//
+//	NewPipeline(filter, &Skip{N: 100}, &Limit{N: 100})
+type Skip struct {
+	N int
+}
+
+// Redirect the input entries except the first N ones to the output.
+func (r *Skip) Reduce(input chan *Entry, output chan *Entry) {
+	count := 0
+	for entry := range input {
+		if count < r.N {
+			count++
+			continue
+		}
+		output <- entry
+	}
+	close(output)
+}
+
+// Implements Reducer interface to count entries
+type Count struct {
+}
+
+// Simply count entrries and write a sum to the output channel
+func (r *Count) Reduce(input chan *Entry, output chan *Entry) {
+	reduceAggregate(r.NewAggregate(), input, output)
 }
 
 // Implements Reducer interface for summarize Entry values for the given fields
@@ -53,24 +105,28 @@ type Sum struct {
 
 // Summarize given Entry fields and return a map with result for each field.
 func (r *Sum) Reduce(input chan *Entry, output chan *Entry) {
-	sum := make(map[string]float64)
-	for entry := range input {
-		for _, name := range r.Fields {
-			val, err := entry.FloatField(name)
-			if err == nil {
-				sum[name] += val
-			}
-		}
-	}
-	entry := NewEmptyEntry()
-	for name, val := range sum {
-		entry.SetFloatField(name, val)
-	}
-	output <- entry
-	close(output)
+	reduceAggregate(r.NewAggregate(), input, output)
+}
+
+// Implements Reducer interface to summarize the integer Fields values
+// exactly, e.g. body_bytes_sent over billions of requests, which Sum rounds
+// as float64 does. Sums are kept as int64 and switched to the arbitrary
+// precision when they overflow, so the result is always exact. Values that
+// are not integers are skipped.
+type IntSum struct {
+	Fields []string
 }
 
-// Implements Reducer interface for average entries values calculation
+// Summarize given Entry fields and write the sums to the output.
+func (r *IntSum) Reduce(input chan *Entry, output chan *Entry) {
+	reduceAggregate(r.NewAggregate(), input, output)
+}
+
+// Implements Reducer interface for average entries values calculation. The
+// result has the entries count and the samples count of each field, named
+// by the field with "_count" suffix, because the fields could be missing on
+// some entries. The averages are weighted by the samples counts to merge
+// them.
 type Avg struct {
 	Fields []string
 }
@@ -78,29 +134,52 @@ type Avg struct {
 // Calculate average value for input channel Entries, using configured Fields
 // of the struct. Write result to the output channel as map[string]float64
 func (r *Avg) Reduce(input chan *Entry, output chan *Entry) {
-	avg := make(map[string]float64)
-	count := 0.0
-	for entry := range input {
-		for _, name := range r.Fields {
-			val, err := entry.FloatField(name)
-			if err == nil {
-				avg[name] = (avg[name]*count + val) / (count + 1)
-			}
-		}
-		count++
-	}
-	entry := NewEmptyEntry()
-	for name, val := range avg {
-		entry.SetFloatField(name, val)
-	}
-	output <- entry
-	close(output)
+	reduceAggregate(r.NewAggregate(), input, output)
+}
+
+// Implements Reducer interface for the inline aggregation, e.g. the
+// longest request time:
+//
+//	&Fold{Step: func(acc, entry *Entry) *Entry {
+//		max, _ := acc.FloatField("max")
+//		if val, err := entry.FloatField("request_time"); err == nil && val > max {
+//			acc.SetFloatField("max", val)
+//		}
+//		return acc
+//	}}
+//
+// The Step returns the accumulator for the next entry, it should not change
+// the entry, which is shared between the reducers. The accumulator starts
+// as the Init result, the empty entry by default.
+type Fold struct {
+	Init func() *Entry
+	Step func(acc, entry *Entry) *Entry
 }
 
-// Implements Reducer interface for chaining other reducers
+// Fold the input entries with the Step and write the accumulator to the
+// output.
+func (r *Fold) Reduce(input chan *Entry, output chan *Entry) {
+	reduceAggregate(r.NewAggregate(), input, output)
+}
+
+// Implements Reducer interface for chaining other reducers. Reducers run
+// concurrently and share the input entries, see Reducer.
+//
+// The first result of each reducer is merged into the Chain result, the
+// rest are dropped. A reducer panic does not stop the Chain: the reducer
+// input is drained, its result is skipped and the panic is reported by Err.
+// Reducers that stop reading the input or write several results do not
+// block the others either.
 type Chain struct {
+	// Capacity of the reducers input channels, the Chain input capacity by
+	// default. The slowest reducer holds the others back when its input is
+	// full.
+	Buffer int
+
 	filters  []Filter
 	reducers []Reducer
+	mu       sync.Mutex
+	err      error
 }
 
 func NewChain(reducers ...Reducer) *Chain {
@@ -117,19 +196,44 @@ func NewChain(reducers ...Reducer) *Chain {
 
 // Apply chain of reducers to the input channel of entries and merge results
 func (r *Chain) Reduce(input chan *Entry, output chan *Entry) {
-	// Make input and output channel for each reducer
+	buffer := r.Buffer
+	if buffer <= 0 {
+		buffer = cap(input)
+	}
+
+	// Stateful filters have a new state for each run
+	filters := make([]func(*Entry) *Entry, len(r.filters))
+	for i, f := range r.filters {
+		if stateful, ok := f.(statefulFilter); ok {
+			filters[i] = stateful.newFilter()
+		} else {
+			filters[i] = f.Filter
+		}
+	}
+
+	// Make input channel for each reducer and collect the results
 	subInput := make([]chan *Entry, len(r.reducers))
-	subOutput := make([]chan *Entry, len(r.reducers))
+	results := make([]*Entry, len(r.reducers))
+	var wg sync.WaitGroup
 	for i, reducer := range r.reducers {
-		subInput[i] = make(chan *Entry, cap(input))
-		subOutput[i] = make(chan *Entry, cap(output))
-		go reducer.Reduce(subInput[i], subOutput[i])
+		subInput[i] = make(chan *Entry, buffer)
+		subOutput := make(chan *Entry, cap(output))
+		go r.run(reducer, subInput[i], subOutput)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for entry := range subOutput {
+				if results[i] == nil {
+					results[i] = entry
+				}
+			}
+		}(i)
 	}
 
 	// Read reducer master input channel
 	for entry := range input {
-		for _, f := range r.filters {
-			entry = f.Filter(entry)
+		for _, filter := range filters {
+			entry = filter(entry)
 			if entry == nil {
 				break
 			}
@@ -144,22 +248,218 @@ func (r *Chain) Reduce(input chan *Entry, output chan *Entry) {
 	for _, ch := range subInput {
 		close(ch)
 	}
+	wg.Wait()
 
 	// Merge all results
 	entry := NewEmptyEntry()
-	for _, result := range subOutput {
-		entry.Merge(<-result)
+	for _, result := range results {
+		if result != nil {
+			entry.Merge(result)
+		}
 	}
 
 	output <- entry
 	close(output)
 }
 
+// Returns the error of the first reducer panic of the Reduce runs, nil if
+// all the reducers succeeded. The Chain shared by the GroupBy groups
+// reports the panics of all of them.
+func (r *Chain) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Chain) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Run the reducer, recover its panic and drain the rest of the input, so
+// the Chain is never blocked on it.
+func (r *Chain) run(reducer Reducer, input chan *Entry, output chan *Entry) {
+	runRecovered(reducer, input, output, r.setErr)
+}
+
+// Run the reducer, report its panic and drain the rest of the input, so the
+// reducer input writer is never blocked on it.
+func runRecovered(reducer Reducer, input chan *Entry, output chan *Entry, setErr func(error)) {
+	defer func() {
+		if err := recover(); err != nil {
+			setErr(fmt.Errorf("gonx: %T reducer panic: %v", reducer, err))
+			closeQuietly(output)
+		}
+		for range input {
+		}
+	}()
+	reducer.Reduce(input, output)
+}
+
+// Close the channel unless it is closed already.
+func closeQuietly(ch chan *Entry) {
+	defer func() {
+		recover()
+	}()
+	close(ch)
+}
+
+// Implements Reducer interface to apply reducers one after another, the
+// output of each reducer is the input of the next one. It is useful to
+// transform or filter entries before GroupBy, or to process its results.
+type Pipeline struct {
+	reducers []Reducer
+}
+
+func NewPipeline(reducers ...Reducer) *Pipeline {
+	return &Pipeline{reducers}
+}
+
+// Apply reducers in order. Each reducer runs in its own goroutine and its
+// results stream to the next one as soon as they are written, so the memory
+// is bounded by the stages channels capacity, the output one.
+func (r *Pipeline) Reduce(input chan *Entry, output chan *Entry) {
+	if len(r.reducers) == 0 {
+		new(ReadAll).Reduce(input, output)
+		return
+	}
+	last := len(r.reducers) - 1
+	for _, reducer := range r.reducers[:last] {
+		stage := make(chan *Entry, cap(output))
+		go reducer.Reduce(input, stage)
+		input = stage
+	}
+	r.reducers[last].Reduce(input, output)
+}
+
 // Implements Reducer interface to apply other reducers and get data grouped by
 // given fields.
+//
+// GroupBy keeps a state for each group, so it could run out of memory for
+// the high cardinality fields. If all the reducers are Aggregators (e.g.
+// Count, Sum and Avg) the groups are aggregated in place, otherwise each
+// group has its own reducers goroutine and channels.
+//
+// Set MemoryLimit or MaxGroups to flush the groups results when the heap
+// size or the number of groups exceeds it: the results are written to the
+// output with the "partial" field set to "true" and the groups state is
+// reset. Partial results of the same group should be merged downstream,
+// e.g. counts are merged with the Pipeline of GroupBy and GroupBy with Sum:
+//
+//	groupBy := NewGroupBy(fields, new(Count))
+//	groupBy.MemoryLimit = 1 << 30
+//	NewPipeline(groupBy, NewGroupBy(fields, &Sum{[]string{"count"}}))
+//
+// The heap size is checked every 10000 entries and the groups are flushed
+// once per garbage collection cycle, so the flushed groups are collected
+// before the heap is over the limit again. The limit is of GroupBy only,
+// the other reducers (e.g. Percentile or GroupByTime) keep their state
+// until the input is closed.
+//
+// Set SpillDir with MaxGroups to get the exact results instead: the entries
+// of the groups over the limit are written to a temporary file and grouped
+// after the groups in memory are written, MaxGroups at a time. The results
+// are ordered within each of these batches only, so the output order
+// depends on MaxGroups; sort the results downstream if it matters.
+//
+// Set EmitEvery or EmitInterval to publish the live aggregates of the long
+// running pipelines (e.g. of the followed log file): the results of the
+// groups seen since the last emission are written periodically as the
+// partial ones. The groups are reset on each emission, so the results are
+// the deltas of the period, merge them downstream to get the totals, e.g.
+// the requests counts per status:
+//
+//	groupBy := NewGroupBy([]string{"status"}, new(Count))
+//	groupBy.EmitInterval = time.Minute
+//	totals := NewGroupBy([]string{"status"}, &Sum{[]string{"count"}})
+//	totals.EmitEvery = 1
+//	totals.Cumulative = true
+//	NewPipeline(groupBy, totals)
+//
+// Set Cumulative to keep the groups between the emissions instead, so each
+// emission has the totals of all the entries seen so far. It needs all the
+// reducers to be Aggregators and Flatten unset, the groups of the other
+// reducers could not be written without closing them: their emissions are
+// the deltas then, and Err reports it.
+//
+// The same reducers are run for each group, so they keep the state within
+// Reduce, e.g. Distinct and ApproxDistinct count per group. The distinct
+// counts are not additive, use ApproxDistinct sketches to merge them.
+//
+// Set Flatten to write all the results of the reducers which write several
+// ones, e.g. the top 5 URIs per vhost:
+//
+//	groupBy := NewGroupBy([]string{"host"}, &TopN{Field: "request_uri", N: 5})
+//	groupBy.Flatten = true
+//
+// Each result is written with the group fields then, in the reducers order.
+//
+// Results are written in the group keys order, e.g. of the Fields values.
+// Set OrderBy to order them by the result field value instead, e.g. the
+// largest counts first:
+//
+//	groupBy := NewGroupBy([]string{"request_uri"}, new(Count))
+//	groupBy.OrderBy, groupBy.Descending = "count", true
+//
+// The values are compared as numbers if both are, otherwise as strings, and
+// the numbers go before the other values (after them if Descending).
+// Results without the field are written last, the ties in the key order.
+// The partial and spilled results are ordered within each flush or batch.
+//
+// Set MaxCardinality to protect against grouping by the unbounded values,
+// e.g. the raw URIs: the entries of the groups over it are grouped into the
+// "__other" one. Its result has the "__other" Fields values and reports the
+// collapsed_groups (approximately, see ApproxDistinct) and the
+// collapsed_entries counts.
 type GroupBy struct {
-	Fields   []string
+	Fields []string
+	// Heap size in bytes to flush partial results at, 0 means no limit.
+	MemoryLimit uint64
+	// Number of groups kept in memory, 0 means no limit.
+	MaxGroups int
+	// Write the partial results every EmitEvery entries or EmitInterval
+	// and reset the groups, 0 means at the end of the input only.
+	EmitEvery    int
+	EmitInterval time.Duration
+	// Keep the groups between the emissions, see EmitEvery.
+	Cumulative bool
+	// Directory for the temporary files of the groups over MaxGroups, the
+	// partial results are flushed if it is empty or the file cannot be
+	// created or written. The file errors are reported by Err, the entries
+	// which cannot be written or read back are missing from the results.
+	SpillDir string
+	// Group key of the entry Fields values, Entry.FieldsHash by default.
+	// Set it to (*Entry).FieldsDigest to save memory for the long values.
+	Key func(entry *Entry, fields []string) string
+	// Result field name to write the group key to, e.g. for the computed
+	// keys (see NewGroupByFunc). The key is not written if it is empty.
+	KeyField string
+	// Write each result of the reducers instead of merging the first ones.
+	Flatten bool
+	// Number of the distinct groups, the first ones seen, 0 means no limit.
+	MaxCardinality int
+	// Result field to order the results by and the direction.
+	OrderBy    string
+	Descending bool
+
 	reducers []Reducer
+	mu       sync.Mutex
+	err      error
+}
+
+// Heap size is checked every memoryCheckInterval entries, because reading
+// memory stats stops the world.
+const memoryCheckInterval = 10000
+
+// Returns the heap size and the number of the completed garbage collection
+// cycles, it is a variable to be replaced in tests.
+var memStats = func() (heapAlloc uint64, numGC uint32) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc, stats.NumGC
 }
 
 func NewGroupBy(fields []string, reducers ...Reducer) *GroupBy {
@@ -169,22 +469,391 @@ func NewGroupBy(fields []string, reducers ...Reducer) *GroupBy {
 	}
 }
 
+// Returns GroupBy with the group keys computed by the key function instead
+// of the fields values, e.g. the status class or the path prefix. The key
+// is written to the results as the "key" field, set KeyField to rename it.
+func NewGroupByFunc(key func(*Entry) string, reducers ...Reducer) *GroupBy {
+	return &GroupBy{
+		Key:      func(entry *Entry, fields []string) string { return key(entry) },
+		KeyField: "key",
+		reducers: reducers,
+	}
+}
+
 // Apply related reducers and group data by Fields.
 func (r *GroupBy) Reduce(input chan *Entry, output chan *Entry) {
-	subInput := make(map[string]chan *Entry)
-	subOutput := make(map[string]chan *Entry)
+	var guard *cardinalityGuard
+	if r.MaxCardinality > 0 {
+		guard = newCardinalityGuard(r.MaxCardinality)
+	}
+	r.reduce(input, output, false, guard)
+	close(output)
+}
+
+// Group the input entries and write the groups results to the output, the
+// results are partial if some were flushed before.
+func (r *GroupBy) reduce(input chan *Entry, output chan *Entry, partial bool, guard *cardinalityGuard) {
+	groups := r.newGroups(cap(input), cap(output))
+	flush := func() {
+		partial = true
+		guard.report()
+		r.write(groups.results(true), output)
+		groups = r.newGroups(cap(input), cap(output))
+	}
+	emit := flush
+	if r.Cumulative {
+		emit = func() {
+			aggregated, ok := groups.(*aggregateGroups)
+			if !ok {
+				r.setErr(fmt.Errorf("gonx: GroupBy Cumulative reducers should be Aggregators"))
+				flush()
+				return
+			}
+			// The results are copies, the groups are kept
+			guard.update()
+			r.write(aggregated.results(true), output)
+		}
+	}
+	var tick <-chan time.Time
+	if r.EmitInterval > 0 {
+		ticker := time.NewTicker(r.EmitInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var spill *spillFile
+	spillFailed := false
+	count := 0
+	// Garbage collection cycle of the last MemoryLimit flush
+	flushedGC := int64(-1)
+loop:
+	for {
+		var entry *Entry
+		select {
+		case <-tick:
+			if groups.len() > 0 {
+				emit()
+			}
+			continue
+		case next, ok := <-input:
+			if !ok {
+				break loop
+			}
+			entry = next
+		}
+		key := r.key(entry)
+		original := key
+		if guard != nil && !guard.admit(key) {
+			key = otherGroup
+		}
+		if !groups.has(key) {
+			if r.MaxGroups > 0 && groups.len() >= r.MaxGroups {
+				if spill == nil && r.SpillDir != "" && !spillFailed {
+					spill, _ = newSpillFile(r.SpillDir)
+				}
+				if spill != nil && !spillFailed {
+					err := spill.write(entry)
+					if err == nil {
+						continue
+					}
+					// Flush the partial results instead
+					r.setErr(err)
+					spillFailed = true
+				}
+				flush()
+			}
+			var result *Entry
+			if key == otherGroup {
+				result = guard.newOther(r.Fields, r.KeyField)
+			} else {
+				result = entry.Partial(r.Fields)
+				if r.KeyField != "" {
+					result.SetField(r.KeyField, key)
+				}
+			}
+			groups.create(key, result)
+		}
+		if key == otherGroup {
+			guard.collapse(original)
+		}
+		groups.add(key, entry)
+		count++
+		if r.EmitEvery > 0 && count%r.EmitEvery == 0 {
+			emit()
+		} else if r.MemoryLimit > 0 && count%memoryCheckInterval == 0 {
+			// The heap has the groups flushed since the last cycle yet
+			heap, numGC := memStats()
+			if heap > r.MemoryLimit && int64(numGC) != flushedGC {
+				flush()
+				flushedGC = int64(numGC)
+			}
+		}
+	}
+	// The rest of results are partial too if some were flushed
+	guard.report()
+	r.write(groups.results(partial), output)
+	if spill != nil {
+		defer spill.remove()
+		r.reduce(spill.entries(cap(input)), output, partial, guard)
+		if err := spill.readErr(); err != nil {
+			r.setErr(err)
+		}
+	}
+}
+
+// Returns the first error of the Reduce runs, e.g. of the spill file or
+// the reducer panic in a group, nil if all of them succeeded.
+func (r *GroupBy) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *GroupBy) setErr(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// Write the groups results to the output in the OrderBy order.
+func (r *GroupBy) write(results []*Entry, output chan *Entry) {
+	if r.OrderBy != "" {
+		sort.Stable(&orderedEntries{results, r.OrderBy, r.Descending})
+	}
+	for _, entry := range results {
+		output <- entry
+	}
+}
+
+func (r *GroupBy) key(entry *Entry) string {
+	if r.Key != nil {
+		return r.Key(entry, r.Fields)
+	}
+	return entry.FieldsHash(r.Fields)
+}
+
+func (r *GroupBy) newGroups(inputCap, outputCap int) groups {
+	if r.Flatten {
+		return &flatGroups{
+			reducers:  r.reducers,
+			inputCap:  inputCap,
+			outputCap: outputCap,
+			setErr:    r.setErr,
+			groups:    make(map[string]*flatGroup),
+		}
+	}
+	if aggregators, ok := aggregators(r.reducers); ok {
+		return &aggregateGroups{aggregators, make(map[string]*aggregateGroup)}
+	}
+	return &chainGroups{
+		reducers:  r.reducers,
+		inputCap:  inputCap,
+		outputCap: outputCap,
+		setErr:    r.setErr,
+		chains:    make(map[string]*Chain),
+		subInput:  make(map[string]chan *Entry),
+		subOutput: make(map[string]chan *Entry),
+	}
+}
 
-	// Read reducer master input channel and create discinct input chanel
-	// for each entry key we group by
+// Implements Reducer interface to count the entries by the Fields values,
+// e.g. hits per status, per URI or per IP:
+//
+//	&CountBy{Fields: []string{"status"}}
+//
+// It is the same as GroupBy with Count, but only the counter is kept for
+// each group. Results have the Fields values and the count field, they are
+// written in the group keys order as the GroupBy ones.
+type CountBy struct {
+	Fields []string
+}
+
+// Count the input entries by the Fields values and write the counts.
+func (r *CountBy) Reduce(input chan *Entry, output chan *Entry) {
+	results := make(map[string]*Entry)
+	counts := make(map[string]uint64)
 	for entry := range input {
 		key := entry.FieldsHash(r.Fields)
-		if _, ok := subInput[key]; !ok {
-			subInput[key] = make(chan *Entry, cap(input))
-			subOutput[key] = make(chan *Entry, cap(output)+1)
-			subOutput[key] <- entry.Partial(r.Fields)
-			go NewChain(r.reducers...).Reduce(subInput[key], subOutput[key])
+		if _, ok := results[key]; !ok {
+			results[key] = entry.Partial(r.Fields)
+		}
+		counts[key]++
+	}
+	keys := make([]string, 0, len(results))
+	for key := range results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := results[key]
+		entry.SetUintField("count", counts[key])
+		output <- entry
+	}
+	close(output)
+}
+
+// Implements Reducer interface to group entries by the time buckets, it is
+// GroupBy over the Field truncated to the Granularity, e.g. 5xx per minute:
+//
+//	NewPipeline(&errors5xx, NewGroupByTime("time_local", time.Minute, new(Count)))
+//
+// Set Fields to group by the time buckets and the fields values at once,
+// e.g. requests per hour per vhost:
+//
+//	groupBy := NewGroupByTime("time_local", time.Hour, new(Count))
+//	groupBy.Fields = []string{"host"}
+//
+// Results have the bucket start time formatted with the Format and the
+// Fields values, they are written in the time order and then in the Fields
+// values order. Buckets are aligned to UTC, e.g. the day buckets start at
+// UTC midnight. Entries without the valid time are skipped.
+type GroupByTime struct {
+	Field string
+	// Time layout, the nginx layout for the field name (see
+	// Entry.DefaultTimeField) by default. Buckets of the other fields are
+	// formatted as RFC 3339 then.
+	Format      string
+	Granularity time.Duration
+	// Other fields to group by within the time buckets.
+	Fields []string
+
+	reducers []Reducer
+}
+
+func NewGroupByTime(field string, granularity time.Duration, reducers ...Reducer) *GroupByTime {
+	return &GroupByTime{
+		Field:       field,
+		Granularity: granularity,
+		reducers:    reducers,
+	}
+}
+
+// Group key of the time bucket start and the fields values.
+type timeGroup struct {
+	start int64
+	key   string
+}
+
+type timeGroups []timeGroup
+
+func (s timeGroups) Len() int      { return len(s) }
+func (s timeGroups) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s timeGroups) Less(i, j int) bool {
+	if s[i].start != s[j].start {
+		return s[i].start < s[j].start
+	}
+	return s[i].key < s[j].key
+}
+
+// Apply related reducers to the entries of each time bucket.
+func (r *GroupByTime) Reduce(input chan *Entry, output chan *Entry) {
+	layout := r.Format
+	if layout == "" {
+		layout = NginxTimeLayouts[r.Field]
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	subInput := make(map[timeGroup]chan *Entry)
+	subOutput := make(map[timeGroup]chan *Entry)
+	var groups timeGroups
+	for entry := range input {
+		t, err := entry.timeField(r.Field, r.Format)
+		if err != nil {
+			continue
+		}
+		start := t.Truncate(r.Granularity)
+		group := timeGroup{start.UnixNano(), ""}
+		if len(r.Fields) > 0 {
+			group.key = entry.FieldsHash(r.Fields)
+		}
+		if _, ok := subInput[group]; !ok {
+			subInput[group] = make(chan *Entry, cap(input))
+			subOutput[group] = make(chan *Entry, cap(output)+1)
+			result := entry.Partial(r.Fields)
+			result.SetTimeField(r.Field, start, layout)
+			subOutput[group] <- result
+			groups = append(groups, group)
+			go NewChain(r.reducers...).Reduce(subInput[group], subOutput[group])
+		}
+		subInput[group] <- entry
+	}
+	for _, ch := range subInput {
+		close(ch)
+	}
+	sort.Sort(groups)
+	for _, group := range groups {
+		entry := <-subOutput[group]
+		entry.Merge(<-subOutput[group])
+		output <- entry
+	}
+	close(output)
+}
+
+// Named time interval of the Windows reducer, Start is inclusive and End
+// is exclusive. Zero Start or End means the window is open on that side.
+type TimeWindow struct {
+	Name       string
+	Start, End time.Time
+}
+
+// Implements Reducer interface to apply other reducers to several time
+// windows at once, e.g. to compare the last hour with the same hour
+// yesterday in one pass over the file:
+//
+//	now := time.Now().Truncate(time.Hour)
+//	NewWindows("time_local", []TimeWindow{
+//		{"last hour", now.Add(-time.Hour), now},
+//		{"yesterday", now.Add(-25 * time.Hour), now.Add(-24 * time.Hour)},
+//	}, new(Count))
+//
+// Windows could overlap, the entry is passed to each window it is within.
+// Results are written for each window in the Windows order, with the
+// "window" field set to the window Name, even if there are no entries in
+// the window. Entries without the valid time are skipped.
+type Windows struct {
+	Field string
+	// Time layout, the nginx layout for the field name (see
+	// Entry.DefaultTimeField) by default.
+	Format  string
+	Windows []TimeWindow
+
+	reducers []Reducer
+}
+
+func NewWindows(field string, windows []TimeWindow, reducers ...Reducer) *Windows {
+	return &Windows{
+		Field:    field,
+		Windows:  windows,
+		reducers: reducers,
+	}
+}
+
+// Apply related reducers to the entries of each window.
+func (r *Windows) Reduce(input chan *Entry, output chan *Entry) {
+	bounds := make([]Datetime, len(r.Windows))
+	subInput := make([]chan *Entry, len(r.Windows))
+	subOutput := make([]chan *Entry, len(r.Windows))
+	for i, window := range r.Windows {
+		bounds[i] = Datetime{Start: window.Start, End: window.End}
+		subInput[i] = make(chan *Entry, cap(input))
+		subOutput[i] = make(chan *Entry, cap(output)+1)
+		result := NewEmptyEntry()
+		result.SetField("window", window.Name)
+		subOutput[i] <- result
+		go NewChain(r.reducers...).Reduce(subInput[i], subOutput[i])
+	}
+	for entry := range input {
+		t, err := entry.timeField(r.Field, r.Format)
+		if err != nil {
+			continue
+		}
+		for i := range bounds {
+			if bounds[i].withinBounds(t) {
+				subInput[i] <- entry
+			}
 		}
-		subInput[key] <- entry
 	}
 	for _, ch := range subInput {
 		close(ch)
@@ -196,3 +865,294 @@ func (r *GroupBy) Reduce(input chan *Entry, output chan *Entry) {
 	}
 	close(output)
 }
+
+// Implements Reducer interface to count co-occurrences of two fields values,
+// e.g. remote_addr and request_uri pairs. It helps to spot clients that
+// hammer a small set of endpoints.
+type Cooccurrence struct {
+	Fields [2]string
+	// Minimum number of the pair occurrences to be reported.
+	Threshold uint64
+}
+
+type fieldsPair struct {
+	first, second string
+}
+
+// Count pairs of Fields values and write an entry for each pair that occurs
+// at least Threshold times. Result entry contains both values, the pair
+// count and the number of distinct second field values seen with the first
+// one (as "distinct_<second field>"). Entries without any of the fields are
+// skipped.
+func (r *Cooccurrence) Reduce(input chan *Entry, output chan *Entry) {
+	pairs := make(map[fieldsPair]uint64)
+	distinct := make(map[string]uint64)
+	for entry := range input {
+		first, err := entry.Field(r.Fields[0])
+		if err != nil {
+			continue
+		}
+		second, err := entry.Field(r.Fields[1])
+		if err != nil {
+			continue
+		}
+		pair := fieldsPair{first, second}
+		if pairs[pair] == 0 {
+			distinct[first]++
+		}
+		pairs[pair]++
+	}
+	for pair, count := range pairs {
+		if count < r.Threshold {
+			continue
+		}
+		entry := NewEmptyEntry()
+		entry.SetField(r.Fields[0], pair.first)
+		entry.SetField(r.Fields[1], pair.second)
+		entry.SetUintField("count", count)
+		entry.SetUintField("distinct_"+r.Fields[1], distinct[pair.first])
+		output <- entry
+	}
+	close(output)
+}
+
+// Implements Reducer interface to count the distinct Fields values
+// combinations, e.g. unique remote_addr. The result field is named by the
+// Fields joined with "_", e.g. distinct_remote_addr or
+// distinct_remote_addr_http_user_agent. Use it with GroupBy to count per
+// group.
+//
+// All the distinct values are kept in memory, use ApproxDistinct to count
+// them in the constant memory or to merge the partial results.
+type Distinct struct {
+	Fields []string
+}
+
+// Count distinct values, entries without any of the Fields are skipped.
+func (r *Distinct) Reduce(input chan *Entry, output chan *Entry) {
+	seen := make(map[string]bool)
+	for entry := range input {
+		if entry.hasFields(r.Fields) {
+			seen[entry.FieldsHash(r.Fields)] = true
+		}
+	}
+	entry := NewEmptyEntry()
+	entry.SetUintField("distinct_"+strings.Join(r.Fields, "_"), uint64(len(seen)))
+	output <- entry
+	close(output)
+}
+
+// Implements Reducer interface to collect the distinct Field values into
+// the delimited list field, named by the Field with "_values" suffix, e.g.
+// all the user agents seen per IP with GroupBy:
+//
+//	NewGroupBy([]string{"remote_addr"}, &Collect{Field: "http_user_agent", Limit: 10})
+//
+// Values are listed in the order they are seen first, joined with the
+// Separator ("," by default) as they are. The values after the first Limit
+// distinct ones are dropped, all of them are kept if Limit is 0.
+type Collect struct {
+	Field     string
+	Separator string
+	Limit     int
+}
+
+// Collect the Field values, entries without the Field are skipped.
+func (r *Collect) Reduce(input chan *Entry, output chan *Entry) {
+	seen := make(map[string]bool)
+	var values []string
+	for entry := range input {
+		value, err := entry.Field(r.Field)
+		if err != nil || seen[value] || (r.Limit > 0 && len(values) >= r.Limit) {
+			continue
+		}
+		seen[value] = true
+		values = append(values, value)
+	}
+	separator := r.Separator
+	if separator == "" {
+		separator = ","
+	}
+	entry := NewEmptyEntry()
+	entry.SetField(r.Field+"_values", strings.Join(values, separator))
+	output <- entry
+	close(output)
+}
+
+// Implements Reducer interface to calculate the requests rate, e.g. requests
+// per second. The time span is the number of Units the entries TimeField
+// values cover, so 60 entries logged every second from 12:00:00 to 12:00:59
+// are 1 per second or 60 per minute. The result entry has the rate field,
+// and the peak_rate field (the largest number of entries within a Unit) if
+// Peak is set.
+type Rate struct {
+	TimeField string
+	// Layout to parse the TimeField values, the nginx layout for the field
+	// name (see Entry.DefaultTimeField) by default. The values of the other
+	// fields are parsed as RFC 3339 then.
+	Format string
+	// Rate unit, a second by default.
+	Unit time.Duration
+	Peak bool
+}
+
+// Count the entries by the Unit and write the rate, entries without the
+// valid time are skipped.
+func (r *Rate) Reduce(input chan *Entry, output chan *Entry) {
+	unit := r.Unit
+	if unit <= 0 {
+		unit = time.Second
+	}
+	counts := make(map[int64]uint64)
+	var first, last int64
+	var total uint64
+	for entry := range input {
+		t, err := entry.timeField(r.TimeField, r.Format)
+		if err != nil {
+			continue
+		}
+		bucket := t.UnixNano() / int64(unit)
+		if total == 0 || bucket < first {
+			first = bucket
+		}
+		if total == 0 || bucket > last {
+			last = bucket
+		}
+		total++
+		if r.Peak {
+			counts[bucket]++
+		}
+	}
+	entry := NewEmptyEntry()
+	var rate float64
+	if total > 0 {
+		rate = float64(total) / float64(last-first+1)
+	}
+	entry.SetFloatField("rate", rate)
+	if r.Peak {
+		var peak uint64
+		for _, count := range counts {
+			if count > peak {
+				peak = count
+			}
+		}
+		entry.SetUintField("peak_rate", peak)
+	}
+	output <- entry
+	close(output)
+}
+
+// Implements Reducer interface to take a uniform random sample of Size
+// entries using the reservoir sampling, so the input size does not need
+// to be known. Sampled entries are written to the output in the input
+// order.
+//
+// Random numbers are generated with the given Seed, the same Seed and the
+// same input entries order give exactly the same sample (see Sample). No
+// entries are kept for the Size less than 1.
+type ReservoirSample struct {
+	Size int
+	Seed int64
+}
+
+type sampledEntry struct {
+	entry *Entry
+	index int
+}
+
+type sampledEntries []sampledEntry
+
+func (s sampledEntries) Len() int           { return len(s) }
+func (s sampledEntries) Less(i, j int) bool { return s[i].index < s[j].index }
+func (s sampledEntries) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Keep Size random entries of the input and write them to the output.
+func (r *ReservoirSample) Reduce(input chan *Entry, output chan *Entry) {
+	size := r.Size
+	if size < 0 {
+		size = 0
+	}
+	random := rand.New(rand.NewSource(r.Seed))
+	reservoir := make(sampledEntries, 0, size)
+	index := 0
+	for entry := range input {
+		if len(reservoir) < size {
+			reservoir = append(reservoir, sampledEntry{entry, index})
+		} else if j := random.Intn(index + 1); j < size {
+			reservoir[j] = sampledEntry{entry, index}
+		}
+		index++
+	}
+	sort.Sort(reservoir)
+	for _, sampled := range reservoir {
+		output <- sampled.entry
+	}
+	close(output)
+}
+
+// Implements Reducer interface to calculate the exact percentiles of the
+// Field values, e.g. the request_time tail latency that Avg hides. The
+// result fields are named by the Field and the percentile, e.g.
+// request_time_p50, request_time_p99 or request_time_p99.9 for 0.999.
+//
+// All the values are kept in memory to be sorted, use TDigest for the
+// unbounded streams.
+type Percentile struct {
+	Field string
+	// Quantiles to calculate, 0.5, 0.9, 0.95 and 0.99 by default.
+	Quantiles []float64
+}
+
+var defaultQuantiles = []float64{0.5, 0.9, 0.95, 0.99}
+
+// Collect the Field values and write the percentiles to the output. Missing
+// and invalid values are skipped, no percentiles are written if there are no
+// values at all.
+func (r *Percentile) Reduce(input chan *Entry, output chan *Entry) {
+	var values []float64
+	for entry := range input {
+		if value, err := entry.FloatField(r.Field); err == nil {
+			values = append(values, value)
+		}
+	}
+	sort.Float64s(values)
+	entry := NewEmptyEntry()
+	if len(values) > 0 {
+		for _, q := range r.quantiles() {
+			entry.SetField(quantileField(r.Field, q), formatValue(nearestRank(values, q)))
+		}
+	}
+	output <- entry
+	close(output)
+}
+
+func (r *Percentile) quantiles() []float64 {
+	if len(r.Quantiles) == 0 {
+		return defaultQuantiles
+	}
+	return r.Quantiles
+}
+
+// Percentile of the sorted values with the nearest-rank method, so it is
+// always one of the values.
+func nearestRank(sorted []float64, q float64) float64 {
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	} else if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// Name of the quantile field, e.g. request_time_p95 for 0.95.
+func quantileField(field string, q float64) string {
+	percent := math.Floor(q*100*1e4+0.5) / 1e4
+	return field + "_p" + strconv.FormatFloat(percent, 'f', -1, 64)
+}
+
+// Format the value the same way it is logged, e.g. 0.005 for the nginx
+// $request_time, not rounded as SetFloatField does.
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
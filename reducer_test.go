@@ -1,8 +1,11 @@
 package gonx
 
 import (
+	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
+	"strconv"
 	"testing"
+	"time"
 )
 
 func TestReducer(t *testing.T) {
@@ -99,6 +102,14 @@ func TestReducer(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(value, ShouldEqual, (2+5+8)/total)
 
+				count, err := result.FloatField("count")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, total)
+
+				count, err = result.FloatField("foo_count")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, total)
+
 				_, err = result.Field("buz")
 				So(err, ShouldNotBeNil)
 			})
@@ -138,15 +149,17 @@ func TestReducer(t *testing.T) {
 				So(len(reducer.reducers), ShouldEqual, 2)
 				reducer.Reduce(input, output)
 
-				// Collect result entries from output channel to the map, because reading
-				// from channel can be in any order, it depends on each reducer processing
+				// Collect result entries from output channel to the map, results
+				// are written in the group keys order
 				resultMap := make(map[string]*Entry)
+				var hosts []string
 				for result := range output {
 					value, err := result.Field("host")
 					So(err, ShouldBeNil)
 					resultMap[value] = result
+					hosts = append(hosts, value)
 				}
-				So(len(resultMap), ShouldEqual, 2)
+				So(hosts, ShouldResemble, []string{"alpha.example.com", "beta.example.com"})
 
 				// Read and assert first group result
 				result := resultMap["alpha.example.com"]
@@ -178,6 +191,757 @@ func TestReducer(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(count, ShouldEqual, 2)
 			})
+
+			Convey("Group reducer with digest keys", func() {
+				reducer := NewGroupBy([]string{"host"}, new(Count))
+				reducer.Key = (*Entry).FieldsDigest
+				reducer.Reduce(input, output)
+
+				counts := make(map[string]float64)
+				for result := range output {
+					host, _ := result.Field("host")
+					counts[host], _ = result.FloatField("count")
+				}
+				So(counts, ShouldResemble, map[string]float64{"alpha.example.com": 1, "beta.example.com": 2})
+			})
+
+			Convey("Distinct reducer", func() {
+				reducer := &Distinct{[]string{"host"}}
+				reducer.Reduce(input, output)
+				So((<-output).Fields(), ShouldResemble, Fields{"distinct_host": "2"})
+			})
+
+			Convey("Distinct combinations reducer", func() {
+				reducer := NewGroupBy([]string{"host"}, &Distinct{[]string{"host", "foo"}})
+				reducer.Reduce(input, output)
+				So((<-output).Fields(), ShouldResemble, Fields{"host": "alpha.example.com", "distinct_host_foo": "1"})
+				So((<-output).Fields(), ShouldResemble, Fields{"host": "beta.example.com", "distinct_host_foo": "2"})
+			})
+
+			Convey("Distinct reducer skips missing fields", func() {
+				reducer := &Distinct{[]string{"missing"}}
+				reducer.Reduce(input, output)
+				So((<-output).Fields(), ShouldResemble, Fields{"distinct_missing": "0"})
+			})
+
+			Convey("Cooccurrence reducer", func() {
+				reducer := &Cooccurrence{Fields: [2]string{"host", "foo"}, Threshold: 1}
+				reducer.Reduce(input, output)
+
+				results := make(map[string]*Entry)
+				for result := range output {
+					results[result.FieldsHash([]string{"host", "foo"})] = result
+				}
+				So(len(results), ShouldEqual, 3)
+
+				result := results["'host'=beta.example.com;'foo'=4"]
+				So(result, ShouldNotBeNil)
+				count, err := result.FloatField("count")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+				distinct, err := result.FloatField("distinct_foo")
+				So(err, ShouldBeNil)
+				So(distinct, ShouldEqual, 2)
+			})
+
+			Convey("Cooccurrence reducer threshold", func() {
+				reducer := &Cooccurrence{Fields: [2]string{"host", "host"}, Threshold: 2}
+				reducer.Reduce(input, output)
+
+				result, ok := <-output
+				So(ok, ShouldBeTrue)
+				value, err := result.Field("host")
+				So(err, ShouldBeNil)
+				So(value, ShouldEqual, "beta.example.com")
+
+				_, ok = <-output
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("Pipeline reducer", func() {
+				reducer := NewPipeline(
+					&DurationClass{
+						Field:      "foo",
+						Thresholds: []time.Duration{2 * time.Second},
+						Labels:     []string{"fast", "slow"},
+					},
+					NewGroupBy([]string{"foo_class"}, new(Count)),
+				)
+				So(len(reducer.reducers), ShouldEqual, 2)
+				reducer.Reduce(input, output)
+
+				counts := make(map[string]float64)
+				for result := range output {
+					class, err := result.Field("foo_class")
+					So(err, ShouldBeNil)
+					counts[class], err = result.FloatField("count")
+					So(err, ShouldBeNil)
+				}
+				So(counts, ShouldResemble, map[string]float64{"fast": 1, "slow": 2})
+			})
+
+			Convey("Sum reducer with placeholders", func() {
+				input := make(chan *Entry, 2)
+				input <- NewEntry(Fields{"bytes": "10"})
+				input <- NewEntry(Fields{"bytes": "-"})
+				close(input)
+
+				reducer := &Sum{[]string{"bytes"}}
+				reducer.Reduce(input, output)
+
+				result, ok := <-output
+				So(ok, ShouldBeTrue)
+				value, err := result.FloatField("bytes")
+				So(err, ShouldBeNil)
+				So(value, ShouldEqual, 10)
+			})
+
+			Convey("Avg reducer skips placeholders", func() {
+				input := make(chan *Entry, 3)
+				input <- NewEntry(Fields{"request_time": "0.4"})
+				input <- NewEntry(Fields{"request_time": "-"})
+				input <- NewEntry(Fields{"request_time": ""})
+				close(input)
+
+				reducer := &Avg{[]string{"request_time"}}
+				reducer.Reduce(input, output)
+
+				result, ok := <-output
+				So(ok, ShouldBeTrue)
+				value, err := result.FloatField("request_time")
+				So(err, ShouldBeNil)
+				So(value, ShouldEqual, 0.4)
+			})
 		})
 	})
+
+	Convey("Test ReservoirSample reducer", t, func() {
+		sample := func(reducer Reducer) []float64 {
+			input := make(chan *Entry, 100)
+			output := make(chan *Entry, 100)
+			for i := 0; i < 100; i++ {
+				entry := NewEmptyEntry()
+				entry.SetUintField("id", uint64(i))
+				input <- entry
+			}
+			close(input)
+			reducer.Reduce(input, output)
+			var ids []float64
+			for entry := range output {
+				id, _ := entry.FloatField("id")
+				ids = append(ids, id)
+			}
+			return ids
+		}
+
+		Convey("Keep size entries in the input order", func() {
+			ids := sample(&ReservoirSample{Size: 10, Seed: 42})
+			So(len(ids), ShouldEqual, 10)
+			for i := 1; i < len(ids); i++ {
+				So(ids[i-1], ShouldBeLessThan, ids[i])
+			}
+		})
+
+		Convey("Reproduce sample with the same seed", func() {
+			So(sample(&ReservoirSample{Size: 10, Seed: 42}), ShouldResemble, sample(&ReservoirSample{Size: 10, Seed: 42}))
+			So(sample(&ReservoirSample{Size: 10, Seed: 42}), ShouldNotResemble, sample(&ReservoirSample{Size: 10, Seed: 7}))
+		})
+
+		Convey("Keep all entries of the short input", func() {
+			So(len(sample(&ReservoirSample{Size: 1000})), ShouldEqual, 100)
+		})
+
+		Convey("Keep no entries of the negative size", func() {
+			So(sample(&ReservoirSample{Size: -1}), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Test GroupBy partial results flush", t, func() {
+		defer func(original func() (uint64, uint32)) { memStats = original }(memStats)
+		// Each check is after the garbage collection cycle
+		var numGC uint32
+		memStats = func() (uint64, uint32) {
+			numGC++
+			return 2 << 30, numGC
+		}
+
+		n := 2*memoryCheckInterval + 5
+		fill := func() chan *Entry {
+			input := make(chan *Entry, n)
+			for i := 0; i < n; i++ {
+				input <- NewEntry(Fields{"host": []string{"alpha", "beta"}[i%2]})
+			}
+			close(input)
+			return input
+		}
+
+		Convey("Flush partial results", func() {
+			groupBy := NewGroupBy([]string{"host"}, new(Count))
+			groupBy.MemoryLimit = 1 << 30
+			output := make(chan *Entry, 10)
+			go groupBy.Reduce(fill(), output)
+
+			results := 0
+			var total float64
+			for result := range output {
+				results++
+				partial, err := result.Field("partial")
+				So(err, ShouldBeNil)
+				So(partial, ShouldEqual, "true")
+				count, _ := result.FloatField("count")
+				total += count
+			}
+			So(results, ShouldEqual, 6)
+			So(total, ShouldEqual, n)
+		})
+
+		Convey("Flush once per garbage collection cycle", func() {
+			memStats = func() (uint64, uint32) { return 2 << 30, 1 }
+			groupBy := NewGroupBy([]string{"host"}, new(Count))
+			groupBy.MemoryLimit = 1 << 30
+			output := make(chan *Entry, 10)
+			go groupBy.Reduce(fill(), output)
+
+			results := 0
+			for range output {
+				results++
+			}
+			So(results, ShouldEqual, 4)
+		})
+
+		Convey("Merge partial results downstream", func() {
+			groupBy := NewGroupBy([]string{"host"}, new(Count))
+			groupBy.MemoryLimit = 1 << 30
+			output := make(chan *Entry, 10)
+			go NewPipeline(groupBy, NewGroupBy([]string{"host"}, &Sum{[]string{"count"}})).Reduce(fill(), output)
+
+			counts := make(map[string]float64)
+			for result := range output {
+				host, _ := result.Field("host")
+				counts[host], _ = result.FloatField("count")
+			}
+			So(counts, ShouldResemble, map[string]float64{"alpha": 10003, "beta": 10002})
+		})
+
+		Convey("No limit", func() {
+			output := make(chan *Entry, 10)
+			go NewGroupBy([]string{"host"}, new(Count)).Reduce(fill(), output)
+			results := 0
+			for result := range output {
+				results++
+				_, err := result.Field("partial")
+				So(err, ShouldNotBeNil)
+			}
+			So(results, ShouldEqual, 2)
+		})
+	})
+
+	Convey("Test percentile reducer", t, func() {
+		input := make(chan *Entry, 101)
+		for i := 1; i <= 100; i++ {
+			input <- NewEntry(Fields{"request_time": strconv.FormatFloat(float64(i)/1000, 'f', 3, 64)})
+		}
+		input <- NewEntry(Fields{"request_time": "invalid"})
+		close(input)
+		output := make(chan *Entry, 1)
+
+		Convey("Calculate percentiles", func() {
+			reducer := &Percentile{Field: "request_time", Quantiles: []float64{0, 0.5, 0.95, 0.999, 1}}
+			reducer.Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{
+				"request_time_p0":    "0.001",
+				"request_time_p50":   "0.05",
+				"request_time_p95":   "0.095",
+				"request_time_p99.9": "0.1",
+				"request_time_p100":  "0.1",
+			})
+		})
+
+		Convey("Use default quantiles", func() {
+			reducer := &Percentile{Field: "request_time"}
+			reducer.Reduce(input, output)
+			So((<-output).Names(), ShouldResemble, []string{
+				"request_time_p50", "request_time_p90", "request_time_p95", "request_time_p99",
+			})
+		})
+
+		Convey("No values", func() {
+			reducer := &Percentile{Field: "missing"}
+			reducer.Reduce(input, output)
+			So((<-output).Fields(), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Test rate reducer", t, func() {
+		input := make(chan *Entry, 100)
+		for i := 0; i < 60; i++ {
+			input <- NewEntry(Fields{"time_local": fmt.Sprintf("08/Nov/2013:13:%02d:%02d +0000", 40+i/30, i%30*2)})
+		}
+		input <- NewEntry(Fields{"time_local": "-"})
+		close(input)
+		output := make(chan *Entry, 1)
+
+		Convey("Requests per second", func() {
+			reducer := &Rate{TimeField: "time_local", Peak: true}
+			reducer.Reduce(input, output)
+			// Entries are logged every 2 seconds within 2 minutes
+			So((<-output).Fields(), ShouldResemble, Fields{"rate": "0.50", "peak_rate": "1"})
+		})
+
+		Convey("Requests per minute", func() {
+			reducer := &Rate{TimeField: "time_local", Format: TimeLocalLayout, Unit: time.Minute, Peak: true}
+			reducer.Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"rate": "30.00", "peak_rate": "30"})
+		})
+
+		Convey("No entries", func() {
+			reducer := &Rate{TimeField: "missing"}
+			reducer.Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"rate": "0.00"})
+		})
+	})
+
+	Convey("Test group by time reducer", t, func() {
+		input := make(chan *Entry, 10)
+		for _, fields := range []Fields{
+			{"time_local": "08/Nov/2013:13:41:18 +0300", "status": "500"},
+			{"time_local": "08/Nov/2013:13:40:01 +0300", "status": "502"},
+			{"time_local": "08/Nov/2013:13:40:59 +0300", "status": "500"},
+			{"time_local": "-", "status": "500"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		output := make(chan *Entry, 10)
+
+		Convey("Group by minute", func() {
+			NewGroupByTime("time_local", time.Minute, new(Count)).Reduce(input, output)
+			var results []Fields
+			for result := range output {
+				results = append(results, result.Fields())
+			}
+			So(results, ShouldResemble, []Fields{
+				{"time_local": "08/Nov/2013:13:40:00 +0300", "count": "2"},
+				{"time_local": "08/Nov/2013:13:41:00 +0300", "count": "1"},
+			})
+		})
+
+		Convey("Group by day with custom layout", func() {
+			reducer := NewGroupByTime("time_local", 24*time.Hour, new(Count))
+			reducer.Format = TimeLocalLayout
+			reducer.Reduce(input, output)
+			result := <-output
+			So(result.Fields(), ShouldResemble, Fields{"time_local": "08/Nov/2013:03:00:00 +0300", "count": "3"})
+			day, err := result.DefaultTimeField("time_local")
+			So(err, ShouldBeNil)
+			So(day.UTC().Hour(), ShouldEqual, 0)
+		})
+
+		Convey("Group by minute and field", func() {
+			groupBy := NewGroupByTime("time_local", time.Minute, new(Count))
+			groupBy.Fields = []string{"status"}
+			groupBy.Reduce(input, output)
+			var results []Fields
+			for result := range output {
+				results = append(results, result.Fields())
+			}
+			So(results, ShouldResemble, []Fields{
+				{"time_local": "08/Nov/2013:13:40:00 +0300", "status": "500", "count": "1"},
+				{"time_local": "08/Nov/2013:13:40:00 +0300", "status": "502", "count": "1"},
+				{"time_local": "08/Nov/2013:13:41:00 +0300", "status": "500", "count": "1"},
+			})
+		})
+	})
+
+	Convey("Test limit reducer", t, func() {
+		input := make(chan *Entry, 5)
+		for i := 0; i < 5; i++ {
+			input <- NewEntry(Fields{"n": strconv.Itoa(i)})
+		}
+		close(input)
+		output := make(chan *Entry, 5)
+
+		Convey("Write first entries", func() {
+			(&Limit{N: 2}).Reduce(input, output)
+			var numbers []string
+			for entry := range output {
+				numbers = append(numbers, entry.Fields()["n"])
+			}
+			So(numbers, ShouldResemble, []string{"0", "1"})
+			So(input, ShouldBeEmpty)
+		})
+
+		Convey("Write all entries if there are less than N", func() {
+			(&Limit{N: 10}).Reduce(input, output)
+			So(output, ShouldHaveLength, 5)
+		})
+
+		Convey("Write nothing for zero N", func() {
+			new(Limit).Reduce(input, output)
+			So(output, ShouldBeEmpty)
+			So(input, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Test fold reducer", t, func() {
+		input := make(chan *Entry, 3)
+		for _, value := range []string{"0.5", "2.5", "1"} {
+			input <- NewEntry(Fields{"request_time": value})
+		}
+		close(input)
+		output := make(chan *Entry, 1)
+		max := func(acc, entry *Entry) *Entry {
+			current, _ := acc.FloatField("max")
+			if val, err := entry.FloatField("request_time"); err == nil && val > current {
+				acc.SetFloatField("max", val)
+			}
+			return acc
+		}
+
+		Convey("Fold entries", func() {
+			(&Fold{Step: max}).Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"max": "2.50"})
+		})
+
+		Convey("Fold entries with initial accumulator", func() {
+			init := func() *Entry {
+				return NewEntry(Fields{"max": "10"})
+			}
+			(&Fold{Init: init, Step: max}).Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"max": "10"})
+		})
+	})
+
+	Convey("Test avg reducer with missing fields", t, func() {
+		input := make(chan *Entry, 3)
+		input <- NewEntry(Fields{"request_time": "0.5", "upstream_time": "0.4"})
+		input <- NewEntry(Fields{"request_time": "1.5"})
+		input <- NewEntry(Fields{"request_time": "1"})
+		close(input)
+		output := make(chan *Entry, 1)
+		(&Avg{[]string{"request_time", "upstream_time"}}).Reduce(input, output)
+		So((<-output).Fields(), ShouldResemble, Fields{
+			"request_time":        "1.00",
+			"request_time_count":  "3",
+			"upstream_time":       "0.40",
+			"upstream_time_count": "1",
+			"count":               "3",
+		})
+	})
+
+	Convey("Test count by reducer", t, func() {
+		input := make(chan *Entry, 5)
+		for _, status := range []string{"200", "404", "200", "500", "200"} {
+			input <- NewEntry(Fields{"status": status, "uri": "/"})
+		}
+		close(input)
+		output := make(chan *Entry, 5)
+		(&CountBy{Fields: []string{"status"}}).Reduce(input, output)
+		var results []Fields
+		for entry := range output {
+			results = append(results, entry.Fields())
+		}
+		So(results, ShouldResemble, []Fields{
+			{"status": "200", "count": "3"},
+			{"status": "404", "count": "1"},
+			{"status": "500", "count": "1"},
+		})
+	})
+
+	Convey("Test skip reducer", t, func() {
+		input := make(chan *Entry, 5)
+		for i := 0; i < 5; i++ {
+			input <- NewEntry(Fields{"n": strconv.Itoa(i)})
+		}
+		close(input)
+		output := make(chan *Entry, 5)
+		numbers := func() (numbers []string) {
+			for entry := range output {
+				numbers = append(numbers, entry.Fields()["n"])
+			}
+			return
+		}
+
+		Convey("Drop first entries", func() {
+			(&Skip{N: 3}).Reduce(input, output)
+			So(numbers(), ShouldResemble, []string{"3", "4"})
+		})
+
+		Convey("Drop all entries if there are less than N", func() {
+			(&Skip{N: 10}).Reduce(input, output)
+			So(numbers(), ShouldBeEmpty)
+		})
+
+		Convey("Page with limit", func() {
+			NewPipeline(&Skip{N: 1}, &Limit{N: 2}).Reduce(input, output)
+			So(numbers(), ShouldResemble, []string{"1", "2"})
+		})
+	})
+
+	Convey("Test collect reducer", t, func() {
+		input := make(chan *Entry, 10)
+		for _, fields := range []Fields{
+			{"remote_addr": "10.0.0.1", "http_user_agent": "curl"},
+			{"remote_addr": "10.0.0.2", "http_user_agent": "Mozilla"},
+			{"remote_addr": "10.0.0.1", "http_user_agent": "Wget"},
+			{"remote_addr": "10.0.0.1", "http_user_agent": "curl"},
+			{"remote_addr": "10.0.0.1"},
+			{"remote_addr": "10.0.0.1", "http_user_agent": "python"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		output := make(chan *Entry, 10)
+
+		Convey("Collect distinct values", func() {
+			(&Collect{Field: "http_user_agent", Separator: "|"}).Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"http_user_agent_values": "curl|Mozilla|Wget|python"})
+		})
+
+		Convey("Collect values per group", func() {
+			NewGroupBy([]string{"remote_addr"}, &Collect{Field: "http_user_agent", Limit: 2}).Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"remote_addr": "10.0.0.1", "http_user_agent_values": "curl,Wget"})
+			So((<-output).Fields(), ShouldResemble, Fields{"remote_addr": "10.0.0.2", "http_user_agent_values": "Mozilla"})
+		})
+	})
+
+	Convey("Test integer sum reducer", t, func() {
+		input := make(chan *Entry, 10)
+		output := make(chan *Entry, 1)
+		for _, fields := range []Fields{
+			{"bytes": "9007199254740993", "delta": "-5", "big": "9223372036854775807"},
+			{"bytes": "1", "delta": "2", "big": "9223372036854775807"},
+			{"bytes": "-", "delta": "0.5", "big": "2"},
+			{"delta": "-"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		(&IntSum{[]string{"bytes", "delta", "big", "missing"}}).Reduce(input, output)
+		So((<-output).Fields(), ShouldResemble, Fields{
+			"bytes": "9007199254740994",
+			"delta": "-3",
+			"big":   "18446744073709551616",
+		})
+	})
+
+	Convey("Test distinct count per group", t, func() {
+		input := make(chan *Entry, 10)
+		output := make(chan *Entry, 10)
+		for _, fields := range []Fields{
+			{"request_uri": "/a", "remote_addr": "10.0.0.1"},
+			{"request_uri": "/b", "remote_addr": "10.0.0.1"},
+			{"request_uri": "/a", "remote_addr": "10.0.0.2"},
+			{"request_uri": "/a", "remote_addr": "10.0.0.1"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		NewGroupBy([]string{"request_uri"}, &Distinct{[]string{"remote_addr"}}).Reduce(input, output)
+		So((<-output).Fields(), ShouldResemble, Fields{"request_uri": "/a", "distinct_remote_addr": "2"})
+		So((<-output).Fields(), ShouldResemble, Fields{"request_uri": "/b", "distinct_remote_addr": "1"})
+	})
+
+	Convey("Test group by key function", t, func() {
+		input := make(chan *Entry, 10)
+		output := make(chan *Entry, 10)
+		for _, status := range []string{"200", "404", "502", "204", "500"} {
+			input <- NewEntry(Fields{"status": status})
+		}
+		close(input)
+		statusClass := func(entry *Entry) string {
+			status, _ := entry.Field("status")
+			return status[:1] + "xx"
+		}
+
+		Convey("Write key field", func() {
+			NewGroupByFunc(statusClass, new(Count)).Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"key": "2xx", "count": "2"})
+			So((<-output).Fields(), ShouldResemble, Fields{"key": "4xx", "count": "1"})
+			So((<-output).Fields(), ShouldResemble, Fields{"key": "5xx", "count": "2"})
+		})
+
+		Convey("Rename key field", func() {
+			groupBy := NewGroupByFunc(statusClass, new(Count))
+			groupBy.KeyField = "status_class"
+			groupBy.Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{"status_class": "2xx", "count": "2"})
+		})
+	})
+
+	Convey("Test chain robustness", t, func() {
+		input := make(chan *Entry)
+		output := make(chan *Entry)
+		go func() {
+			for i := 0; i < 100; i++ {
+				input <- NewEntry(Fields{"n": strconv.Itoa(i)})
+			}
+			close(input)
+		}()
+		chain := NewChain(
+			new(panickingReducer),
+			new(ReadAll),
+			&Limit{N: 1},
+			new(Count),
+		)
+		chain.Buffer = 1
+		go chain.Reduce(input, output)
+		So((<-output).Fields(), ShouldResemble, Fields{"n": "0", "count": "100"})
+		So(chain.Err(), ShouldNotBeNil)
+		So(chain.Err().Error(), ShouldContainSubstring, "panickingReducer reducer panic: boom")
+	})
+
+	Convey("Test GroupBy reports group reducers panics", t, func() {
+		input := make(chan *Entry, 30)
+		for i := 0; i < 30; i++ {
+			input <- NewEntry(Fields{"host": strconv.Itoa(i % 2)})
+		}
+		close(input)
+		output := make(chan *Entry, 2)
+
+		Convey("Chain groups", func() {
+			groupBy := NewGroupBy([]string{"host"}, new(panickingReducer), new(Distinct))
+			groupBy.Reduce(input, output)
+			So(output, ShouldHaveLength, 2)
+			So(groupBy.Err(), ShouldNotBeNil)
+			So(groupBy.Err().Error(), ShouldContainSubstring, "panickingReducer reducer panic: boom")
+		})
+
+		Convey("Flat groups", func() {
+			groupBy := NewGroupBy([]string{"host"}, new(panickingReducer), new(Count))
+			groupBy.Flatten = true
+			groupBy.Reduce(input, output)
+			So(output, ShouldHaveLength, 2)
+			So(groupBy.Err(), ShouldNotBeNil)
+		})
+
+		Convey("Shared chain", func() {
+			chain := NewChain(new(panickingReducer), new(Count))
+			NewGroupBy([]string{"host"}, chain).Reduce(input, output)
+			So(chain.Err(), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Test pipeline stages streaming", t, func() {
+		input := make(chan *Entry)
+		output := make(chan *Entry)
+		filter := &Predicate{func(entry *Entry) bool {
+			return entry.Fields()["status"] != "200"
+		}}
+		go NewPipeline(filter, new(ReadAll)).Reduce(input, output)
+		for _, status := range []string{"200", "500"} {
+			input <- NewEntry(Fields{"status": status})
+		}
+		// The result is written before the input is closed
+		select {
+		case entry := <-output:
+			So(entry.Fields(), ShouldResemble, Fields{"status": "500"})
+		case <-time.After(time.Second):
+			So("pipeline result timeout", ShouldBeEmpty)
+		}
+		close(input)
+		_, ok := <-output
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("Test time windows reducer", t, func() {
+		input := make(chan *Entry, 10)
+		output := make(chan *Entry, 10)
+		for _, fields := range []Fields{
+			{"time_local": "07/Nov/2013:13:10:00 +0000", "bytes": "10"},
+			{"time_local": "08/Nov/2013:12:10:00 +0000", "bytes": "20"},
+			{"time_local": "08/Nov/2013:13:10:00 +0000", "bytes": "30"},
+			{"time_local": "08/Nov/2013:13:50:00 +0000", "bytes": "40"},
+			{"time_local": "invalid", "bytes": "50"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		now := time.Date(2013, time.November, 8, 14, 0, 0, 0, time.UTC)
+		NewWindows("time_local", []TimeWindow{
+			{"last hour", now.Add(-time.Hour), now},
+			{"yesterday same hour", now.Add(-25 * time.Hour), now.Add(-24 * time.Hour)},
+			{"today", now.Truncate(24 * time.Hour), time.Time{}},
+			{"next hour", now, now.Add(time.Hour)},
+		}, new(Count), &Sum{[]string{"bytes"}}).Reduce(input, output)
+		var results []Fields
+		for result := range output {
+			results = append(results, result.Fields())
+		}
+		So(results, ShouldResemble, []Fields{
+			{"window": "last hour", "count": "2", "bytes": "70.00"},
+			{"window": "yesterday same hour", "count": "1", "bytes": "10.00"},
+			{"window": "today", "count": "3", "bytes": "90.00"},
+			{"window": "next hour", "count": "0"},
+		})
+	})
+}
+
+// Run with the race detector (make race) to check the reducers follow the
+// entries ownership rules.
+func TestSharedEntries(t *testing.T) {
+	Convey("Share entries between the Chain reducers", t, func() {
+		input := make(chan *Entry, 100)
+		for i := 0; i < 100; i++ {
+			input <- NewEntry(Fields{
+				"host":          []string{"alpha", "beta"}[i%2],
+				"bytes":         "10",
+				"request_time":  "0.100",
+				"upstream_addr": "10.0.0.1:80, 10.0.0.2:80",
+			})
+		}
+		close(input)
+		output := make(chan *Entry, 1)
+		NewChain(
+			// Filters change the entries before they are shared
+			&MultiValue{Fields: []string{"upstream_addr"}},
+			&Sum{[]string{"bytes"}},
+			&Avg{[]string{"request_time"}},
+			new(Count),
+			NewPipeline(
+				NewGroupBy([]string{"host"}, new(Count)),
+				&Sum{[]string{"count"}},
+			),
+			&copyingReducer{field: "bytes"},
+		).Reduce(input, output)
+
+		result := <-output
+		So(result.Fields(), ShouldResemble, Fields{
+			"bytes":              "1000.00",
+			"request_time":       "0.10",
+			"request_time_count": "100",
+			"count":              "100.00",
+			"kilobytes":          "0.01",
+		})
+	})
+}
+
+// Reducer that changes the entries, it copies them first.
+type copyingReducer struct {
+	field string
+}
+
+func (r *copyingReducer) Reduce(input chan *Entry, output chan *Entry) {
+	var last *Entry
+	for entry := range input {
+		last = entry.Copy()
+		value, _ := last.FloatField(r.field)
+		last.SetFloatField("kilobytes", value/1000)
+	}
+	output <- NewEntry(Fields{"kilobytes": last.Fields()["kilobytes"]})
+	close(output)
+}
+
+// Panics on the tenth entry.
+type panickingReducer struct{}
+
+func (r *panickingReducer) Reduce(input chan *Entry, output chan *Entry) {
+	count := 0
+	for range input {
+		count++
+		if count == 10 {
+			panic("boom")
+		}
+	}
+	close(output)
 }
@@ -0,0 +1,124 @@
+package gonx
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var registry = struct {
+	sync.RWMutex
+	parsers map[string]func() StringParser
+	filters map[string]func() Filter
+}{
+	parsers: make(map[string]func() StringParser),
+	filters: make(map[string]func() Filter),
+}
+
+func init() {
+	RegisterFormat("common", CommonFormat)
+	RegisterFormat("combined", CombinedFormat)
+	RegisterFormat("alb", ALBFormat)
+	RegisterFormat("traefik", TraefikFormat)
+	RegisterParser("varnishncsa", func() StringParser {
+		parser, _ := NewVarnishncsaParser("")
+		return parser
+	})
+	RegisterParser("squid", func() StringParser { return NewSquidParser() })
+	RegisterParser("ltsv", func() StringParser { return NewLTSVParser() })
+	RegisterParser("json", func() StringParser { return NewJSONParser() })
+	RegisterParser("json_nested", func() StringParser { return NewNestedJSONParser() })
+	RegisterParser("caddy", func() StringParser { return NewCaddyParser() })
+	RegisterParser("traefik_json", func() StringParser { return NewTraefikJSONParser() })
+}
+
+// RegisterParser makes a parser available by the provided name, e.g. for
+// the config files and command line flags. Site-specific parsers should
+// be registered in the package init function, so they are available as
+// soon as the package (or the plugin, see LoadPlugin) is loaded. If
+// RegisterParser is called twice with the same name it panics.
+func RegisterParser(name string, factory func() StringParser) {
+	registry.Lock()
+	defer registry.Unlock()
+	if factory == nil {
+		panic("gonx: RegisterParser factory is nil")
+	}
+	if _, dup := registry.parsers[name]; dup {
+		panic("gonx: RegisterParser called twice for parser " + name)
+	}
+	registry.parsers[name] = factory
+}
+
+// RegisterFormat makes a parser for the log format available by the
+// provided name, e.g. "main" for the site-wide nginx log_format. ParserByName
+// returns a new Parser for it. If RegisterFormat is called twice with the
+// same name (or a parser is registered with it) it panics.
+func RegisterFormat(name string, format string) {
+	// Compile format once, parsers share the read-only regexps
+	compiled := NewParser(format)
+	RegisterParser(name, func() StringParser {
+		parser := *compiled
+		return &parser
+	})
+}
+
+// RegisterFilter makes a filter (or entries enricher) available by the
+// provided name. If RegisterFilter is called twice with the same name it
+// panics.
+func RegisterFilter(name string, factory func() Filter) {
+	registry.Lock()
+	defer registry.Unlock()
+	if factory == nil {
+		panic("gonx: RegisterFilter factory is nil")
+	}
+	if _, dup := registry.filters[name]; dup {
+		panic("gonx: RegisterFilter called twice for filter " + name)
+	}
+	registry.filters[name] = factory
+}
+
+// Returns a new parser registered with the given name.
+func ParserByName(name string) (StringParser, error) {
+	registry.RLock()
+	factory, ok := registry.parsers[name]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("parser '%v' is not registered", name)
+	}
+	return factory(), nil
+}
+
+// Returns a new filter registered with the given name.
+func FilterByName(name string) (Filter, error) {
+	registry.RLock()
+	factory, ok := registry.filters[name]
+	registry.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("filter '%v' is not registered", name)
+	}
+	return factory(), nil
+}
+
+// Returns a sorted list of the registered parser names.
+func Parsers() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	var names []string
+	for name := range registry.parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns a sorted list of the registered filter names.
+func Filters() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	var names []string
+	for name := range registry.filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
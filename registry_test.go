@@ -0,0 +1,75 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	Convey("Test parsers and filters registry", t, func() {
+		Convey("Builtin parsers", func() {
+			So(Parsers(), ShouldContain, "caddy")
+			parser, err := ParserByName("traefik")
+			So(err, ShouldBeNil)
+			So(parser, ShouldHaveSameTypeAs, &Parser{})
+		})
+
+		Convey("Register custom parser and filter", func() {
+			// Registry is global, register once for repeated test runs
+			if _, err := ParserByName("test_site"); err != nil {
+				RegisterParser("test_site", func() StringParser {
+					return NewParser("$remote_addr $site_id")
+				})
+				RegisterFilter("test_fast", func() Filter {
+					return &DurationClass{Field: "request_time"}
+				})
+			}
+
+			parser, err := ParserByName("test_site")
+			So(err, ShouldBeNil)
+			entry, err := parser.ParseString("89.234.89.123 42")
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{"remote_addr": "89.234.89.123", "site_id": "42"}))
+
+			So(Filters(), ShouldContain, "test_fast")
+			filter, err := FilterByName("test_fast")
+			So(err, ShouldBeNil)
+			So(filter, ShouldNotBeNil)
+
+			So(func() {
+				RegisterParser("test_site", func() StringParser { return NewJSONParser() })
+			}, ShouldPanic)
+		})
+
+		Convey("Unknown names", func() {
+			_, err := ParserByName("unknown")
+			So(err, ShouldNotBeNil)
+			_, err = FilterByName("unknown")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Load missing plugin", func() {
+			So(LoadPlugin("/nonexistent/gonx-plugin.so"), ShouldNotBeNil)
+		})
+
+		Convey("Register custom format", func() {
+			if _, err := ParserByName("test_format"); err != nil {
+				RegisterFormat("test_format", "$remote_addr [$time_local]")
+			}
+			parser, err := ParserByName("test_format")
+			So(err, ShouldBeNil)
+			entry, err := parser.ParseString("89.234.89.123 [08/Nov/2013:13:39:18 +0000]")
+			So(err, ShouldBeNil)
+			So(entry, ShouldResemble, NewEntry(Fields{"remote_addr": "89.234.89.123", "time_local": "08/Nov/2013:13:39:18 +0000"}))
+
+			// Parsers are independent instances
+			parser.(*Parser).DashAsEmpty = true
+			other, _ := ParserByName("test_format")
+			So(other.(*Parser).DashAsEmpty, ShouldBeFalse)
+
+			So(Parsers(), ShouldContain, "combined")
+			So(func() { RegisterFormat("test_format", "$status") }, ShouldPanic)
+		})
+	})
+}
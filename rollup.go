@@ -0,0 +1,100 @@
+package gonx
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Implements Reducer interface to aggregate the entries at several grouping
+// levels in one pass, like SQL ROLLUP, e.g. the requests count per vhost
+// per status, per vhost and the grand total:
+//
+//	NewRollup([]string{"host", "status"}, new(Count))
+//
+// The levels are the Fields prefixes, from all of them to none. Set Cube to
+// aggregate all the Fields combinations instead, like SQL CUBE. Each level
+// is GroupBy of its fields with the related reducers, the results are
+// written level by level, the most detailed first. The level results do not
+// have the fields rolled up, e.g. the grand total result has the reducers
+// fields only.
+type Rollup struct {
+	Fields []string
+	Cube   bool
+
+	reducers []Reducer
+}
+
+func NewRollup(fields []string, reducers ...Reducer) *Rollup {
+	return &Rollup{
+		Fields:   fields,
+		reducers: reducers,
+	}
+}
+
+// Apply related reducers to each grouping level and write the levels
+// results.
+func (r *Rollup) Reduce(input chan *Entry, output chan *Entry) {
+	levels := r.levels()
+	inputs := make([]chan *Entry, len(levels))
+	results := make([][]*Entry, len(levels))
+	var wg sync.WaitGroup
+	for i, fields := range levels {
+		inputs[i] = make(chan *Entry, cap(input))
+		levelOutput := make(chan *Entry, cap(output))
+		go NewGroupBy(fields, r.reducers...).Reduce(inputs[i], levelOutput)
+		// Results are collected concurrently, so the levels are not blocked
+		// by each other.
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for entry := range levelOutput {
+				results[i] = append(results[i], entry)
+			}
+		}(i)
+	}
+	for entry := range input {
+		for _, levelInput := range inputs {
+			levelInput <- entry
+		}
+	}
+	for _, levelInput := range inputs {
+		close(levelInput)
+	}
+	wg.Wait()
+	for _, levelResults := range results {
+		for _, entry := range levelResults {
+			output <- entry
+		}
+	}
+	close(output)
+}
+
+// Returns the fields of the grouping levels, the most detailed first. The
+// Cube levels of the same size are in the Fields order, e.g. [a b], [a],
+// [b] and [].
+func (r *Rollup) levels() [][]string {
+	n := len(r.Fields)
+	var levels [][]string
+	if !r.Cube {
+		for size := n; size >= 0; size-- {
+			levels = append(levels, r.Fields[:size])
+		}
+		return levels
+	}
+	for size := n; size >= 0; size-- {
+		// The first field is the highest bit of the mask
+		for mask := 1<<uint(n) - 1; mask >= 0; mask-- {
+			if bits.OnesCount(uint(mask)) != size {
+				continue
+			}
+			fields := []string{}
+			for i, name := range r.Fields {
+				if mask&(1<<uint(n-1-i)) != 0 {
+					fields = append(fields, name)
+				}
+			}
+			levels = append(levels, fields)
+		}
+	}
+	return levels
+}
@@ -0,0 +1,55 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRollup(t *testing.T) {
+	Convey("Test rollup reducer", t, func() {
+		input := make(chan *Entry, 10)
+		for _, fields := range []Fields{
+			{"host": "a.com", "status": "200"},
+			{"host": "b.com", "status": "200"},
+			{"host": "a.com", "status": "500"},
+			{"host": "a.com", "status": "200"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		output := make(chan *Entry, 10)
+		var results []Fields
+
+		Convey("Rollup levels", func() {
+			NewRollup([]string{"host", "status"}, new(Count)).Reduce(input, output)
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			So(results, ShouldResemble, []Fields{
+				{"host": "a.com", "status": "200", "count": "2"},
+				{"host": "a.com", "status": "500", "count": "1"},
+				{"host": "b.com", "status": "200", "count": "1"},
+				{"host": "a.com", "count": "3"},
+				{"host": "b.com", "count": "1"},
+				{"count": "4"},
+			})
+		})
+
+		Convey("Cube levels", func() {
+			cube := NewRollup([]string{"host", "status"}, new(Count))
+			cube.Cube = true
+			So(cube.levels(), ShouldResemble, [][]string{
+				{"host", "status"}, {"host"}, {"status"}, {},
+			})
+			cube.Reduce(input, output)
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			So(results, ShouldHaveLength, 8)
+			So(results[5], ShouldResemble, Fields{"status": "200", "count": "3"})
+			So(results[6], ShouldResemble, Fields{"status": "500", "count": "1"})
+			So(results[7], ShouldResemble, Fields{"count": "4"})
+		})
+	})
+}
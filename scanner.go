@@ -0,0 +1,249 @@
+package gonx
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Format variable, "*" for the catch-all headers variables and the
+// character right after it, or "? " for the optional variables.
+var formatVar = regexp.MustCompile(`\$([a-z_]+)(\*?)(\? |.)`)
+
+// Header name in the catch-all headers value and the separator before it.
+var headerName = regexp.MustCompile(`(?:^|[;,]?\s+|[;,])([A-Za-z][A-Za-z0-9_-]*):[ \t]*`)
+
+// Compiled log format. The format scanner is a faster replacement of the
+// format regexp: each variable value lasts until the character following
+// it in the format, so the line is split with the plain string search. It
+// matches exactly the same lines as the format regexp, which is generated
+// from the same compiled format.
+type formatScanner struct {
+	// Literal text before the first variable
+	prefix string
+	fields []scanField
+	// Format has optional variables, the scanner has to backtrack
+	optional bool
+	// Field names of the catch-all headers variables
+	names *nameTable
+}
+
+type scanField struct {
+	name string
+	// Value stop character and the literal text after the value, which
+	// starts with it (unless trimmed at the end of format)
+	stop    string
+	literal string
+	// Optional variable and the space before it could be missing
+	optional bool
+	lead     string
+	// Catch-all headers variable, the name is the fields prefix
+	headers bool
+}
+
+// Compile format into the scanner. Variables followed by "?" and a space
+// (or the format end) are optional, e.g. "$status $request_time?" matches
+// lines with and without the request time.
+func newFormatScanner(format string) *formatScanner {
+	// Spaces are trimmed on both ends of the format
+	format = strings.Trim(format, " ") + " "
+	scanner := &formatScanner{names: new(nameTable)}
+	literalStart := 0
+	setLiteral := func(end int) {
+		if len(scanner.fields) == 0 {
+			scanner.prefix = format[:end]
+		} else {
+			scanner.fields[len(scanner.fields)-1].literal = format[literalStart:end]
+		}
+	}
+	for _, m := range formatVar.FindAllStringSubmatchIndex(format, -1) {
+		field := scanField{
+			name:    format[m[2]:m[3]],
+			stop:    format[m[6]:m[7]],
+			headers: m[5] > m[4],
+		}
+		start, next := m[0], m[6]
+		if field.stop == "? " {
+			field.stop, field.optional = " ", true
+			scanner.optional = true
+			next++
+			// The space before is the part of the optional segment
+			if start > literalStart && format[start-1] == ' ' {
+				field.lead = " "
+				start--
+			}
+		}
+		setLiteral(start)
+		scanner.fields = append(scanner.fields, field)
+		literalStart = next
+	}
+	setLiteral(len(format))
+	if len(scanner.fields) == 0 {
+		scanner.prefix = strings.TrimRight(scanner.prefix, " ")
+	} else {
+		last := &scanner.fields[len(scanner.fields)-1]
+		last.literal = strings.TrimRight(last.literal, " ")
+	}
+	return scanner
+}
+
+// Generate the format regexp, values could contain backslash escaped
+// characters if escaped is true.
+func (s *formatScanner) regexp(escaped bool) *regexp.Regexp {
+	var re strings.Builder
+	re.WriteString("^" + regexp.QuoteMeta(s.prefix))
+	for _, field := range s.fields {
+		stop := field.stop
+		if stop == `\` {
+			stop = `\\`
+		}
+		value := "[^" + stop + "]*"
+		if escaped {
+			value = `(?:[^` + stop + `\\]|\\.)*`
+		}
+		group := "(?P<" + field.name + ">" + value + ")"
+		if field.optional {
+			group = "(?:" + regexp.QuoteMeta(field.lead) + group + ")?"
+		}
+		re.WriteString(group + regexp.QuoteMeta(field.literal))
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+// Scan the line and call set for each variable value. Values could contain
+// backslash escaped characters (including the stop character) if escaped
+// is true. It returns false if the line does not match the format, the
+// number of the matched bytes tells where the scan stopped (it is the line
+// length if the line is a truncated record).
+func (s *formatScanner) scan(line string, escaped bool, set func(name, value string)) (int, bool) {
+	if !strings.HasPrefix(line, s.prefix) {
+		return partialPrefix(line, s.prefix), false
+	}
+	if s.optional {
+		values := make([]string, len(s.fields))
+		present := make([]bool, len(s.fields))
+		matched, ok := s.match(line, len(s.prefix), 0, escaped, values, present)
+		if ok {
+			for i, field := range s.fields {
+				if present[i] {
+					field.set(values[i], s.names, set)
+				}
+			}
+		}
+		return matched, ok
+	}
+	offset := len(s.prefix)
+	for _, field := range s.fields {
+		value, n, ok := field.match(line[offset:], escaped)
+		if !ok {
+			return offset + n, false
+		}
+		field.set(value, s.names, set)
+		offset += n
+	}
+	return offset, offset == len(line)
+}
+
+// Match fields starting from the k-th one, optional fields are tried to
+// be present first.
+func (s *formatScanner) match(line string, offset, k int, escaped bool, values []string, present []bool) (int, bool) {
+	if k == len(s.fields) {
+		return offset, offset == len(line)
+	}
+	field := s.fields[k]
+	rest := line[offset:]
+	matched := offset
+	if !field.optional || strings.HasPrefix(rest, field.lead) {
+		lead := len(field.lead)
+		value, n, ok := field.match(rest[lead:], escaped)
+		if ok {
+			values[k], present[k] = value, true
+			if end, ok := s.match(line, offset+lead+n, k+1, escaped, values, present); ok {
+				return end, true
+			} else if end > matched {
+				matched = end
+			}
+		} else if offset+lead+n > matched {
+			matched = offset + lead + n
+		}
+	}
+	if field.optional && strings.HasPrefix(rest, field.literal) {
+		present[k] = false
+		if end, ok := s.match(line, offset+len(field.literal), k+1, escaped, values, present); ok {
+			return end, true
+		} else if end > matched {
+			matched = end
+		}
+	}
+	return matched, false
+}
+
+// Match the field value and the literal after it at the beginning of s.
+// It returns the value and the matched length, or the length of the
+// matched part if it does not match.
+func (field *scanField) match(s string, escaped bool) (string, int, bool) {
+	var i int
+	if escaped {
+		i = escapedIndex(s, field.stop)
+	} else {
+		i = strings.Index(s, field.stop)
+	}
+	if i < 0 {
+		i = len(s)
+	}
+	if !strings.HasPrefix(s[i:], field.literal) {
+		return "", i + partialPrefix(s[i:], field.literal), false
+	}
+	return s[:i], i + len(field.literal), true
+}
+
+// Length of the s that matches the prefix, it is len(s) if s is the
+// beginning of the prefix.
+func partialPrefix(s string, prefix string) int {
+	i := 0
+	for i < len(s) && i < len(prefix) && s[i] == prefix[i] {
+		i++
+	}
+	return i
+}
+
+// Set the field value. Catch-all headers values are split into the
+// "Name: value" pairs, each pair is set as the field with the prefixed
+// nginx-style header name, e.g. http_user_agent, interned in names.
+func (field *scanField) set(value string, names *nameTable, set func(name, value string)) {
+	if !field.headers {
+		set(field.name, value)
+		return
+	}
+	matches := headerName.FindAllStringSubmatchIndex(value, -1)
+	for i, m := range matches {
+		end := len(value)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		set(names.intern(field.name+nginxName(value[m[2]:m[3]])), strings.TrimSpace(value[m[1]:end]))
+	}
+}
+
+// Index of the first stop character which is not escaped with a backslash.
+// Returns -1 if there is no stop character.
+func escapedIndex(s string, stop string) int {
+	for i := 0; i < len(s); {
+		if s[i] == '\\' && i+1 < len(s) && s[i+1] != '\n' {
+			_, size := utf8.DecodeRuneInString(s[i+1:])
+			i += 1 + size
+			continue
+		}
+		if strings.HasPrefix(s[i:], stop) {
+			return i
+		}
+		if s[i] == '\\' {
+			// Unpaired backslash can't be a part of the value
+			return i
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+	}
+	return -1
+}
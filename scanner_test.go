@@ -0,0 +1,79 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFormatScanner(t *testing.T) {
+	Convey("Test format scanner matches the same lines as the regexp", t, func() {
+		cases := []struct {
+			format string
+			lines  []string
+		}{
+			{
+				`$remote_addr [$time_local] "$request"`,
+				[]string{
+					`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET /api/foo/bar HTTP/1.1"`,
+					`89.234.89.123 [08/Nov/2013:13:39:18 +0000] "GET /api/foo/bar HTTP/1.1" tail`,
+					`89.234.89.123 [08/Nov/2013:13:39:18 +0000 "GET /api/foo/bar HTTP/1.1"`,
+					` [] ""`,
+					``,
+				},
+			},
+			{
+				`$remote_addr $status`,
+				[]string{"127.0.0.1 200", "127.0.0.1 200 ", "127.0.0.1", "127.0.0.1  200", "127.0.0.1\n200 -"},
+			},
+			{
+				` <$a$b>  `,
+				[]string{"<x$b>", " <x$b>", "<x$b> ", "<x>"},
+			},
+			{
+				`$remote_addr $request_time? "$request" $upstream_time?`,
+				[]string{
+					`127.0.0.1 0.1 "GET / HTTP/1.1" 0.05`,
+					`127.0.0.1 "GET / HTTP/1.1" 0.05`,
+					`127.0.0.1 0.1 "GET / HTTP/1.1"`,
+					`127.0.0.1 "GET / HTTP/1.1"`,
+					`127.0.0.1  "GET / HTTP/1.1"`,
+					`127.0.0.1 "GET / HTTP/1.1" 0.05 1`,
+				},
+			},
+			{
+				`$a? $b?$c`,
+				[]string{"x y?z", " y?z", "y?z", "x y"},
+			},
+			{
+				`static`,
+				[]string{"static", "static ", "stat"},
+			},
+		}
+		for _, c := range cases {
+			parser := NewParser(c.format)
+			for _, line := range c.lines {
+				expected, expectedErr := (&Parser{regexp: parser.regexp}).ParseString(line)
+				entry, err := parser.ParseString(line)
+				So(err == nil, ShouldEqual, expectedErr == nil)
+				So(entry, ShouldResemble, expected)
+			}
+		}
+
+		Convey("Escaped values", func() {
+			parser := NewParser(`"$request" $status`)
+			parser.Escape = EscapeJSON
+			for _, line := range []string{
+				`"GET /?q=\"foo\" HTTP/1.1" 200`,
+				`"GET /\\" 200`,
+				`"GET /\" 200`,
+				`"GET /\` + "\n" + `" 200`,
+			} {
+				expected, expectedErr := (&Parser{regexp: parser.escapedRegexp, Escape: EscapeJSON}).ParseString(line)
+				entry, err := parser.ParseString(line)
+				So(err == nil, ShouldEqual, expectedErr == nil)
+				So(entry, ShouldResemble, expected)
+			}
+		})
+	})
+}
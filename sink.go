@@ -0,0 +1,21 @@
+package gonx
+
+// Sink is the interface for the entries destination, e.g. HTTP endpoint,
+// Elasticsearch index or SQL table. Use the experimental gonx/x/sink package
+// to write reduced entries to the Sink.
+//
+// WriteEntries method should write a batch of entries and return an error if
+// the batch was not written. It could be called from several goroutines at
+// the same time.
+type Sink interface {
+	WriteEntries(entries []*Entry) error
+}
+
+// The SinkFunc type is an adapter to allow the use of ordinary functions as
+// a Sink.
+type SinkFunc func(entries []*Entry) error
+
+// WriteEntries calls f(entries).
+func (f SinkFunc) WriteEntries(entries []*Entry) error {
+	return f(entries)
+}
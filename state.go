@@ -0,0 +1,186 @@
+package gonx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StatefulReducer is an optional interface of the reducers which keep the
+// aggregation state between the Reduce calls, so the incremental jobs
+// (e.g. run by cron every 5 minutes with the Reader offset checkpoint)
+// carry it across the runs: load the state, reduce the new entries and
+// save the state for the next run.
+type StatefulReducer interface {
+	Reducer
+	// Write the aggregation state.
+	SaveState(w io.Writer) error
+	// Replace the aggregation state with the saved one.
+	LoadState(r io.Reader) error
+}
+
+// Implements StatefulReducer interface for the Aggregator, e.g. the total
+// requests count across the runs:
+//
+//	count := &Stateful{Aggregator: new(Count)}
+//	count.LoadState(file)
+//	count.Reduce(input, output)
+//
+// The state is JSON encoded, the Aggregator configuration (e.g. the Sum
+// fields) is not saved. The states of the parallel runs are combined with
+// Merge. Use StatefulGroupBy to keep the GroupBy groups state.
+type Stateful struct {
+	Aggregator Aggregator
+
+	aggregate Aggregate
+}
+
+// Add the input entries to the aggregation state and write the result of
+// all the entries reduced so far.
+func (r *Stateful) Reduce(input chan *Entry, output chan *Entry) {
+	if r.aggregate == nil {
+		r.aggregate = r.Aggregator.NewAggregate()
+	}
+	for entry := range input {
+		r.aggregate.Add(entry)
+	}
+	output <- r.aggregate.Result()
+	close(output)
+}
+
+// Write the aggregation state as JSON.
+func (r *Stateful) SaveState(w io.Writer) error {
+	if r.aggregate == nil {
+		r.aggregate = r.Aggregator.NewAggregate()
+	}
+	return json.NewEncoder(w).Encode(r.aggregate)
+}
+
+// Replace the aggregation state with the JSON one saved by SaveState.
+func (r *Stateful) LoadState(reader io.Reader) error {
+	aggregate := r.Aggregator.NewAggregate()
+	if err := json.NewDecoder(reader).Decode(aggregate); err != nil {
+		return fmt.Errorf("gonx: %T state: %v", r.Aggregator, err)
+	}
+	r.aggregate = aggregate
+	return nil
+}
+
+// Merge the state of the other run of the same Aggregator, e.g. of the
+// other log file, into this one. It returns an error if the Aggregator
+// state is not Mergeable.
+func (r *Stateful) Merge(other *Stateful) error {
+	if r.aggregate == nil {
+		r.aggregate = r.Aggregator.NewAggregate()
+	}
+	mergeable, ok := r.aggregate.(Mergeable)
+	if !ok {
+		return fmt.Errorf("gonx: %T state is not mergeable", r.Aggregator)
+	}
+	if other.aggregate == nil {
+		return nil
+	}
+	return mergeable.Merge(other.aggregate)
+}
+
+// Implements StatefulReducer interface for GroupBy of the Aggregators (e.g.
+// Count, Sum and Avg), which keeps the groups between the Reduce calls, so
+// the incremental jobs carry them across the runs (see StatefulReducer)
+// and the groups of the parallel or sharded runs could be merged, e.g.
+// requests per URI of two log files reduced concurrently:
+//
+//	first, _ := NewStatefulGroupBy(NewGroupBy(fields, new(Count)))
+//	second, _ := NewStatefulGroupBy(NewGroupBy(fields, new(Count)))
+//	// Reduce the entries of each file with first and second, then
+//	err := first.Merge(second)
+//
+// Reduce writes the results of all the entries reduced and merged so far,
+// in the GroupBy order. The Fields, Key, KeyField and OrderBy of the GroupBy
+// are applied, the groups limits and the partial results options are not.
+type StatefulGroupBy struct {
+	GroupBy *GroupBy
+
+	groups *aggregateGroups
+}
+
+// Returns the StatefulGroupBy of the GroupBy, it returns an error if any of
+// its reducers is not an Aggregator.
+func NewStatefulGroupBy(groupBy *GroupBy) (*StatefulGroupBy, error) {
+	aggregators, ok := aggregators(groupBy.reducers)
+	if !ok {
+		return nil, fmt.Errorf("gonx: StatefulGroupBy reducers should be Aggregators")
+	}
+	groups := &aggregateGroups{aggregators, make(map[string]*aggregateGroup)}
+	return &StatefulGroupBy{GroupBy: groupBy, groups: groups}, nil
+}
+
+// Add the input entries to the groups and write the results of all the
+// groups.
+func (r *StatefulGroupBy) Reduce(input chan *Entry, output chan *Entry) {
+	for entry := range input {
+		key := r.GroupBy.key(entry)
+		if !r.groups.has(key) {
+			result := entry.Partial(r.GroupBy.Fields)
+			if r.GroupBy.KeyField != "" {
+				result.SetField(r.GroupBy.KeyField, key)
+			}
+			r.groups.create(key, result)
+		}
+		r.groups.add(key, entry)
+	}
+	r.GroupBy.write(r.groups.results(false), output)
+	close(output)
+}
+
+// Merge the groups of the other run of the same GroupBy into this one, it
+// returns an error if any of the aggregates is not Mergeable, e.g. of Fold.
+func (r *StatefulGroupBy) Merge(other *StatefulGroupBy) error {
+	return r.groups.merge(other.groups)
+}
+
+// Saved state of the group, see StatefulGroupBy.SaveState.
+type groupState struct {
+	Result     *Entry            `json:"result"`
+	Aggregates []json.RawMessage `json:"aggregates"`
+}
+
+// Write the groups state as JSON, the group fields values and the
+// aggregates state of each group.
+func (r *StatefulGroupBy) SaveState(w io.Writer) error {
+	state := make(map[string]groupState, len(r.groups.groups))
+	for key, group := range r.groups.groups {
+		aggregates := make([]json.RawMessage, len(group.aggregates))
+		for i, aggregate := range group.aggregates {
+			data, err := json.Marshal(aggregate)
+			if err != nil {
+				return fmt.Errorf("gonx: %T state: %v", r.groups.aggregators[i], err)
+			}
+			aggregates[i] = data
+		}
+		state[key] = groupState{group.result, aggregates}
+	}
+	return json.NewEncoder(w).Encode(state)
+}
+
+// Replace the groups state with the JSON one saved by SaveState of the same
+// GroupBy.
+func (r *StatefulGroupBy) LoadState(reader io.Reader) error {
+	var state map[string]groupState
+	if err := json.NewDecoder(reader).Decode(&state); err != nil {
+		return fmt.Errorf("gonx: StatefulGroupBy state: %v", err)
+	}
+	groups := &aggregateGroups{r.groups.aggregators, make(map[string]*aggregateGroup)}
+	for key, saved := range state {
+		if saved.Result == nil || len(saved.Aggregates) != len(groups.aggregators) {
+			return fmt.Errorf("gonx: StatefulGroupBy state: group %q does not match the reducers", key)
+		}
+		groups.create(key, saved.Result)
+		for i, aggregate := range groups.groups[key].aggregates {
+			if err := json.Unmarshal(saved.Aggregates[i], aggregate); err != nil {
+				return fmt.Errorf("gonx: %T state: %v", groups.aggregators[i], err)
+			}
+		}
+	}
+	r.groups = groups
+	return nil
+}
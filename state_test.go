@@ -0,0 +1,129 @@
+package gonx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateful(t *testing.T) {
+	Convey("Test stateful reducer", t, func() {
+		run := func(reducer Reducer, values ...string) Fields {
+			input := make(chan *Entry, len(values))
+			for _, value := range values {
+				input <- NewEntry(Fields{"bytes": value})
+			}
+			close(input)
+			output := make(chan *Entry, 1)
+			reducer.Reduce(input, output)
+			return (<-output).Fields()
+		}
+
+		Convey("Carry state across runs", func() {
+			for _, aggregator := range []Aggregator{
+				new(Count), &Sum{[]string{"bytes"}}, &IntSum{[]string{"bytes"}}, &Avg{[]string{"bytes"}},
+			} {
+				first := &Stateful{Aggregator: aggregator}
+				run(first, "1", "2")
+				var state bytes.Buffer
+				So(first.SaveState(&state), ShouldBeNil)
+
+				second := &Stateful{Aggregator: aggregator}
+				So(second.LoadState(&state), ShouldBeNil)
+				So(run(second, "9223372036854775807", "3"), ShouldResemble,
+					run(aggregator, "1", "2", "9223372036854775807", "3"))
+			}
+		})
+
+		Convey("Merge states of parallel runs", func() {
+			first := &Stateful{Aggregator: &Avg{[]string{"bytes"}}}
+			run(first, "1", "2")
+			second := &Stateful{Aggregator: &Avg{[]string{"bytes"}}}
+			run(second, "3", "4", "5", "6")
+			So(first.Merge(second), ShouldBeNil)
+			So(first.Merge(&Stateful{Aggregator: &Avg{[]string{"bytes"}}}), ShouldBeNil)
+			So(run(first), ShouldResemble, Fields{"bytes": "3.50", "bytes_count": "6", "count": "6"})
+		})
+
+		Convey("Save empty state", func() {
+			var state bytes.Buffer
+			So((&Stateful{Aggregator: new(Count)}).SaveState(&state), ShouldBeNil)
+			So(state.String(), ShouldEqual, "{\"count\":0}\n")
+		})
+
+		Convey("Invalid state", func() {
+			reducer := &Stateful{Aggregator: new(Count)}
+			So(reducer.LoadState(strings.NewReader("{")), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestStatefulGroupBy(t *testing.T) {
+	Convey("Test stateful GroupBy", t, func() {
+		run := func(reducer Reducer, uris ...string) (results []Fields) {
+			input := make(chan *Entry, len(uris))
+			for _, uri := range uris {
+				input <- NewEntry(Fields{"uri": uri, "time": "1"})
+			}
+			close(input)
+			output := make(chan *Entry, 10)
+			reducer.Reduce(input, output)
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			return
+		}
+		newGroupBy := func() *StatefulGroupBy {
+			groupBy, err := NewStatefulGroupBy(NewGroupBy([]string{"uri"}, new(Count), &Avg{[]string{"time"}}))
+			So(err, ShouldBeNil)
+			return groupBy
+		}
+
+		Convey("Merge groups of parallel runs", func() {
+			first, second := newGroupBy(), newGroupBy()
+			run(first, "/a", "/b", "/a")
+			run(second, "/c", "/a")
+			So(first.Merge(second), ShouldBeNil)
+			So(run(first, "/c"), ShouldResemble, []Fields{
+				{"uri": "/a", "count": "3", "time": "1.00", "time_count": "3"},
+				{"uri": "/b", "count": "1", "time": "1.00", "time_count": "1"},
+				{"uri": "/c", "count": "2", "time": "1.00", "time_count": "2"},
+			})
+		})
+
+		Convey("Carry groups across runs", func() {
+			first := newGroupBy()
+			run(first, "/a", "/b", "/a")
+			var state bytes.Buffer
+			So(first.SaveState(&state), ShouldBeNil)
+
+			second := newGroupBy()
+			So(second.LoadState(&state), ShouldBeNil)
+			So(run(second, "/a"), ShouldResemble, []Fields{
+				{"uri": "/a", "count": "3", "time": "1.00", "time_count": "3"},
+				{"uri": "/b", "count": "1", "time": "1.00", "time_count": "1"},
+			})
+		})
+
+		Convey("Invalid groups state", func() {
+			groupBy := newGroupBy()
+			So(groupBy.LoadState(strings.NewReader("{")), ShouldNotBeNil)
+			So(groupBy.LoadState(strings.NewReader(`{"/a":{"result":{},"aggregates":[{}]}}`)), ShouldNotBeNil)
+		})
+
+		Convey("Reject reducers that are not aggregators", func() {
+			_, err := NewStatefulGroupBy(NewGroupBy([]string{"uri"}, new(Distinct)))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Reject aggregates that are not mergeable", func() {
+			fold := &Fold{Step: func(acc, entry *Entry) *Entry { return acc }}
+			first, _ := NewStatefulGroupBy(NewGroupBy([]string{"uri"}, fold))
+			second, _ := NewStatefulGroupBy(NewGroupBy([]string{"uri"}, fold))
+			run(second, "/a")
+			So(first.Merge(second), ShouldNotBeNil)
+		})
+	})
+}
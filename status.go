@@ -0,0 +1,48 @@
+package gonx
+
+// Implements Reducer interface to count the entries by the status class,
+// e.g. "2xx" or "5xx", and their percentage of all the entries with the
+// valid status, in one result entry:
+//
+//	2xx: 950, 2xx_percent: 95.00, 3xx: 0, ..., 5xx: 10, 5xx_percent: 1.00
+//
+// The count field is the number of entries with the valid status, the 1xx
+// ones are counted there too.
+type StatusClasses struct {
+	// Status field name, "status" by default.
+	Field string
+}
+
+var statusClasses = []string{"2xx", "3xx", "4xx", "5xx"}
+
+// Count the input entries by the status class and write the counts.
+func (r *StatusClasses) Reduce(input chan *Entry, output chan *Entry) {
+	field := r.Field
+	if field == "" {
+		field = "status"
+	}
+	var total uint64
+	counts := make([]uint64, len(statusClasses))
+	for entry := range input {
+		status, err := entry.IntField(field)
+		if err != nil || status < 100 || status > 599 {
+			continue
+		}
+		total++
+		if class := status/100 - 2; class >= 0 {
+			counts[class]++
+		}
+	}
+	entry := NewEmptyEntry()
+	entry.SetUintField("count", total)
+	for i, class := range statusClasses {
+		var percent float64
+		if total > 0 {
+			percent = float64(counts[i]) / float64(total) * 100
+		}
+		entry.SetUintField(class, counts[i])
+		entry.SetFloatField(class+"_percent", percent)
+	}
+	output <- entry
+	close(output)
+}
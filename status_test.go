@@ -0,0 +1,42 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStatusClasses(t *testing.T) {
+	Convey("Test status classes reducer", t, func() {
+		output := make(chan *Entry, 1)
+
+		Convey("Count status classes", func() {
+			input := make(chan *Entry, 10)
+			for _, status := range []string{"200", "204", "301", "404", "200", "502", "101", "-", "999", "200"} {
+				input <- NewEntry(Fields{"status": status})
+			}
+			close(input)
+			new(StatusClasses).Reduce(input, output)
+			So((<-output).Fields(), ShouldResemble, Fields{
+				"count":       "8",
+				"2xx":         "4",
+				"2xx_percent": "50.00",
+				"3xx":         "1",
+				"3xx_percent": "12.50",
+				"4xx":         "1",
+				"4xx_percent": "12.50",
+				"5xx":         "1",
+				"5xx_percent": "12.50",
+			})
+		})
+
+		Convey("No entries", func() {
+			input := make(chan *Entry)
+			close(input)
+			(&StatusClasses{Field: "upstream_status"}).Reduce(input, output)
+			result := <-output
+			So(result.Fields()["count"], ShouldEqual, "0")
+			So(result.Fields()["5xx_percent"], ShouldEqual, "0.00")
+		})
+	})
+}
@@ -0,0 +1,161 @@
+package gonx
+
+import (
+	"math"
+	"sort"
+)
+
+// Implements Reducer interface to calculate the approximate percentiles of
+// the Field values in the fixed memory, so p99 over a full day's traffic
+// does not need all the values to be kept as Percentile does. Results are
+// named the same way as the Percentile ones, e.g. request_time_p99.
+//
+// It uses the t-digest sketch (see https://github.com/tdunning/t-digest):
+// the values are clustered into centroids, which are small near the tails,
+// so the extreme quantiles are the most accurate ones.
+type TDigest struct {
+	Field string
+	// Quantiles to calculate, 0.5, 0.9, 0.95 and 0.99 by default.
+	Quantiles []float64
+	// Accuracy and memory trade-off, the digest keeps about Compression / 2
+	// centroids, 100 by default. The quantiles error is within 0.001 for
+	// the default.
+	Compression float64
+}
+
+// Collect the Field values into the digest and write the percentiles to the
+// output. Missing and invalid values are skipped.
+func (r *TDigest) Reduce(input chan *Entry, output chan *Entry) {
+	digest := newDigest(r.Compression)
+	for entry := range input {
+		if value, err := entry.FloatField(r.Field); err == nil {
+			digest.add(value)
+		}
+	}
+	quantiles := r.Quantiles
+	if len(quantiles) == 0 {
+		quantiles = defaultQuantiles
+	}
+	entry := NewEmptyEntry()
+	if digest.count() > 0 {
+		for _, q := range quantiles {
+			entry.SetField(quantileField(r.Field, q), formatValue(digest.quantile(q)))
+		}
+	}
+	output <- entry
+	close(output)
+}
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+type centroids []centroid
+
+func (c centroids) Len() int           { return len(c) }
+func (c centroids) Less(i, j int) bool { return c[i].mean < c[j].mean }
+func (c centroids) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+
+// Merging t-digest. Values are buffered and merged into the centroids when
+// the buffer is full.
+type digest struct {
+	compression float64
+	centroids   centroids
+	buffer      centroids
+	total       float64
+	min, max    float64
+}
+
+func newDigest(compression float64) *digest {
+	if compression <= 0 {
+		compression = 100
+	}
+	return &digest{
+		compression: compression,
+		buffer:      make(centroids, 0, int(5*compression)),
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+func (d *digest) add(value float64) {
+	d.buffer = append(d.buffer, centroid{value, 1})
+	d.min = math.Min(d.min, value)
+	d.max = math.Max(d.max, value)
+	if len(d.buffer) == cap(d.buffer) {
+		d.merge()
+	}
+}
+
+func (d *digest) count() float64 {
+	return d.total + float64(len(d.buffer))
+}
+
+// Merge the buffered values into the centroids. Neighbour centroids are
+// merged while the merged centroid spans at most 1 on the scale.
+func (d *digest) merge() {
+	if len(d.buffer) == 0 {
+		return
+	}
+	all := append(d.centroids, d.buffer...)
+	sort.Sort(all)
+	d.total += float64(len(d.buffer))
+	merged := make(centroids, 0, len(d.centroids)+1)
+	current := all[0]
+	var before float64
+	for _, next := range all[1:] {
+		proposed := current.weight + next.weight
+		if d.scale((before+proposed)/d.total)-d.scale(before/d.total) <= 1 {
+			current.mean += (next.mean - current.mean) * next.weight / proposed
+			current.weight = proposed
+			continue
+		}
+		merged = append(merged, current)
+		before += current.weight
+		current = next
+	}
+	d.centroids = append(merged, current)
+	d.buffer = d.buffer[:0]
+}
+
+// The t-digest k1 scale function of the quantile. It is steep at the tails,
+// so the centroids are small there, and limits the number of centroids to
+// about Compression / 2.
+func (d *digest) scale(q float64) float64 {
+	return d.compression / (2 * math.Pi) * math.Asin(2*q-1)
+}
+
+// Estimate the quantile, it is interpolated between the centroids means,
+// the first and the last centroids are interpolated with the min and max
+// values.
+func (d *digest) quantile(q float64) float64 {
+	d.merge()
+	if len(d.centroids) == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return d.min
+	}
+	if q >= 1 {
+		return d.max
+	}
+	target := q * d.total
+	first := d.centroids[0]
+	if target < first.weight/2 {
+		return d.min + (first.mean-d.min)*target/(first.weight/2)
+	}
+	var before float64
+	for i := 0; i < len(d.centroids)-1; i++ {
+		left := before + d.centroids[i].weight/2
+		right := before + d.centroids[i].weight + d.centroids[i+1].weight/2
+		if target <= right {
+			t := (target - left) / (right - left)
+			return d.centroids[i].mean + t*(d.centroids[i+1].mean-d.centroids[i].mean)
+		}
+		before += d.centroids[i].weight
+	}
+	last := d.centroids[len(d.centroids)-1]
+	left := d.total - last.weight/2
+	return last.mean + (d.max-last.mean)*(target-left)/(last.weight/2)
+}
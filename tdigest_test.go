@@ -0,0 +1,71 @@
+package gonx
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTDigest(t *testing.T) {
+	Convey("Test t-digest quantiles", t, func() {
+		n := 100000
+		values := rand.New(rand.NewSource(1)).Perm(n)
+
+		Convey("Estimate quantiles in fixed memory", func() {
+			digest := newDigest(100)
+			for _, value := range values {
+				digest.add(float64(value + 1))
+			}
+			for _, q := range []float64{0.01, 0.5, 0.9, 0.99, 0.999} {
+				So(digest.quantile(q), ShouldAlmostEqual, q*float64(n), 0.001*float64(n))
+			}
+			So(digest.quantile(0), ShouldEqual, 1)
+			So(digest.quantile(1), ShouldEqual, n)
+			So(len(digest.centroids), ShouldBeLessThan, 100)
+		})
+
+		Convey("Small inputs", func() {
+			digest := newDigest(0)
+			digest.add(5)
+			So(digest.quantile(0.5), ShouldEqual, 5)
+			So(math.IsNaN(newDigest(0).quantile(0.5)), ShouldBeTrue)
+		})
+
+		Convey("Reduce entries", func() {
+			input := make(chan *Entry, 100)
+			output := make(chan *Entry, 1)
+			go func() {
+				for _, value := range values[:10000] {
+					input <- NewEntry(Fields{"request_time": strconv.Itoa(value)})
+				}
+				input <- NewEntry(Fields{"request_time": "invalid"})
+				close(input)
+			}()
+			reducer := &TDigest{Field: "request_time"}
+			reducer.Reduce(input, output)
+			result := <-output
+			So(result.Names(), ShouldResemble, []string{
+				"request_time_p50", "request_time_p90", "request_time_p95", "request_time_p99",
+			})
+			exact := make([]float64, 10000)
+			for i, value := range values[:10000] {
+				exact[i] = float64(value)
+			}
+			sort.Float64s(exact)
+			p99, _ := result.FloatField("request_time_p99")
+			So(p99, ShouldAlmostEqual, nearestRank(exact, 0.99), 0.002*float64(n))
+		})
+
+		Convey("No values", func() {
+			input := make(chan *Entry)
+			close(input)
+			output := make(chan *Entry, 1)
+			new(TDigest).Reduce(input, output)
+			So((<-output).Fields(), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,164 @@
+package gonx
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Implements Reducer interface to write N entries with the highest metric
+// value, the largest first.
+//
+// If Field is set, entries are grouped by its value and the groups are
+// ranked by the sum of the By field values, or by the entries count if By
+// is not set, e.g. top 20 URIs by requests count:
+//
+//	&TopN{Field: "request_uri", N: 20}
+//
+// Group results have the Field value, the count field and the By sum.
+// Otherwise the input entries (e.g. GroupBy results) are ranked by the By
+// field value as they are, the entries without the valid By value (e.g. the
+// "-" placeholder, see Entry.FloatField) are skipped. Entries with the same
+// value are written in the input order. All the entries or groups are
+// written if N is 0.
+type TopN struct {
+	Field string
+	N     int
+	By    string
+}
+
+// Rank the entries and write the top N of them to the output.
+func (r *TopN) Reduce(input chan *Entry, output chan *Entry) {
+	rank(input, output, r.Field, r.N, r.By, false)
+	close(output)
+}
+
+// Implements Reducer interface to write N entries with the smallest metric
+// value, the smallest first, e.g. the least hit endpoints, the rarest user
+// agents or the smallest responses. It is configured the same way as TopN.
+type BottomN struct {
+	Field string
+	N     int
+	By    string
+}
+
+// Rank the entries and write the bottom N of them to the output.
+func (r *BottomN) Reduce(input chan *Entry, output chan *Entry) {
+	rank(input, output, r.Field, r.N, r.By, true)
+	close(output)
+}
+
+// Entry with the metric value, index is the entry order for ties.
+type rankedEntry struct {
+	entry *Entry
+	value float64
+	index int
+}
+
+// Heap of the ranked entries, the worst kept entry is at the top, so it is
+// replaced when the better one comes.
+type rankedHeap struct {
+	entries []rankedEntry
+	bottom  bool
+}
+
+func (h *rankedHeap) Len() int { return len(h.entries) }
+
+// Check the entry i is worse than j.
+func (h *rankedHeap) Less(i, j int) bool { return h.worse(h.entries[i], h.entries[j]) }
+
+// Check the entry a is worse than b, the later entry is worse for ties.
+func (h *rankedHeap) worse(a, b rankedEntry) bool {
+	if a.value != b.value {
+		return (a.value < b.value) != h.bottom
+	}
+	return a.index > b.index
+}
+
+func (h *rankedHeap) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+
+func (h *rankedHeap) Push(x interface{}) { h.entries = append(h.entries, x.(rankedEntry)) }
+
+func (h *rankedHeap) Pop() interface{} {
+	last := h.entries[len(h.entries)-1]
+	h.entries = h.entries[:len(h.entries)-1]
+	return last
+}
+
+// Keep the n best entries, all of them if n is 0.
+func (h *rankedHeap) add(n int, ranked rankedEntry) {
+	if n <= 0 || h.Len() < n {
+		heap.Push(h, ranked)
+	} else if h.worse(h.entries[0], ranked) {
+		h.entries[0] = ranked
+		heap.Fix(h, 0)
+	}
+}
+
+// Return the kept entries, the best first.
+func (h *rankedHeap) sorted() []*Entry {
+	sort.Sort(sort.Reverse(h))
+	entries := make([]*Entry, len(h.entries))
+	for i, ranked := range h.entries {
+		entries[i] = ranked.entry
+	}
+	return entries
+}
+
+// Rank the input entries or the field groups and write n best of them, the
+// smallest values are the best if bottom is true.
+func rank(input chan *Entry, output chan *Entry, field string, n int, by string, bottom bool) {
+	ranked := &rankedHeap{bottom: bottom}
+	if field == "" {
+		index := 0
+		for entry := range input {
+			value, err := entry.FloatField(by)
+			if by != "" && err != nil {
+				continue
+			}
+			ranked.add(n, rankedEntry{entry, value, index})
+			index++
+		}
+	} else {
+		for _, group := range rankGroups(input, field, by) {
+			ranked.add(n, group)
+		}
+	}
+	for _, entry := range ranked.sorted() {
+		output <- entry
+	}
+}
+
+// Count the entries and sum the by field values for each field value. The
+// groups are indexed in the first entry order.
+func rankGroups(input chan *Entry, field string, by string) []rankedEntry {
+	indexes := make(map[string]int)
+	var groups []rankedEntry
+	var counts []uint64
+	for entry := range input {
+		key, ok := entry.fields[field]
+		if !ok {
+			continue
+		}
+		i, seen := indexes[key]
+		if !seen {
+			i = len(groups)
+			indexes[key] = i
+			groups = append(groups, rankedEntry{NewEntry(Fields{field: key}), 0, i})
+			counts = append(counts, 0)
+		}
+		counts[i]++
+		if by != "" {
+			value, _ := entry.FloatField(by)
+			groups[i].value += value
+		}
+	}
+	for i := range groups {
+		groups[i].entry.SetUintField("count", counts[i])
+		if by != "" {
+			groups[i].entry.SetFloatField(by, groups[i].value)
+		} else {
+			groups[i].value = float64(counts[i])
+		}
+	}
+	return groups
+}
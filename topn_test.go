@@ -0,0 +1,82 @@
+package gonx
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTopN(t *testing.T) {
+	Convey("Test TopN reducer", t, func() {
+		input := make(chan *Entry, 10)
+		for _, fields := range []Fields{
+			{"uri": "/a", "bytes": "100"},
+			{"uri": "/b", "bytes": "500"},
+			{"uri": "/a", "bytes": "100"},
+			{"uri": "/c", "bytes": "50"},
+			{"uri": "/a", "bytes": "100"},
+			{"uri": "/b", "bytes": "-"},
+			{"bytes": "1000"},
+		} {
+			input <- NewEntry(fields)
+		}
+		close(input)
+		output := make(chan *Entry, 10)
+		collect := func() (results []Fields) {
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			return
+		}
+
+		Convey("Top groups by count", func() {
+			reducer := &TopN{Field: "uri", N: 2}
+			reducer.Reduce(input, output)
+			So(collect(), ShouldResemble, []Fields{
+				{"uri": "/a", "count": "3"},
+				{"uri": "/b", "count": "2"},
+			})
+		})
+
+		Convey("Top groups by sum", func() {
+			reducer := &TopN{Field: "uri", By: "bytes"}
+			reducer.Reduce(input, output)
+			So(collect(), ShouldResemble, []Fields{
+				{"uri": "/b", "count": "2", "bytes": "500.00"},
+				{"uri": "/a", "count": "3", "bytes": "300.00"},
+				{"uri": "/c", "count": "1", "bytes": "50.00"},
+			})
+		})
+
+		Convey("Top entries", func() {
+			reducer := &TopN{N: 3, By: "bytes"}
+			reducer.Reduce(input, output)
+			So(collect(), ShouldResemble, []Fields{
+				{"bytes": "1000"},
+				{"uri": "/b", "bytes": "500"},
+				// Ties are written in the input order
+				{"uri": "/a", "bytes": "100"},
+			})
+		})
+
+		Convey("Bottom groups by count", func() {
+			reducer := &BottomN{Field: "uri", N: 2}
+			reducer.Reduce(input, output)
+			So(collect(), ShouldResemble, []Fields{
+				{"uri": "/c", "count": "1"},
+				{"uri": "/b", "count": "2"},
+			})
+		})
+
+		Convey("Bottom entries", func() {
+			reducer := &BottomN{N: 3, By: "bytes"}
+			reducer.Reduce(input, output)
+			So(collect(), ShouldResemble, []Fields{
+				// Empty values are missing
+				{"uri": "/c", "bytes": "50"},
+				{"uri": "/a", "bytes": "100"},
+				{"uri": "/a", "bytes": "100"},
+			})
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package gonx
+
+import (
+	"sync/atomic"
+)
+
+// Tracer is the interface for the pipeline stages tracing. The gonx/x/otel
+// package provides OpenTelemetry adapter for it.
+//
+// Start method should start a new span with the given name. Traced stages
+// are "gonx.read", "gonx.parse", "gonx.reduce" and "gonx.sink.write".
+type Tracer interface {
+	Start(name string) Span
+}
+
+// Span is the traced stage started by the Tracer. Entry counts and other
+// stage stats are set as span attributes.
+type Span interface {
+	SetCount(key string, n int64)
+	End()
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(name string) Span {
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetCount(key string, n int64) {}
+
+func (noopSpan) End() {}
+
+type tracerHolder struct {
+	Tracer
+}
+
+var tracer atomic.Value
+
+func init() {
+	tracer.Store(tracerHolder{noopTracer{}})
+}
+
+// SetTracer sets the Tracer for all the pipelines started after the call.
+// Tracing is disabled if nil is given, it is the default.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = noopTracer{}
+	}
+	tracer.Store(tracerHolder{t})
+}
+
+// StartSpan starts a new span using the Tracer set by SetTracer. Use it to
+// trace custom reducers and sinks.
+func StartSpan(name string) Span {
+	return tracer.Load().(tracerHolder).Start(name)
+}
+
+func tracingEnabled() bool {
+	_, noop := tracer.Load().(tracerHolder).Tracer.(noopTracer)
+	return !noop
+}
+
+// Run reducer in a separate goroutine and return its output channel. If
+// tracing is enabled the reducer is wrapped by the "gonx.reduce" span which
+// ends when the output is closed.
+func traceReduce(reducer Reducer, input chan *Entry) chan *Entry {
+	var output = make(chan *Entry)
+	if !tracingEnabled() {
+		go reducer.Reduce(input, output)
+		return output
+	}
+	span := StartSpan("gonx.reduce")
+	var results = make(chan *Entry)
+	go reducer.Reduce(input, results)
+	go func() {
+		var count int64
+		for entry := range results {
+			count++
+			output <- entry
+		}
+		span.SetCount("entries", count)
+		span.End()
+		close(output)
+	}()
+	return output
+}
@@ -0,0 +1,58 @@
+package gonx
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans map[string]*recordingSpan
+}
+
+func (t *recordingTracer) Start(name string) Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordingSpan{counts: make(map[string]int64)}
+	t.spans[name] = span
+	return span
+}
+
+type recordingSpan struct {
+	counts map[string]int64
+	ended  bool
+}
+
+func (s *recordingSpan) SetCount(key string, n int64) {
+	s.counts[key] = n
+}
+
+func (s *recordingSpan) End() {
+	s.ended = true
+}
+
+func TestTracer(t *testing.T) {
+	Convey("Test pipeline tracing", t, func() {
+		tracer := &recordingTracer{spans: make(map[string]*recordingSpan)}
+		SetTracer(tracer)
+		defer SetTracer(nil)
+
+		file := strings.NewReader("89.234.89.123 200\n89.234.89.124 404\ninvalid\n")
+		output := MapReduce(file, NewParser("$remote_addr $status"), new(ReadAll))
+		count := 0
+		for range output {
+			count++
+		}
+		So(count, ShouldEqual, 2)
+
+		So(tracer.spans["gonx.read"].ended, ShouldBeTrue)
+		So(tracer.spans["gonx.read"].counts, ShouldResemble, map[string]int64{"lines": 3})
+		So(tracer.spans["gonx.parse"].ended, ShouldBeTrue)
+		So(tracer.spans["gonx.parse"].counts, ShouldResemble, map[string]int64{"entries": 2, "errors": 1})
+		So(tracer.spans["gonx.reduce"].ended, ShouldBeTrue)
+		So(tracer.spans["gonx.reduce"].counts, ShouldResemble, map[string]int64{"entries": 2})
+	})
+}
@@ -0,0 +1,168 @@
+package gonx
+
+import (
+	"sort"
+	"time"
+)
+
+// Implements Reducer interface to aggregate the entries of the streaming
+// input (e.g. of the followed log file) by the event time windows. Unlike
+// GroupByTime, which writes the results when the input is closed, each
+// window result is written as soon as the window is over, e.g. the count
+// and p95 latency per minute:
+//
+//	NewTumblingWindow("time_local", time.Minute,
+//		new(Count), &Percentile{Field: "request_time", Quantiles: []float64{0.95}})
+//
+// The window is over when the watermark passes its end. The watermark is
+// the latest entry time less the AllowedLateness, so the slightly out of
+// order entries (e.g. flushed by several nginx workers) still get to their
+// windows, at the cost of the results delay. Entries of the windows that
+// are already over are dropped. Results have the window start time
+// formatted with the Format, the rest of the windows are written when the
+// input is closed. Windows are aligned to UTC as the GroupByTime buckets.
+// Entries without the valid time are skipped.
+//
+// Windows overlap if the Slide is less than the Size, e.g. the 5 minutes
+// windows sliding every minute smooth the metrics for the alerts. The entry
+// is passed to each window it is within then.
+type StreamWindow struct {
+	Field string
+	// Time layout, the nginx layout for the field name (see
+	// Entry.DefaultTimeField) by default. Windows of the other fields are
+	// formatted as RFC 3339 then.
+	Format string
+	// Window size, Reduce panics if it is not positive.
+	Size time.Duration
+	// Interval between the windows starts, the Size by default.
+	Slide time.Duration
+	// How late the entries could be, 0 means the entries are ordered.
+	AllowedLateness time.Duration
+
+	reducers []Reducer
+}
+
+// Returns the StreamWindow of the consecutive non-overlapping windows of
+// the size, it panics if the size is not positive.
+func NewTumblingWindow(field string, size time.Duration, reducers ...Reducer) *StreamWindow {
+	checkWindowSize(size)
+	return &StreamWindow{
+		Field:    field,
+		Size:     size,
+		reducers: reducers,
+	}
+}
+
+// Returns the StreamWindow of the windows of the size, which start every
+// slide interval, e.g. hopping windows. It panics if the size is not
+// positive.
+func NewSlidingWindow(field string, size, slide time.Duration, reducers ...Reducer) *StreamWindow {
+	checkWindowSize(size)
+	return &StreamWindow{
+		Field:    field,
+		Size:     size,
+		Slide:    slide,
+		reducers: reducers,
+	}
+}
+
+// Panic on the non-positive window size as time.NewTicker does, otherwise
+// all the entries would be dropped.
+func checkWindowSize(size time.Duration) {
+	if size <= 0 {
+		panic("gonx: non-positive StreamWindow size")
+	}
+}
+
+type openWindow struct {
+	start  time.Time
+	input  chan *Entry
+	output chan *Entry
+}
+
+// Apply related reducers to the entries of each window and write the window
+// results as soon as it is over.
+func (r *StreamWindow) Reduce(input chan *Entry, output chan *Entry) {
+	checkWindowSize(r.Size)
+	layout := r.Format
+	if layout == "" {
+		layout = NginxTimeLayouts[r.Field]
+	}
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	windows := make(map[int64]*openWindow)
+	var latest, watermark time.Time
+	for entry := range input {
+		t, err := entry.timeField(r.Field, r.Format)
+		if err != nil {
+			continue
+		}
+		if t.After(latest) {
+			latest = t
+			watermark = latest.Add(-r.AllowedLateness)
+			r.emit(windows, watermark, output)
+		}
+		for _, start := range r.starts(t) {
+			if !start.Add(r.Size).After(watermark) {
+				// The window is over
+				continue
+			}
+			window, ok := windows[start.UnixNano()]
+			if !ok {
+				window = &openWindow{
+					start:  start,
+					input:  make(chan *Entry, cap(input)),
+					output: make(chan *Entry, cap(output)+1),
+				}
+				result := NewEmptyEntry()
+				result.SetTimeField(r.Field, start, layout)
+				window.output <- result
+				windows[start.UnixNano()] = window
+				go NewChain(r.reducers...).Reduce(window.input, window.output)
+			}
+			window.input <- entry
+		}
+	}
+	r.emit(windows, time.Time{}, output)
+	close(output)
+}
+
+// Returns the starts of the windows the time is within, the latest first.
+func (r *StreamWindow) starts(t time.Time) []time.Time {
+	slide := r.Slide
+	if slide <= 0 || slide > r.Size {
+		slide = r.Size
+	}
+	var starts []time.Time
+	for start := t.Truncate(slide); start.Add(r.Size).After(t); start = start.Add(-slide) {
+		starts = append(starts, start)
+	}
+	return starts
+}
+
+// Write the results of the windows that are over by the watermark, all of
+// them if it is zero, in the time order.
+func (r *StreamWindow) emit(windows map[int64]*openWindow, watermark time.Time, output chan *Entry) {
+	var over []int64
+	for key, window := range windows {
+		if watermark.IsZero() || !window.start.Add(r.Size).After(watermark) {
+			over = append(over, key)
+		}
+	}
+	sort.Sort(int64s(over))
+	for _, key := range over {
+		window := windows[key]
+		delete(windows, key)
+		close(window.input)
+		entry := <-window.output
+		entry.Merge(<-window.output)
+		output <- entry
+	}
+}
+
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,72 @@
+package gonx
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreamWindow(t *testing.T) {
+	Convey("Test tumbling window", t, func() {
+		input := make(chan *Entry)
+		output := make(chan *Entry)
+		go NewTumblingWindow("time_local", time.Minute, new(Count)).Reduce(input, output)
+		send := func(times ...string) {
+			for _, t := range times {
+				input <- NewEntry(Fields{"time_local": "08/Nov/2013:13:" + t + " +0000"})
+			}
+		}
+
+		send("40:01", "40:30", "invalid", "40:59")
+		// The window is written as soon as the next one starts
+		send("41:00")
+		So((<-output).Fields(), ShouldResemble, Fields{"time_local": "08/Nov/2013:13:40:00 +0000", "count": "3"})
+		// The late entry is dropped
+		send("40:45", "41:10", "43:05")
+		So((<-output).Fields(), ShouldResemble, Fields{"time_local": "08/Nov/2013:13:41:00 +0000", "count": "2"})
+		close(input)
+		So((<-output).Fields(), ShouldResemble, Fields{"time_local": "08/Nov/2013:13:43:00 +0000", "count": "1"})
+		_, ok := <-output
+		So(ok, ShouldBeFalse)
+	})
+	Convey("Test window size validation", t, func() {
+		So(func() { NewTumblingWindow("time_local", 0, new(Count)) }, ShouldPanic)
+		So(func() { NewSlidingWindow("time_local", -time.Minute, time.Minute, new(Count)) }, ShouldPanic)
+		input := make(chan *Entry)
+		close(input)
+		So(func() { new(StreamWindow).Reduce(input, make(chan *Entry)) }, ShouldPanic)
+	})
+
+	Convey("Test sliding window", t, func() {
+		input := make(chan *Entry, 10)
+		output := make(chan *Entry, 10)
+		for _, t := range []string{"40:10", "41:10", "42:10", "43:10"} {
+			input <- NewEntry(Fields{"time_local": "08/Nov/2013:13:" + t + " +0000"})
+		}
+		close(input)
+		NewSlidingWindow("time_local", 3*time.Minute, time.Minute, new(Count)).Reduce(input, output)
+		var results []string
+		for result := range output {
+			results = append(results, result.Fields()["time_local"][12:17]+" "+result.Fields()["count"])
+		}
+		So(results, ShouldResemble, []string{
+			"13:38 1", "13:39 2", "13:40 3", "13:41 3", "13:42 2", "13:43 1",
+		})
+		So((&StreamWindow{Size: time.Minute, Slide: time.Hour}).starts(time.Unix(90, 0)), ShouldResemble, []time.Time{time.Unix(60, 0)})
+	})
+	Convey("Test window allowed lateness", t, func() {
+		input := make(chan *Entry, 10)
+		output := make(chan *Entry, 10)
+		for _, t := range []string{"40:10", "41:05", "40:50", "41:20", "40:55", "41:40"} {
+			input <- NewEntry(Fields{"time_local": "08/Nov/2013:13:" + t + " +0000"})
+		}
+		close(input)
+		window := NewTumblingWindow("time_local", time.Minute, new(Count))
+		window.AllowedLateness = 15 * time.Second
+		window.Reduce(input, output)
+		// 40:50 is within the lateness, 40:55 after 41:20 is not
+		So((<-output).Fields(), ShouldResemble, Fields{"time_local": "08/Nov/2013:13:40:00 +0000", "count": "2"})
+		So((<-output).Fields(), ShouldResemble, Fields{"time_local": "08/Nov/2013:13:41:00 +0000", "count": "3"})
+	})
+}
@@ -0,0 +1,9 @@
+// Package x is the root of the experimental gonx subpackages, such as
+// sinks and sources of the entries, or the analytics recipes.
+//
+// The stable core API lives in the gonx package itself: Entry, the parsers,
+// Reducer and Reader. Experimental packages talk to the core only through
+// its adapter interfaces (gonx.StringParser, gonx.Reducer, gonx.Sink and
+// gonx.EntryReader), so they can be changed or removed between releases
+// without breaking the code which uses the core only.
+package x
@@ -0,0 +1,55 @@
+// Package otel adapts OpenTelemetry tracer to the gonx.Tracer interface, so
+// gonx pipeline stages are shown in the existing tracing UI. This package
+// has the same name as the OpenTelemetry API one, alias either of them:
+//
+//	import (
+//		"github.com/satyrius/gonx"
+//		gonxotel "github.com/satyrius/gonx/x/otel"
+//		"go.opentelemetry.io/otel"
+//	)
+//
+//	gonx.SetTracer(gonxotel.NewTracer(ctx, otel.GetTracerProvider().Tracer("gonx")))
+//
+// The OpenTelemetry packages are installed by the Makefile deps target.
+package otel
+
+import (
+	"context"
+
+	"github.com/satyrius/gonx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer implements gonx.Tracer interface. All spans are started as the
+// children of the context given to NewTracer.
+type Tracer struct {
+	ctx    context.Context
+	tracer trace.Tracer
+}
+
+// Returns a new Tracer that starts spans with the given OpenTelemetry tracer.
+func NewTracer(ctx context.Context, tracer trace.Tracer) *Tracer {
+	return &Tracer{ctx, tracer}
+}
+
+// Start a new OpenTelemetry span.
+func (t *Tracer) Start(name string) gonx.Span {
+	_, span := t.tracer.Start(t.ctx, name)
+	return &Span{span}
+}
+
+// Span implements gonx.Span interface for the OpenTelemetry span.
+type Span struct {
+	span trace.Span
+}
+
+// Set integer span attribute.
+func (s *Span) SetCount(key string, n int64) {
+	s.span.SetAttributes(attribute.Int64(key, n))
+}
+
+// End the span.
+func (s *Span) End() {
+	s.span.End()
+}
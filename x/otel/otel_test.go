@@ -0,0 +1,38 @@
+package otel
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/satyrius/gonx"
+	. "github.com/smartystreets/goconvey/convey"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	Convey("Test OpenTelemetry tracer", t, func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		gonx.SetTracer(NewTracer(context.Background(), provider.Tracer("gonx")))
+		defer gonx.SetTracer(nil)
+
+		file := strings.NewReader("foo\nbar\n")
+		output := gonx.MapReduce(file, gonx.NewParser("$name"), new(gonx.Count))
+		for range output {
+		}
+
+		spans := make(map[string]map[string]int64)
+		for _, span := range recorder.Ended() {
+			attrs := make(map[string]int64)
+			for _, attr := range span.Attributes() {
+				attrs[string(attr.Key)] = attr.Value.AsInt64()
+			}
+			spans[span.Name()] = attrs
+		}
+		So(spans["gonx.read"], ShouldResemble, map[string]int64{"lines": 2})
+		So(spans["gonx.parse"], ShouldResemble, map[string]int64{"entries": 2, "errors": 0})
+		So(spans["gonx.reduce"], ShouldResemble, map[string]int64{"entries": 1})
+	})
+}
@@ -0,0 +1,259 @@
+// Package recipes contains ready to run gonx reducers for the common access
+// log analytics. Use them as they are, or as examples of building your own
+// pipelines from the gonx reducers and filters.
+//
+// Recipes expect nginx field names (see gonx presets): request or
+// request_uri, request_time (in seconds), status, body_bytes_sent,
+// remote_addr, http_user_agent and time_local.
+package recipes
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/satyrius/gonx"
+)
+
+// TopSlowEndpoints returns a reducer to find n endpoints with the highest
+// average request_time. Endpoint is the request_uri field without the query
+// string, it is taken from the request field if there is no request_uri.
+// Results have request_uri, request_time (average), request_time_count and
+// count fields and are written slowest first.
+func TopSlowEndpoints(n int) gonx.Reducer {
+	return gonx.NewPipeline(
+		new(endpoint),
+		gonx.NewGroupBy([]string{"request_uri"},
+			&gonx.Avg{Fields: []string{"request_time"}},
+		),
+		&gonx.TopN{N: n, By: "request_time"},
+	)
+}
+
+// TrafficByCountry returns a reducer to count requests and sum the
+// body_bytes_sent by the geoip_country_code field, e.g. from the nginx
+// geoip module or the entries enrichment. Results are written in the order
+// of requests count, the largest first.
+func TrafficByCountry() gonx.Reducer {
+	return gonx.NewPipeline(
+		gonx.NewGroupBy([]string{"geoip_country_code"},
+			new(gonx.Count),
+			&gonx.Sum{Fields: []string{"body_bytes_sent"}},
+		),
+		&gonx.TopN{By: "count"},
+	)
+}
+
+// ErrorBudget returns a reducer to check the availability SLO, e.g. 0.999
+// for 99.9% of successful requests. Requests with 5xx status are errors.
+// The result entry has requests, errors, error_rate, compliance (share of
+// the successful requests), budget_used (share of the allowed errors spent,
+// more than 1 if the SLO is violated) and budget_remaining fields.
+func ErrorBudget(slo float64) gonx.Reducer {
+	return &errorBudget{SLO: slo}
+}
+
+// LatencyBudget returns a reducer to check the latency SLO, e.g. 0.99 of
+// requests complete under 300ms. Requests with request_time over the
+// threshold are errors, requests without it are not counted. The result
+// entry is the same as the ErrorBudget one.
+func LatencyBudget(slo float64, threshold time.Duration) gonx.Reducer {
+	return &errorBudget{SLO: slo, Threshold: threshold}
+}
+
+// Bandwidth returns a reducer to summarize the traffic: the result entry
+// has requests, body_bytes_sent (total), avg_body_bytes_sent and, if the
+// time_local field covers more than a second, duration (in seconds) and
+// throughput (bytes per second) fields. The sizes are also written human
+// readable, e.g. "1.5 MiB", as the fields with "_human" suffix. Entries
+// without the integer body_bytes_sent are not counted. The total is
+// saturated at the int64 bounds instead of overflowing.
+func Bandwidth() gonx.Reducer {
+	return new(bandwidth)
+}
+
+// UniqueVisitors returns a reducer to count unique visitors, i.e. distinct
+// remote_addr and http_user_agent pairs. The number is written as the
+// count field.
+func UniqueVisitors() gonx.Reducer {
+	return gonx.NewPipeline(
+		gonx.NewGroupBy([]string{"remote_addr", "http_user_agent"}, new(gonx.Count)),
+		new(gonx.Count),
+	)
+}
+
+// UniqueVisitorsPer returns a reducer to count unique visitors per
+// time_local bucket of the granularity, e.g. per day. The visitors are
+// counted approximately with HyperLogLog (see gonx.ApproxDistinct), so the
+// memory does not grow with the traffic. Results have the bucket time_local
+// and the count fields and are written in the time order.
+func UniqueVisitorsPer(granularity time.Duration) gonx.Reducer {
+	return gonx.NewPipeline(
+		gonx.NewGroupByTime("time_local", granularity,
+			&gonx.ApproxDistinct{Fields: []string{"remote_addr", "http_user_agent"}},
+		),
+		&rename{"distinct_remote_addr_http_user_agent", "count"},
+	)
+}
+
+// Sets the request_uri field without the query string.
+type endpoint struct{}
+
+func (f *endpoint) Filter(entry *gonx.Entry) *gonx.Entry {
+	uri, err := entry.Field("request_uri")
+	if err != nil {
+		// Request line is "GET /path HTTP/1.1"
+		request, err := entry.Field("request")
+		if err != nil {
+			return nil
+		}
+		parts := strings.Fields(request)
+		if len(parts) < 2 {
+			return nil
+		}
+		uri = parts[1]
+	}
+	if i := strings.IndexByte(uri, '?'); i >= 0 {
+		uri = uri[:i]
+	}
+	entry.SetField("request_uri", uri)
+	return entry
+}
+
+func (f *endpoint) Reduce(input chan *gonx.Entry, output chan *gonx.Entry) {
+	for entry := range input {
+		if valid := f.Filter(entry); valid != nil {
+			output <- valid
+		}
+	}
+	close(output)
+}
+
+// Renames the old field.
+type rename struct {
+	old, name string
+}
+
+func (f *rename) Filter(entry *gonx.Entry) *gonx.Entry {
+	entry.Rename(f.old, f.name)
+	return entry
+}
+
+func (f *rename) Reduce(input chan *gonx.Entry, output chan *gonx.Entry) {
+	for entry := range input {
+		output <- f.Filter(entry)
+	}
+	close(output)
+}
+
+type errorBudget struct {
+	SLO float64
+	// Latency threshold, the 5xx requests are errors if it is 0.
+	Threshold time.Duration
+}
+
+func (r *errorBudget) Reduce(input chan *gonx.Entry, output chan *gonx.Entry) {
+	var requests, errors uint64
+	for entry := range input {
+		if r.Threshold > 0 {
+			latency, err := entry.DurationField("request_time")
+			if err != nil {
+				continue
+			}
+			requests++
+			if latency > r.Threshold {
+				errors++
+			}
+			continue
+		}
+		requests++
+		if status, err := entry.Field("status"); err == nil && strings.HasPrefix(status, "5") {
+			errors++
+		}
+	}
+	var rate, used float64
+	if requests > 0 {
+		rate = float64(errors) / float64(requests)
+	}
+	if allowed := 1 - r.SLO; allowed > 0 {
+		used = rate / allowed
+	}
+	result := gonx.NewEmptyEntry()
+	result.SetUintField("requests", requests)
+	result.SetUintField("errors", errors)
+	// SetFloatField rounds to 2 decimal places, too coarse for the rates
+	result.SetField("error_rate", strconv.FormatFloat(rate, 'f', 6, 64))
+	result.SetField("compliance", strconv.FormatFloat(1-rate, 'f', 6, 64))
+	result.SetField("budget_used", strconv.FormatFloat(used, 'f', 6, 64))
+	result.SetField("budget_remaining", strconv.FormatFloat(1-used, 'f', 6, 64))
+	output <- result
+	close(output)
+}
+
+type bandwidth struct{}
+
+func (r *bandwidth) Reduce(input chan *gonx.Entry, output chan *gonx.Entry) {
+	var requests uint64
+	var bytes int64
+	var first, last time.Time
+	for entry := range input {
+		size, err := entry.IntField("body_bytes_sent")
+		if err != nil {
+			continue
+		}
+		requests++
+		bytes = addSaturated(bytes, size)
+		if t, err := entry.DefaultTimeField("time_local"); err == nil {
+			if first.IsZero() || t.Before(first) {
+				first = t
+			}
+			if t.After(last) {
+				last = t
+			}
+		}
+	}
+	result := gonx.NewEmptyEntry()
+	result.SetUintField("requests", requests)
+	result.SetIntField("body_bytes_sent", bytes)
+	result.SetField("body_bytes_sent_human", humanBytes(float64(bytes)))
+	if requests > 0 {
+		avg := float64(bytes) / float64(requests)
+		result.SetFloatField("avg_body_bytes_sent", avg)
+		result.SetField("avg_body_bytes_sent_human", humanBytes(avg))
+	}
+	if duration := last.Sub(first).Seconds(); duration >= 1 {
+		throughput := float64(bytes) / duration
+		result.SetFloatField("duration", duration)
+		result.SetFloatField("throughput", throughput)
+		result.SetField("throughput_human", humanBytes(throughput)+"/s")
+	}
+	output <- result
+	close(output)
+}
+
+// Returns a + b, or the int64 bound it would overflow.
+func addSaturated(a, b int64) int64 {
+	if b > 0 && a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	if b < 0 && a < math.MinInt64-b {
+		return math.MinInt64
+	}
+	return a + b
+}
+
+// Returns the size in the binary units, e.g. "512 B" or "1.5 MiB".
+func humanBytes(size float64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%.0f B", size)
+	}
+	units := []string{"KiB", "MiB", "GiB", "TiB", "PiB"}
+	unit := -1
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
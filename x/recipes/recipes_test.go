@@ -0,0 +1,145 @@
+package recipes
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/satyrius/gonx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const format = `$remote_addr "$request" $status $body_bytes_sent $request_time "$http_user_agent" $geoip_country_code`
+
+var logs = strings.Join([]string{
+	`89.234.89.123 "GET /api/foo?id=1 HTTP/1.1" 200 100 0.100 "curl" NL`,
+	`89.234.89.123 "GET /api/foo?id=2 HTTP/1.1" 200 100 0.300 "curl" NL`,
+	`89.234.89.124 "GET /api/bar HTTP/1.1" 500 50 1.000 "curl" DE`,
+	`89.234.89.124 "GET / HTTP/1.1" 200 1000 0.010 "Mozilla" NL`,
+}, "\n")
+
+func reduce(reducer gonx.Reducer) (results []*gonx.Entry) {
+	output := gonx.MapReduce(strings.NewReader(logs), gonx.NewParser(format), reducer)
+	for entry := range output {
+		results = append(results, entry)
+	}
+	return
+}
+
+func TestRecipes(t *testing.T) {
+	Convey("Test analytics recipes", t, func() {
+		Convey("Top slow endpoints", func() {
+			results := reduce(TopSlowEndpoints(2))
+			So(len(results), ShouldEqual, 2)
+			So(results[0].Fields(), ShouldResemble, gonx.Fields{
+				"request_uri": "/api/bar", "request_time": "1.00", "request_time_count": "1", "count": "1",
+			})
+			So(results[1].Fields(), ShouldResemble, gonx.Fields{
+				"request_uri": "/api/foo", "request_time": "0.20", "request_time_count": "2", "count": "2",
+			})
+		})
+
+		Convey("Traffic by country", func() {
+			results := reduce(TrafficByCountry())
+			So(len(results), ShouldEqual, 2)
+			So(results[0].Fields(), ShouldResemble, gonx.Fields{
+				"geoip_country_code": "NL", "count": "3", "body_bytes_sent": "1200.00",
+			})
+		})
+
+		Convey("Error budget", func() {
+			results := reduce(ErrorBudget(0.5))
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Fields(), ShouldResemble, gonx.Fields{
+				"requests":         "4",
+				"errors":           "1",
+				"error_rate":       "0.250000",
+				"compliance":       "0.750000",
+				"budget_used":      "0.500000",
+				"budget_remaining": "0.500000",
+			})
+		})
+
+		Convey("Latency budget", func() {
+			results := reduce(LatencyBudget(0.9, 200*time.Millisecond))
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Fields(), ShouldResemble, gonx.Fields{
+				"requests":         "4",
+				"errors":           "2",
+				"error_rate":       "0.500000",
+				"compliance":       "0.500000",
+				"budget_used":      "5.000000",
+				"budget_remaining": "-4.000000",
+			})
+		})
+
+		Convey("Bandwidth", func() {
+			results := reduce(Bandwidth())
+			So(len(results), ShouldEqual, 1)
+			So(results[0].Fields(), ShouldResemble, gonx.Fields{
+				"requests":                  "4",
+				"body_bytes_sent":           "1250",
+				"body_bytes_sent_human":     "1.2 KiB",
+				"avg_body_bytes_sent":       "312.50",
+				"avg_body_bytes_sent_human": "312 B",
+			})
+		})
+
+		Convey("Bandwidth throughput", func() {
+			input := make(chan *gonx.Entry, 2)
+			input <- gonx.NewEntry(gonx.Fields{"time_local": "08/Nov/2013:13:39:18 +0000", "body_bytes_sent": "3145728"})
+			input <- gonx.NewEntry(gonx.Fields{"time_local": "08/Nov/2013:13:39:20 +0000", "body_bytes_sent": "0"})
+			close(input)
+			output := make(chan *gonx.Entry, 1)
+			Bandwidth().Reduce(input, output)
+			result := <-output
+			So(result.Fields()["duration"], ShouldEqual, "2.00")
+			So(result.Fields()["throughput"], ShouldEqual, "1572864.00")
+			So(result.Fields()["throughput_human"], ShouldEqual, "1.5 MiB/s")
+		})
+
+		Convey("Bandwidth total saturation", func() {
+			input := make(chan *gonx.Entry, 2)
+			input <- gonx.NewEntry(gonx.Fields{"body_bytes_sent": "9223372036854775807"})
+			input <- gonx.NewEntry(gonx.Fields{"body_bytes_sent": "1"})
+			close(input)
+			output := make(chan *gonx.Entry, 1)
+			Bandwidth().Reduce(input, output)
+			So((<-output).Fields()["body_bytes_sent"], ShouldEqual, "9223372036854775807")
+			So(addSaturated(math.MinInt64, -1), ShouldEqual, int64(math.MinInt64))
+			So(addSaturated(1, 2), ShouldEqual, 3)
+		})
+
+		Convey("Unique visitors", func() {
+			results := reduce(UniqueVisitors())
+			So(len(results), ShouldEqual, 1)
+			count, err := results[0].Field("count")
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, "3")
+		})
+
+		Convey("Unique visitors per day", func() {
+			input := make(chan *gonx.Entry, 4)
+			for _, fields := range []gonx.Fields{
+				{"time_local": "08/Nov/2013:13:39:18 +0000", "remote_addr": "1.1.1.1", "http_user_agent": "curl"},
+				{"time_local": "08/Nov/2013:15:39:18 +0000", "remote_addr": "1.1.1.1", "http_user_agent": "curl"},
+				{"time_local": "08/Nov/2013:16:39:18 +0000", "remote_addr": "1.1.1.1", "http_user_agent": "Mozilla"},
+				{"time_local": "09/Nov/2013:13:39:18 +0000", "remote_addr": "1.1.1.1", "http_user_agent": "curl"},
+			} {
+				input <- gonx.NewEntry(fields)
+			}
+			close(input)
+			output := make(chan *gonx.Entry, 2)
+			UniqueVisitorsPer(24*time.Hour).Reduce(input, output)
+			var results []gonx.Fields
+			for entry := range output {
+				results = append(results, entry.Fields())
+			}
+			So(results, ShouldResemble, []gonx.Fields{
+				{"time_local": "08/Nov/2013:00:00:00 +0000", "count": "2"},
+				{"time_local": "09/Nov/2013:00:00:00 +0000", "count": "1"},
+			})
+		})
+	})
+}
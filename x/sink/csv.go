@@ -0,0 +1,158 @@
+package sink
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/satyrius/gonx"
+)
+
+// CSV implements gonx.Sink interface to write entries as CSV rows with the
+// header. The entries are buffered until Flush, so the header has all the
+// fields of the entries (e.g. added by the enrichment) and every row has a
+// value for each column, missing fields are written as empty values.
+// Columns are frozen when the header is written, the entries written after
+// the Flush should not have the new fields.
+type CSV struct {
+	// Protect spreadsheets from the formula injection, see EscapeFormula.
+	// Access log values are attacker-controlled, so it is enabled by
+	// NewCSV.
+	EscapeFormulas bool
+
+	mu            sync.Mutex
+	writer        *csv.Writer
+	columns       []string
+	known         map[string]bool
+	entries       []*gonx.Entry
+	headerWritten bool
+}
+
+// Returns a new CSV sink. Given columns go first, other entry fields are
+// added in alphabetical order as soon as they appear.
+func NewCSV(w io.Writer, columns ...string) *CSV {
+	sink := &CSV{EscapeFormulas: true, writer: csv.NewWriter(w), known: make(map[string]bool)}
+	sink.addColumns(columns)
+	return sink
+}
+
+// Buffer entries to be written as CSV rows by Flush. It returns an error if
+// the header is written already and the entry has a field not in it.
+func (s *CSV) WriteEntries(entries []*gonx.Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		fields := newFields(entry, s.known)
+		if s.headerWritten && len(fields) > 0 {
+			return fmt.Errorf("gonx: CSV header is written, field %q is not in it", fields[0])
+		}
+		s.addColumns(fields)
+	}
+	s.entries = append(s.entries, entries...)
+	return nil
+}
+
+// Write the header, unless it is written already, and the buffered entries.
+// Call it when all the entries are written, e.g. after the Writer Reduce.
+func (s *CSV) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.headerWritten {
+		if err := s.writer.Write(s.escape(s.columns)); err != nil {
+			return err
+		}
+		s.headerWritten = true
+	}
+	for _, entry := range s.entries {
+		if err := s.writer.Write(s.escape(entry.ToSlice(s.columns))); err != nil {
+			return err
+		}
+	}
+	s.entries = nil
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+// Returns the current list of columns.
+func (s *CSV) Columns() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.columns...)
+}
+
+func (s *CSV) escape(row []string) []string {
+	if !s.EscapeFormulas {
+		return row
+	}
+	escaped := make([]string, len(row))
+	for i, value := range row {
+		escaped[i] = EscapeFormula(value)
+	}
+	return escaped
+}
+
+func (s *CSV) addColumns(columns []string) {
+	for _, name := range columns {
+		if !s.known[name] {
+			s.known[name] = true
+			s.columns = append(s.columns, name)
+		}
+	}
+}
+
+// Returns sorted names of the entry fields that are not known yet.
+func newFields(entry *gonx.Entry, known map[string]bool) []string {
+	var names []string
+	for _, name := range entry.Names() {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// EscapeFormula makes the value safe to open in spreadsheets. Values that
+// start with "=", "+", "-", "@", tab or carriage return are prefixed with a
+// single quote, so they are not evaluated as formulas. Numbers (e.g. "-1")
+// and the "-" placeholder are kept as they are. Other control characters
+// are replaced with "\xXX" escape sequences.
+func EscapeFormula(value string) string {
+	if value == "" {
+		return value
+	}
+	if strings.IndexFunc(value, isControl) >= 0 {
+		value = escapeControls(value)
+	}
+	switch value[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		if value == "-" {
+			break
+		}
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			break
+		}
+		return "'" + value
+	}
+	return value
+}
+
+// Control characters other than tab and carriage return, which are
+// handled as the formula prefix.
+func isControl(r rune) bool {
+	return (r < 0x20 || r == 0x7f) && r != '\t' && r != '\r'
+}
+
+func escapeControls(value string) string {
+	var buf strings.Builder
+	for _, r := range value {
+		if isControl(r) {
+			fmt.Fprintf(&buf, "\\x%02X", r)
+		} else {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/satyrius/gonx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCSV(t *testing.T) {
+	Convey("Test CSV sink", t, func() {
+		var buf bytes.Buffer
+		sink := NewCSV(&buf, "remote_addr")
+
+		err := sink.WriteEntries([]*gonx.Entry{
+			gonx.NewEntry(gonx.Fields{"remote_addr": "89.234.89.123", "status": "200"}),
+			gonx.NewEntry(gonx.Fields{"status": "404"}),
+		})
+		So(err, ShouldBeNil)
+
+		Convey("Write header and rows", func() {
+			So(buf.String(), ShouldBeEmpty)
+			So(sink.Flush(), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "remote_addr,status\n89.234.89.123,200\n,404\n")
+		})
+
+		Convey("Add columns for new fields", func() {
+			err := sink.WriteEntries([]*gonx.Entry{
+				gonx.NewEntry(gonx.Fields{"remote_addr": "89.234.89.124", "country": "NL", "status": "200"}),
+			})
+			So(err, ShouldBeNil)
+			So(sink.Flush(), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "remote_addr,status,country\n89.234.89.123,200,\n,404,\n89.234.89.124,200,NL\n")
+			So(sink.Columns(), ShouldResemble, []string{"remote_addr", "status", "country"})
+		})
+
+		Convey("Reject new fields after the header is written", func() {
+			So(sink.Flush(), ShouldBeNil)
+			So(sink.WriteEntries([]*gonx.Entry{gonx.NewEntry(gonx.Fields{"status": "500"})}), ShouldBeNil)
+			So(sink.WriteEntries([]*gonx.Entry{gonx.NewEntry(gonx.Fields{"country": "NL"})}), ShouldNotBeNil)
+			So(sink.Flush(), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "remote_addr,status\n89.234.89.123,200\n,404\n,500\n")
+		})
+
+		Convey("Escape formulas", func() {
+			err := sink.WriteEntries([]*gonx.Entry{
+				gonx.NewEntry(gonx.Fields{"remote_addr": "=HYPERLINK(\"http://evil\")", "status": "-"}),
+				gonx.NewEntry(gonx.Fields{"remote_addr": "-1", "status": "@SUM(A1)"}),
+			})
+			So(err, ShouldBeNil)
+			So(sink.Flush(), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "remote_addr,status\n89.234.89.123,200\n,404\n"+
+				"\"'=HYPERLINK(\"\"http://evil\"\")\",-\n-1,'@SUM(A1)\n")
+		})
+
+		Convey("Escape control characters", func() {
+			So(EscapeFormula("foo\x1bbar"), ShouldEqual, `foo\x1Bbar`)
+			So(EscapeFormula("\tcmd"), ShouldEqual, "'\tcmd")
+			So(EscapeFormula("+7 (999)"), ShouldEqual, "'+7 (999)")
+			So(EscapeFormula("+1.5"), ShouldEqual, "+1.5")
+		})
+
+		Convey("Write raw values", func() {
+			buf.Reset()
+			sink := NewCSV(&buf, "status")
+			sink.EscapeFormulas = false
+			err := sink.WriteEntries([]*gonx.Entry{gonx.NewEntry(gonx.Fields{"status": "=1+1"})})
+			So(err, ShouldBeNil)
+			So(sink.Flush(), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "status\n=1+1\n")
+		})
+	})
+}
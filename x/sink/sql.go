@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/satyrius/gonx"
+)
+
+// SQL implements gonx.Sink interface to insert entries into the database
+// table. The schema evolves with the data: when the entries get new fields
+// (e.g. from the enrichment) they are added to the table as TEXT columns,
+// existing rows get NULL values for them. Each batch is inserted in its own
+// transaction.
+type SQL struct {
+	// Placeholder returns the query parameter placeholder by its index
+	// starting from 1. Defaults to "?", use "$1" style for PostgreSQL.
+	Placeholder func(i int) string
+
+	db      *sql.DB
+	table   string
+	mu      sync.Mutex
+	columns []string
+	known   map[string]bool
+}
+
+// Returns a new SQL sink for the existing table with the given columns.
+func NewSQL(db *sql.DB, table string, columns ...string) *SQL {
+	sink := &SQL{db: db, table: table, known: make(map[string]bool)}
+	for _, name := range columns {
+		sink.known[name] = true
+		sink.columns = append(sink.columns, name)
+	}
+	return sink
+}
+
+// Insert entries into the table, add new columns first if needed. Missing
+// fields are inserted as NULL values.
+func (s *SQL) WriteEntries(entries []*gonx.Entry) error {
+	columns, err := s.evolve(entries)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(s.insertQuery(columns))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, entry := range entries {
+		args := make([]interface{}, len(columns))
+		for i, name := range columns {
+			if value, err := entry.Field(name); err == nil {
+				args[i] = value
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Add columns for the new fields and return the current columns list.
+func (s *SQL) evolve(entries []*gonx.Entry) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range entries {
+		for _, name := range newFields(entry, s.known) {
+			query := fmt.Sprintf("ALTER TABLE %v ADD COLUMN %v TEXT", quoteIdent(s.table), quoteIdent(name))
+			if _, err := s.db.Exec(query); err != nil {
+				return nil, err
+			}
+			s.known[name] = true
+			s.columns = append(s.columns, name)
+		}
+	}
+	return append([]string(nil), s.columns...), nil
+}
+
+func (s *SQL) insertQuery(columns []string) string {
+	names := make([]string, len(columns))
+	params := make([]string, len(columns))
+	for i, name := range columns {
+		names[i] = quoteIdent(name)
+		if s.Placeholder != nil {
+			params[i] = s.Placeholder(i + 1)
+		} else {
+			params[i] = "?"
+		}
+	}
+	return fmt.Sprintf("INSERT INTO %v (%v) VALUES (%v)",
+		quoteIdent(s.table), strings.Join(names, ", "), strings.Join(params, ", "))
+}
+
+// Quote SQL identifier with double quotes.
+func quoteIdent(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
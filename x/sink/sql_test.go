@@ -0,0 +1,102 @@
+package sink
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/satyrius/gonx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// Fake database driver which records executed statements
+type fakeDriver struct {
+	mu         sync.Mutex
+	statements []string
+}
+
+var fake = new(fakeDriver)
+
+func init() {
+	sql.Register("gonx_sink_fake", fake)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d}, nil
+}
+
+func (d *fakeDriver) record(query string, args []driver.Value) {
+	d.mu.Lock()
+	d.statements = append(d.statements, fmt.Sprintf("%v %v", query, args))
+	d.mu.Unlock()
+}
+
+type fakeConn struct {
+	driver *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{c.driver, query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	driver *fakeDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.driver.record(s.query, args)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestSQL(t *testing.T) {
+	Convey("Test SQL sink", t, func() {
+		db, err := sql.Open("gonx_sink_fake", "")
+		So(err, ShouldBeNil)
+		fake.statements = nil
+
+		sink := NewSQL(db, "access_log", "remote_addr")
+		sink.Placeholder = func(i int) string { return fmt.Sprintf("$%d", i) }
+		err = sink.WriteEntries([]*gonx.Entry{
+			gonx.NewEntry(gonx.Fields{"remote_addr": "89.234.89.123", "status": "200"}),
+			gonx.NewEntry(gonx.Fields{"remote_addr": "89.234.89.124"}),
+		})
+		So(err, ShouldBeNil)
+		So(fake.statements, ShouldResemble, []string{
+			`ALTER TABLE "access_log" ADD COLUMN "status" TEXT []`,
+			`INSERT INTO "access_log" ("remote_addr", "status") VALUES ($1, $2) [89.234.89.123 200]`,
+			`INSERT INTO "access_log" ("remote_addr", "status") VALUES ($1, $2) [89.234.89.124 <nil>]`,
+		})
+	})
+}
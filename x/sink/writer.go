@@ -0,0 +1,123 @@
+// Package sink contains gonx.Sink implementations (CSV files, SQL tables)
+// and the concurrent Writer to use them at the end of the reducers chain.
+package sink
+
+import (
+	"sync"
+
+	"github.com/satyrius/gonx"
+)
+
+// Writer implements gonx.Reducer interface to write input entries to the
+// slow Sink using concurrent workers. Written entries are redirected to the
+// output channel, so it could be used at the end of the reducers chain to
+// know what was delivered.
+type Writer struct {
+	Sink gonx.Sink
+	// Number of concurrent Sink writers, one by default.
+	Workers int
+	// Number of entries each worker writes at once, one by default.
+	BatchSize int
+	// Publish written entries in the input order. Otherwise they are
+	// published as soon as the batch is written.
+	Ordered bool
+
+	mu  sync.Mutex
+	err error
+}
+
+type sinkBatch struct {
+	seq     int
+	entries []*gonx.Entry
+}
+
+// Split input into batches and write them with concurrent workers. Entries of
+// the batches that failed to write are not published to the output channel,
+// use Err to get the first write error.
+func (w *Writer) Reduce(input chan *gonx.Entry, output chan *gonx.Entry) {
+	workers := w.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	size := w.BatchSize
+	if size < 1 {
+		size = 1
+	}
+
+	batches := make(chan *sinkBatch, workers)
+	written := make(chan *sinkBatch, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				span := gonx.StartSpan("gonx.sink.write")
+				span.SetCount("entries", int64(len(batch.entries)))
+				if err := w.Sink.WriteEntries(batch.entries); err != nil {
+					span.SetCount("errors", 1)
+					w.setErr(err)
+					batch.entries = nil
+				}
+				span.End()
+				written <- batch
+			}
+		}()
+	}
+
+	// Collect input entries into batches
+	go func() {
+		batch := &sinkBatch{0, make([]*gonx.Entry, 0, size)}
+		for entry := range input {
+			batch.entries = append(batch.entries, entry)
+			if len(batch.entries) == size {
+				batches <- batch
+				batch = &sinkBatch{batch.seq + 1, make([]*gonx.Entry, 0, size)}
+			}
+		}
+		if len(batch.entries) > 0 {
+			batches <- batch
+		}
+		close(batches)
+		wg.Wait()
+		close(written)
+	}()
+
+	// Keep batches written out of order until all the previous are done
+	pending := make(map[int]*sinkBatch)
+	next := 0
+	for batch := range written {
+		if !w.Ordered {
+			publish(batch.entries, output)
+			continue
+		}
+		pending[batch.seq] = batch
+		for batch, ok := pending[next]; ok; batch, ok = pending[next] {
+			publish(batch.entries, output)
+			delete(pending, next)
+			next++
+		}
+	}
+	close(output)
+}
+
+// Err returns the first error that was encountered by the Sink.
+func (w *Writer) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *Writer) setErr(err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+}
+
+func publish(entries []*gonx.Entry, output chan *gonx.Entry) {
+	for _, entry := range entries {
+		output <- entry
+	}
+}
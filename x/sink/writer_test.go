@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/satyrius/gonx"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]*gonx.Entry
+	delay   func(entries []*gonx.Entry) time.Duration
+}
+
+func (s *memorySink) WriteEntries(entries []*gonx.Entry) error {
+	if s.delay != nil {
+		time.Sleep(s.delay(entries))
+	}
+	s.mu.Lock()
+	s.batches = append(s.batches, entries)
+	s.mu.Unlock()
+	return nil
+}
+
+func TestWriter(t *testing.T) {
+	Convey("Test sink Writer", t, func() {
+		input := make(chan *gonx.Entry, 10)
+		for i := 0; i < 10; i++ {
+			input <- gonx.NewEntry(gonx.Fields{"id": strconv.Itoa(i)})
+		}
+		close(input)
+		output := make(chan *gonx.Entry, 10)
+
+		// The first entries are the slowest to write
+		sink := &memorySink{delay: func(entries []*gonx.Entry) time.Duration {
+			id, _ := entries[0].FloatField("id")
+			return time.Duration(10-id) * time.Millisecond
+		}}
+
+		Convey("Write ordered", func() {
+			writer := &Writer{Sink: sink, Workers: 4, BatchSize: 3, Ordered: true}
+			writer.Reduce(input, output)
+			So(writer.Err(), ShouldBeNil)
+
+			So(len(sink.batches), ShouldEqual, 4)
+			for _, batch := range sink.batches {
+				So(len(batch), ShouldBeLessThanOrEqualTo, 3)
+			}
+
+			ids := []string{}
+			for entry := range output {
+				id, _ := entry.Field("id")
+				ids = append(ids, id)
+			}
+			So(ids, ShouldResemble, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"})
+		})
+
+		Convey("Write unordered", func() {
+			writer := &Writer{Sink: sink, Workers: 4, BatchSize: 3}
+			writer.Reduce(input, output)
+			So(writer.Err(), ShouldBeNil)
+
+			ids := make(map[string]bool)
+			for entry := range output {
+				id, _ := entry.Field("id")
+				ids[id] = true
+			}
+			So(len(ids), ShouldEqual, 10)
+		})
+
+		Convey("Write errors", func() {
+			writer := &Writer{
+				Sink: gonx.SinkFunc(func(entries []*gonx.Entry) error {
+					if id, _ := entries[0].Field("id"); id == "0" {
+						return errors.New("write failed")
+					}
+					return nil
+				}),
+				BatchSize: 5,
+				Ordered:   true,
+			}
+			writer.Reduce(input, output)
+			So(writer.Err(), ShouldNotBeNil)
+
+			// Only the second batch is published
+			count := 0
+			for range output {
+				count++
+			}
+			So(count, ShouldEqual, 5)
+		})
+	})
+}